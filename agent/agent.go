@@ -11,10 +11,10 @@ import (
 
 // MarketListener structs implement essential market functions for all agent strategies
 type MarketListener interface {
-	NewOrder(orderID string, price float64, quantity float64, params ...interface{}) error
-	OnTrade(price float64, quantity float64, tradeID string, buyerOrderID string, sellerOrderID string, params ...interface{})
-	OnBookUpdateBid(price float64, quantity float64, params ...interface{})
-	OnBookUpdateAsk(price float64, quantity float64, params ...interface{})
+	NewOrder(orderID string, price exchange.Decimal, quantity exchange.Decimal, params ...interface{}) error
+	OnTrade(price exchange.Decimal, quantity exchange.Decimal, tradeID string, buyerOrderID string, sellerOrderID string, params ...interface{})
+	OnBookUpdateBid(price exchange.Decimal, quantity exchange.Decimal, params ...interface{})
+	OnBookUpdateAsk(price exchange.Decimal, quantity exchange.Decimal, params ...interface{})
 }
 
 // Agent is a trader in the market - either buying or selling goods
@@ -78,8 +78,8 @@ func (a *Agent) onBookUpdate(b exchange.BookUpdate) {
 	}(b)
 }
 
-func (a *Agent) onBookUpdateBid(price float64, quantity float64) {
-	if quantity != 0 {
+func (a *Agent) onBookUpdateBid(price exchange.Decimal, quantity exchange.Decimal) {
+	if !quantity.IsZero() {
 		a.Strategy.OnBookUpdateBid(price, quantity)
 	} else {
 		// removed off order book
@@ -87,8 +87,8 @@ func (a *Agent) onBookUpdateBid(price float64, quantity float64) {
 	}
 }
 
-func (a *Agent) onBookUpdateAsk(price float64, quantity float64) {
-	if quantity != 0 {
+func (a *Agent) onBookUpdateAsk(price exchange.Decimal, quantity exchange.Decimal) {
+	if !quantity.IsZero() {
 		a.Strategy.OnBookUpdateAsk(price, quantity)
 	} else {
 		// removed off order book
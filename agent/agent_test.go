@@ -2,6 +2,7 @@ package agent
 
 import (
 	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -62,8 +63,8 @@ func TestAgentStartSendsTradesToStrategy(t *testing.T) {
 	mockFeeder := mock_exchange.NewMockFeeder(ctrl)
 	tradeChan := make(chan exchange.Trade)
 
-	var expPrice float64 = 1.01
-	var expQuantity float64 = 100
+	var expPrice = exchange.MustParseDecimal("1.01")
+	var expQuantity = exchange.MustParseDecimal("100")
 	expTradeID := "12345"
 	expBuyerOrderID := "88"
 	expSellerOrderID := "52"
@@ -110,8 +111,8 @@ func TestAgentStartSendsBookBidUpdatesToStrategy(t *testing.T) {
 	mockFeeder := mock_exchange.NewMockFeeder(ctrl)
 	bookUpdateChan := make(chan exchange.BookUpdate)
 
-	var expPrice float64 = 0.24
-	var expQuantity float64 = 10
+	var expPrice = exchange.MustParseDecimal("0.24")
+	var expQuantity = exchange.MustParseDecimal("10")
 
 	mockFeeder.EXPECT().
 		Trades().
@@ -157,8 +158,8 @@ func TestAgentStartSendsBookAskUpdatesToStrategy(t *testing.T) {
 	mockFeeder := mock_exchange.NewMockFeeder(ctrl)
 	bookUpdateChan := make(chan exchange.BookUpdate)
 
-	var expPrice float64 = 0.24
-	var expQuantity float64 = 10
+	var expPrice = exchange.MustParseDecimal("0.24")
+	var expQuantity = exchange.MustParseDecimal("10")
 
 	mockFeeder.EXPECT().
 		Trades().
@@ -204,10 +205,10 @@ func TestAgentStartDoesNotSendBidRemovalBookUpdatesToStrategy(t *testing.T) {
 	mockFeeder := mock_exchange.NewMockFeeder(ctrl)
 	bookUpdateChan := make(chan exchange.BookUpdate)
 
-	var expPrice float64 = 0.24
+	var expPrice = exchange.MustParseDecimal("0.24")
 
 	// quantity 0 indicates a removal
-	var expQuantity float64 = 0
+	var expQuantity = exchange.MustParseDecimal("0")
 
 	mockFeeder.EXPECT().
 		Trades().
@@ -249,10 +250,10 @@ func TestAgentStartDoesNotSendAskRemovalBookUpdatesToStrategy(t *testing.T) {
 	mockFeeder := mock_exchange.NewMockFeeder(ctrl)
 	bookUpdateChan := make(chan exchange.BookUpdate)
 
-	var expPrice float64 = 0.24
+	var expPrice = exchange.MustParseDecimal("0.24")
 
 	// quantity 0 indicates a removal
-	var expQuantity float64 = 0
+	var expQuantity = exchange.MustParseDecimal("0")
 
 	mockFeeder.EXPECT().
 		Trades().
@@ -285,3 +286,40 @@ func TestAgentStartDoesNotSendAskRemovalBookUpdatesToStrategy(t *testing.T) {
 	// Give time for mock to not be asserted in this case
 	time.Sleep(time.Duration(0.2 * float64(time.Second)))
 }
+
+func TestAgentStartRunsOnSyntheticMarket(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStrategy := mock_agent.NewMockMarketListener(ctrl)
+
+	opts := *exchange.DefaultSyntheticOptions
+	opts.Duration = 10 * time.Second
+	feed, err := exchange.NewSyntheticFeeder("BNBBTC", &opts)
+	assert.NoError(t, err)
+
+	var trades, bids, asks int32
+	mockStrategy.EXPECT().
+		OnTrade(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Do(func(...interface{}) { atomic.AddInt32(&trades, 1) }).
+		AnyTimes()
+	mockStrategy.EXPECT().
+		OnBookUpdateBid(gomock.Any(), gomock.Any(), gomock.Any()).
+		Do(func(...interface{}) { atomic.AddInt32(&bids, 1) }).
+		AnyTimes()
+	mockStrategy.EXPECT().
+		OnBookUpdateAsk(gomock.Any(), gomock.Any(), gomock.Any()).
+		Do(func(...interface{}) { atomic.AddInt32(&asks, 1) }).
+		AnyTimes()
+
+	a := Agent{feed, mockStrategy}
+	err = a.Start()
+
+	// Give time for the last updates to reach the strategy
+	time.Sleep(time.Duration(0.2 * float64(time.Second)))
+
+	assert.NoError(t, err)
+	assert.True(t, atomic.LoadInt32(&trades) > 0)
+	assert.True(t, atomic.LoadInt32(&bids) > 0)
+	assert.True(t, atomic.LoadInt32(&asks) > 0)
+}
@@ -0,0 +1,83 @@
+package exchange
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Taken from https://binance-docs.github.io/apidocs/spot/en/#aggregate-trade-streams
+// {
+//   "e": "aggTrade",  // Event type
+//   "E": 123456789,   // Event time
+//   "s": "BNBBTC",    // Symbol
+//   "a": 12345,       // Aggregate trade ID
+//   "p": "0.001",     // Price
+//   "q": "100",       // Quantity
+//   "f": 100,         // First trade ID
+//   "l": 105,         // Last trade ID
+//   "T": 123456785,   // Trade time
+//   "m": true,        // Is the buyer the market maker?
+//   "M": true         // Ignore
+// }
+
+// AggTrade contains information about trades that filled at the same time,
+// from the same taker order and at the same price. ReceivedAt and Raw are as for Trade.
+type AggTrade struct {
+	// Have to include json:"e" & json:"M" even though not wanted as encoding/json Unmarshal() has a bug with case-sensitivity on named parameters
+	// Issue discussed here: https://github.com/golang/go/issues/14750
+	// Watching proposed change to package here: https://go-review.googlesource.com/c/go/+/224079/
+	Type   string `json:"e"` // Will always be "aggTrade"
+	Ignore bool   `json:"M"`
+
+	ID           int     `json:"a"`
+	Symbol       string  `json:"s"`
+	FirstTradeID int     `json:"f"`
+	LastTradeID  int     `json:"l"`
+	TradeTime    int     `json:"T"`
+	EventTime    int     `json:"E"`
+	Price        Decimal `json:"p"`
+	Quantity     Decimal `json:"q"`
+	IsBuyerMaker bool    `json:"m"`
+
+	ReceivedAt time.Time       `json:"-"`
+	Raw        json.RawMessage `json:"-"`
+}
+
+// AggressorSide returns the side of the taker's order, Bid if a buy order took
+// liquidity and Ask if a sell order did
+func (at AggTrade) AggressorSide() string {
+	return aggressorSide(at.IsBuyerMaker)
+}
+
+// EventTimestamp returns the aggregate trade's event time
+func (at AggTrade) EventTimestamp() time.Time {
+	return msTime(at.EventTime)
+}
+
+// TradeTimestamp returns the time the trades were made
+func (at AggTrade) TradeTimestamp() time.Time {
+	return msTime(at.TradeTime)
+}
+
+// AggTrades returns a read-only channel of aggregated trades made on the market
+func (bf *binanceFeeder) AggTrades() (<-chan AggTrade, error) {
+	mChan, err := bf.listen("aggTrade")
+
+	atChan := make(chan AggTrade)
+	bf.lc.goroutine(func() {
+		defer close(atChan)
+		bf.read(mChan, "aggTrade", "aggregate trade", func(message []byte, r receipt) (streamEvent, error) {
+			at := AggTrade{ReceivedAt: r.at, Raw: r.raw}
+			err := json.Unmarshal(message, &at)
+			return streamEvent{event: at, seqNo: at.ID, eventTime: at.EventTime}, err
+		}, func(e interface{}) bool {
+			select {
+			case atChan <- e.(AggTrade):
+				return true
+			case <-bf.lc.done():
+				return false
+			}
+		})
+	})
+	return atChan, err
+}
@@ -0,0 +1,106 @@
+package exchange
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const aggTradesURL = "/ws/test@aggTrade"
+
+var (
+	rawAggTrade = `{
+		"e": "aggTrade",
+		"E": 123456789,
+		"s": "BNBBTC",
+		"a": 12345,
+		"p": "0.001",
+		"q": "100",
+		"f": 100,
+		"l": 105,
+		"T": 123456785,
+		"m": false,
+		"M": true
+	}`
+
+	expectedAggTrade = AggTrade{
+		Type:         "aggTrade",
+		Ignore:       true,
+		ID:           12345,
+		Symbol:       "BNBBTC",
+		FirstTradeID: 100,
+		LastTradeID:  105,
+		TradeTime:    123456785,
+		EventTime:    123456789,
+		Price:        MustParseDecimal("0.001"),
+		Quantity:     MustParseDecimal("100"),
+		IsBuyerMaker: false,
+	}
+)
+
+func TestBinanceFeederImplementsAggTradeFeederInterface(t *testing.T) {
+	assert.Implements(t, (*AggTradeFeeder)(nil), &binanceFeeder{}, "Does not implement interface")
+}
+
+func TestBinanceFeederAggTradesReturnsWorkingChannelThatReceivesAggTrades(t *testing.T) {
+	//arrange
+	mc := make(chan string, 2)
+	defer close(mc)
+
+	ws := newTestServer(aggTradesURL, mc)
+	defer ws.Close()
+
+	mc <- rawAggTrade
+
+	bf := newTestBinanceFeeder(ws, 0)
+
+	//act
+	atc, err := bf.AggTrades()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedAggTrade, eventWithoutReceipt(<-atc))
+}
+
+func TestBinanceFeederAggTradesSkipsAndLogsOnUnmarshalError(t *testing.T) {
+	//arrange
+	logBuffer.Reset()
+
+	mc := make(chan string, 3)
+	defer close(mc)
+
+	ws := newTestServer(aggTradesURL, mc)
+	defer ws.Close()
+
+	mc <- `{"e": "aggTrade", "a": "ID"}`
+	mc <- rawAggTrade
+
+	bf := newTestBinanceFeeder(ws, 0)
+
+	//act
+	atc, err := bf.AggTrades()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedAggTrade, eventWithoutReceipt(<-atc))
+	assertContainsErrorLog(t, logBuffer.Contents(), "error unmarshalling aggregate trade")
+}
+
+func TestBinanceFeederAggTradesClosesChannelAfterMaxRetries(t *testing.T) {
+	//arrange
+	mc := make(chan string, 2)
+
+	ws := newTestServer(aggTradesURL, mc)
+	defer ws.Close()
+
+	bf := newTestBinanceFeeder(ws, 0)
+
+	//act
+	atc, err := bf.AggTrades()
+	close(mc)
+
+	//assert
+	assert.NoError(t, err)
+	_, ok := <-atc
+	assert.False(t, ok)
+}
@@ -0,0 +1,120 @@
+package exchange
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Taken from https://binance-docs.github.io/apidocs/spot/en/#individual-symbol-book-ticker-streams
+// {
+//   "u":400900217,     // order book updateId
+//   "s":"BNBUSDT",     // symbol
+//   "b":"25.35190000", // best bid price
+//   "B":"31.21000000", // best bid qty
+//   "a":"25.36520000", // best ask price
+//   "A":"40.66000000"  // best ask qty
+// }
+
+// BookTicker contains the best bid and ask in the order book. ReceivedAt and Raw
+// are as for Trade.
+type BookTicker struct {
+	UpdateID    int     `json:"u"`
+	Symbol      string  `json:"s"`
+	BidPrice    Decimal `json:"b"`
+	BidQuantity Decimal `json:"B"`
+	AskPrice    Decimal `json:"a"`
+	AskQuantity Decimal `json:"A"`
+
+	ReceivedAt time.Time       `json:"-"`
+	Raw        json.RawMessage `json:"-"`
+}
+
+// BookTicker returns a read-only channel of updates to the best bid & ask in the market
+func (bf *binanceFeeder) BookTicker() (<-chan BookTicker, error) {
+	mChan, err := bf.listen("bookTicker")
+
+	btChan := make(chan BookTicker)
+	bf.lc.goroutine(func() {
+		defer close(btChan)
+		bf.read(mChan, "bookTicker", "book ticker", func(message []byte, r receipt) (streamEvent, error) {
+			bt := BookTicker{ReceivedAt: r.at, Raw: r.raw}
+			err := json.Unmarshal(message, &bt)
+			return streamEvent{event: bt, seqNo: bt.UpdateID}, err
+		}, func(e interface{}) bool {
+			select {
+			case btChan <- e.(BookTicker):
+				return true
+			case <-bf.lc.done():
+				return false
+			}
+		})
+	})
+	return btChan, err
+}
+
+// TopOfBook caches the latest best bid & ask of a market so that it can be
+// queried synchronously, for example by a MarketExchange. It is safe for
+// concurrent use.
+type TopOfBook struct {
+	mu     sync.RWMutex
+	latest BookTicker
+	set    bool
+}
+
+// NewTopOfBook returns an empty TopOfBook
+func NewTopOfBook() *TopOfBook {
+	return &TopOfBook{}
+}
+
+// Follow subscribes to the feed's book ticker and keeps the cache updated in the background
+func (tb *TopOfBook) Follow(feed BookTickerFeeder) error {
+	btChan, err := feed.BookTicker()
+	if err != nil {
+		log.Error().Err(err).
+			Msg("error on reading book ticker")
+		return err
+	}
+
+	go func() {
+		for bt := range btChan {
+			tb.Update(bt)
+		}
+	}()
+	return nil
+}
+
+// Update caches the book ticker, unless it is older than the one already cached
+func (tb *TopOfBook) Update(bt BookTicker) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if tb.set && bt.UpdateID < tb.latest.UpdateID {
+		return
+	}
+	tb.latest = bt
+	tb.set = true
+}
+
+// Latest returns the most recent book ticker, or false if there has not been one yet
+func (tb *TopOfBook) Latest() (BookTicker, bool) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	return tb.latest, tb.set
+}
+
+// GetBestBid returns the highest bid price, or 0 if unknown
+func (tb *TopOfBook) GetBestBid() Decimal {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	return tb.latest.BidPrice
+}
+
+// GetBestAsk returns the lowest ask price, or 0 if unknown
+func (tb *TopOfBook) GetBestAsk() Decimal {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	return tb.latest.AskPrice
+}
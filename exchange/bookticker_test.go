@@ -0,0 +1,146 @@
+package exchange
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const bookTickerURL = "/ws/test@bookTicker"
+
+var (
+	rawBookTicker = `{
+		"u": 400900217,
+		"s": "BNBUSDT",
+		"b": "25.35190000",
+		"B": "31.21000000",
+		"a": "25.36520000",
+		"A": "40.66000000"
+	}`
+
+	expectedBookTicker = BookTicker{
+		UpdateID:    400900217,
+		Symbol:      "BNBUSDT",
+		BidPrice:    MustParseDecimal("25.3519"),
+		BidQuantity: MustParseDecimal("31.21"),
+		AskPrice:    MustParseDecimal("25.3652"),
+		AskQuantity: MustParseDecimal("40.66"),
+	}
+)
+
+func TestBinanceFeederImplementsBookTickerFeederInterface(t *testing.T) {
+	assert.Implements(t, (*BookTickerFeeder)(nil), &binanceFeeder{}, "Does not implement interface")
+}
+
+func TestBinanceFeederBookTickerReturnsWorkingChannelThatReceivesBookTickers(t *testing.T) {
+	//arrange
+	mc := make(chan string, 2)
+	defer close(mc)
+
+	ws := newTestServer(bookTickerURL, mc)
+	defer ws.Close()
+
+	mc <- rawBookTicker
+
+	bf := newTestBinanceFeeder(ws, 0)
+
+	//act
+	btc, err := bf.BookTicker()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedBookTicker, eventWithoutReceipt(<-btc))
+}
+
+func TestBinanceFeederBookTickerSkipsAndLogsOnUnmarshalError(t *testing.T) {
+	//arrange
+	logBuffer.Reset()
+
+	mc := make(chan string, 3)
+	defer close(mc)
+
+	ws := newTestServer(bookTickerURL, mc)
+	defer ws.Close()
+
+	mc <- `{"u": 400900217, "b": "twenty five"}`
+	mc <- rawBookTicker
+
+	bf := newTestBinanceFeeder(ws, 0)
+
+	//act
+	btc, err := bf.BookTicker()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedBookTicker, eventWithoutReceipt(<-btc))
+	assertContainsErrorLog(t, logBuffer.Contents(), "error unmarshalling book ticker")
+}
+
+func TestTopOfBookIsEmptyBeforeFirstUpdate(t *testing.T) {
+	tb := NewTopOfBook()
+
+	_, ok := tb.Latest()
+
+	assert.False(t, ok)
+	assert.Equal(t, Decimal{}, tb.GetBestBid())
+	assert.Equal(t, Decimal{}, tb.GetBestAsk())
+}
+
+func TestTopOfBookIgnoresOlderUpdates(t *testing.T) {
+	tb := NewTopOfBook()
+
+	tb.Update(BookTicker{UpdateID: 2, BidPrice: MustParseDecimal("1.1"), AskPrice: MustParseDecimal("1.2")})
+	tb.Update(BookTicker{UpdateID: 1, BidPrice: MustParseDecimal("1.0"), AskPrice: MustParseDecimal("1.3")})
+
+	latest, ok := tb.Latest()
+	assert.True(t, ok)
+	assert.Equal(t, 2, latest.UpdateID)
+	assert.Equal(t, MustParseDecimal("1.1"), tb.GetBestBid())
+	assert.Equal(t, MustParseDecimal("1.2"), tb.GetBestAsk())
+}
+
+type stubBookTickerFeeder chan BookTicker
+
+func (sf stubBookTickerFeeder) BookTicker() (<-chan BookTicker, error) {
+	return sf, nil
+}
+
+func TestTopOfBookFollowUpdatesFromFeed(t *testing.T) {
+	//arrange
+	feed := make(stubBookTickerFeeder, 1)
+	tb := NewTopOfBook()
+
+	//act
+	err := tb.Follow(feed)
+	feed <- expectedBookTicker
+
+	//assert
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		latest, _ := tb.Latest()
+		return assert.ObjectsAreEqual(expectedBookTicker, latest)
+	}, time.Second, 10*time.Millisecond)
+	close(feed)
+}
+
+func TestTopOfBookIsSafeForConcurrentUse(t *testing.T) {
+	tb := NewTopOfBook()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			tb.Update(BookTicker{UpdateID: i, BidPrice: NewDecimalFromInt(int64(i))})
+		}(i)
+		go func() {
+			defer wg.Done()
+			tb.GetBestBid()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, NewDecimalFromInt(9), tb.GetBestBid())
+}
@@ -0,0 +1,292 @@
+package exchange
+
+import "sync"
+
+// OverflowPolicy decides what happens to events sent to a full buffer
+type OverflowPolicy int
+
+const (
+	// Block waits for the consumer to make room, holding up the producer
+	Block OverflowPolicy = iota
+	// DropOldest discards the longest waiting event to make room for the new one
+	DropOldest
+	// DropNewest discards the new event, keeping those already waiting
+	DropNewest
+	// Disconnect discards every waiting event and closes the consumer's channel
+	Disconnect
+	// Conflate merges every waiting book update and the new one into a single update
+	// holding the latest quantity of each price level. Streams whose events can't be
+	// merged, such as trades, drop the oldest event instead.
+	Conflate
+)
+
+// BufferOptions configures a feed's buffering of events between receiving and
+// sending them on its channels. Policy decides what happens when the consumer
+// falls Size events behind. Feeds without buffer options send events unbuffered,
+// holding up their connection until each event is received.
+type BufferOptions struct {
+	Size   int
+	Policy OverflowPolicy
+}
+
+var DefaultBufferOptions = &BufferOptions{
+	Size:   1000,
+	Policy: Conflate,
+}
+
+// BufferStats counts the events a buffer's overflow policy has discarded
+type BufferStats struct {
+	Dropped uint64 // events discarded by the DropOldest, DropNewest or Disconnect policies
+	Merged  uint64 // events merged into a later event by the Conflate policy
+}
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropOldest:
+		return "drop-oldest"
+	case DropNewest:
+		return "drop-newest"
+	case Disconnect:
+		return "disconnect"
+	case Conflate:
+		return "conflate"
+	}
+	return "unknown"
+}
+
+// eventBuffer is a bounded queue of events between one producer and one consumer
+type eventBuffer struct {
+	size   int
+	policy OverflowPolicy
+	merge  func(older interface{}, newer interface{}) interface{} // nil if events can't be merged
+
+	mu     sync.Mutex
+	events []interface{}
+	closed bool
+	stats  BufferStats
+	ready  chan struct{} // signalled when events are added or the buffer closed
+	space  chan struct{} // signalled when events are removed or the buffer closed
+}
+
+func newEventBuffer(size int, policy OverflowPolicy) *eventBuffer {
+	if size < 1 {
+		size = 1
+	}
+	return &eventBuffer{
+		size:   size,
+		policy: policy,
+		ready:  make(chan struct{}, 1),
+		space:  make(chan struct{}, 1),
+	}
+}
+
+// push adds an event to the buffer, applying the overflow policy if it's full.
+// It returns false if the buffer is closed, was closed by the Disconnect policy,
+// or done was closed while blocked.
+func (b *eventBuffer) push(e interface{}, done <-chan struct{}) bool {
+	for {
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return false
+		}
+
+		if len(b.events) < b.size {
+			b.events = append(b.events, e)
+			b.mu.Unlock()
+			signal(b.ready)
+			return true
+		}
+
+		switch {
+		case b.policy == Conflate && b.merge != nil:
+			merged := b.events[0]
+			for _, waiting := range b.events[1:] {
+				merged = b.merge(merged, waiting)
+			}
+			b.stats.Merged += uint64(len(b.events))
+			b.events = append(b.events[:0], b.merge(merged, e))
+			b.mu.Unlock()
+			return true
+		case b.policy == DropOldest || b.policy == Conflate:
+			b.events[0] = nil
+			b.events = append(b.events[1:], e)
+			b.stats.Dropped++
+			b.mu.Unlock()
+			return true
+		case b.policy == DropNewest:
+			b.stats.Dropped++
+			b.mu.Unlock()
+			return true
+		case b.policy == Disconnect:
+			b.stats.Dropped += uint64(len(b.events)) + 1
+			b.events = nil
+			b.closed = true
+			b.mu.Unlock()
+			signal(b.ready)
+			return false
+		}
+		b.mu.Unlock()
+
+		select {
+		case <-b.space:
+		case <-done:
+			return false
+		}
+	}
+}
+
+// pop removes the longest waiting event, waiting for one if the buffer is empty.
+// It returns false once the buffer is closed and empty, or done is closed.
+func (b *eventBuffer) pop(done <-chan struct{}) (interface{}, bool) {
+	for {
+		b.mu.Lock()
+		if len(b.events) > 0 {
+			e := b.events[0]
+			b.events[0] = nil
+			b.events = b.events[1:]
+			b.mu.Unlock()
+			signal(b.space)
+			return e, true
+		}
+		if b.closed {
+			b.mu.Unlock()
+			return nil, false
+		}
+		b.mu.Unlock()
+
+		select {
+		case <-b.ready:
+		case <-done:
+			return nil, false
+		}
+	}
+}
+
+// forward pops the buffer's events and sends them with send until the buffer is
+// closed and empty, done is closed, or send returns false
+func (b *eventBuffer) forward(done <-chan struct{}, send func(e interface{}) bool) {
+	for {
+		e, ok := b.pop(done)
+		if !ok || !send(e) {
+			return
+		}
+	}
+}
+
+// len returns the number of events waiting in the buffer
+func (b *eventBuffer) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.events)
+}
+
+// counts returns the events discarded by the buffer's overflow policy so far
+func (b *eventBuffer) counts() BufferStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// close stops the buffer accepting events. Events already waiting can still be popped.
+func (b *eventBuffer) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+
+	signal(b.ready)
+	signal(b.space)
+}
+
+// signal wakes whoever waits on the channel, if they aren't already due to wake
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// mergeBookUpdates merges two consecutive book updates into one, holding the
+// latest quantity of each price level changed by either
+func mergeBookUpdates(older interface{}, newer interface{}) interface{} {
+	o, n := older.(BookUpdate), newer.(BookUpdate)
+
+	bids := make(map[Decimal]Decimal, len(o.Bids)+len(n.Bids))
+	asks := make(map[Decimal]Decimal, len(o.Asks)+len(n.Asks))
+	for _, updates := range []BookUpdate{o, n} {
+		for _, bid := range updates.Bids {
+			bids[bid.Price] = bid.Quantity
+		}
+		for _, ask := range updates.Asks {
+			asks[ask.Price] = ask.Quantity
+		}
+	}
+
+	n.FirstUpdateID = o.FirstUpdateID
+	n.Raw = nil
+	n.Bids = sortedChanges(bids, Decimal.GreaterThan)
+	n.Asks = sortedChanges(asks, Decimal.LessThan)
+	return n
+}
+
+// eventPipe sends a stream's events to its consumer, through a buffer if the
+// feed has buffer options
+type eventPipe struct {
+	lc     *lifecycle
+	buffer *eventBuffer
+	send   func(e interface{}) bool
+	closer func()
+}
+
+// newEventPipe returns a pipe of events given to send, calling closer once
+// no more events will be sent
+func newEventPipe(lc *lifecycle, opts *BufferOptions, merge func(interface{}, interface{}) interface{},
+	send func(e interface{}) bool, closer func()) *eventPipe {
+	p := &eventPipe{lc: lc, send: send, closer: closer}
+	if opts == nil {
+		return p
+	}
+
+	p.buffer = newEventBuffer(opts.Size, opts.Policy)
+	p.buffer.merge = merge
+	lc.goroutine(func() {
+		defer closer()
+		p.buffer.forward(lc.done(), send)
+	})
+	return p
+}
+
+// push sends an event, returning false if no more events can be sent
+func (p *eventPipe) push(e interface{}) bool {
+	if p.buffer == nil {
+		return p.send(e)
+	}
+	return p.buffer.push(e, p.lc.done())
+}
+
+// close is called once no more events will be pushed. Buffered events are still sent.
+func (p *eventPipe) close() {
+	if p.buffer == nil {
+		p.closer()
+		return
+	}
+	p.buffer.close()
+}
+
+// counts returns the events discarded by the pipe's buffer so far
+func (p *eventPipe) counts() BufferStats {
+	if p.buffer == nil {
+		return BufferStats{}
+	}
+	return p.buffer.counts()
+}
+
+// backlog returns the number of events waiting in the pipe's buffer
+func (p *eventPipe) backlog() int {
+	if p.buffer == nil {
+		return 0
+	}
+	return p.buffer.len()
+}
@@ -0,0 +1,247 @@
+package exchange
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// poppedEvents pops every event waiting in a closed buffer
+func poppedEvents(b *eventBuffer) []interface{} {
+	var events []interface{}
+	for {
+		e, ok := b.pop(nil)
+		if !ok {
+			return events
+		}
+		events = append(events, e)
+	}
+}
+
+func TestEventBufferDropOldestKeepsNewestEvents(t *testing.T) {
+	b := newEventBuffer(2, DropOldest)
+
+	for i := 1; i <= 4; i++ {
+		assert.True(t, b.push(i, nil))
+	}
+	b.close()
+
+	assert.Equal(t, []interface{}{3, 4}, poppedEvents(b))
+	assert.Equal(t, BufferStats{Dropped: 2}, b.counts())
+}
+
+func TestEventBufferDropNewestKeepsOldestEvents(t *testing.T) {
+	b := newEventBuffer(2, DropNewest)
+
+	for i := 1; i <= 4; i++ {
+		assert.True(t, b.push(i, nil))
+	}
+	b.close()
+
+	assert.Equal(t, []interface{}{1, 2}, poppedEvents(b))
+	assert.Equal(t, BufferStats{Dropped: 2}, b.counts())
+}
+
+func TestEventBufferDisconnectDiscardsEventsAndCloses(t *testing.T) {
+	b := newEventBuffer(2, Disconnect)
+
+	assert.True(t, b.push(1, nil))
+	assert.True(t, b.push(2, nil))
+	assert.False(t, b.push(3, nil))
+	assert.False(t, b.push(4, nil))
+
+	assert.Empty(t, poppedEvents(b))
+	assert.Equal(t, BufferStats{Dropped: 3}, b.counts())
+}
+
+func TestEventBufferBlockWaitsForSpace(t *testing.T) {
+	//arrange
+	b := newEventBuffer(1, Block)
+	assert.True(t, b.push(1, nil))
+
+	//act
+	pushed := make(chan bool)
+	go func() {
+		pushed <- b.push(2, nil)
+	}()
+
+	//assert
+	select {
+	case <-pushed:
+		assert.Fail(t, "push did not block on a full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	e, _ := b.pop(nil)
+	assert.Equal(t, 1, e)
+	assert.True(t, <-pushed)
+	e, _ = b.pop(nil)
+	assert.Equal(t, 2, e)
+}
+
+func TestEventBufferBlockedPushReturnsWhenDoneOrClosed(t *testing.T) {
+	b := newEventBuffer(1, Block)
+	b.push(1, nil)
+
+	done := make(chan struct{})
+	close(done)
+	assert.False(t, b.push(2, done))
+
+	go b.close()
+	assert.False(t, b.push(2, nil))
+}
+
+func TestEventBufferPopWaitsForEvents(t *testing.T) {
+	b := newEventBuffer(1, Block)
+
+	go b.push(1, nil)
+	e, ok := b.pop(nil)
+	assert.True(t, ok)
+	assert.Equal(t, 1, e)
+
+	done := make(chan struct{})
+	close(done)
+	_, ok = b.pop(done)
+	assert.False(t, ok)
+}
+
+func TestEventBufferConflateMergesWaitingBookUpdates(t *testing.T) {
+	//arrange
+	b := newEventBuffer(2, Conflate)
+	b.merge = mergeBookUpdates
+
+	//act
+	b.push(BookUpdate{
+		FirstUpdateID: 1, LastUpdateID: 2, EventTime: 100,
+		Bids: []BookEntry{{Price: MustParseDecimal("1.1"), Quantity: MustParseDecimal("5")}},
+	}, nil)
+	b.push(BookUpdate{
+		FirstUpdateID: 3, LastUpdateID: 3, EventTime: 200,
+		Bids: []BookEntry{{Price: MustParseDecimal("1.2"), Quantity: MustParseDecimal("1")}},
+		Asks: []BookEntry{{Price: MustParseDecimal("1.3"), Quantity: MustParseDecimal("2")}},
+	}, nil)
+	b.push(BookUpdate{
+		FirstUpdateID: 4, LastUpdateID: 6, EventTime: 300,
+		Bids: []BookEntry{{Price: MustParseDecimal("1.1"), Quantity: MustParseDecimal("0")}},
+		Asks: []BookEntry{{Price: MustParseDecimal("1.4"), Quantity: MustParseDecimal("3")}},
+	}, nil)
+	b.close()
+
+	//assert
+	assert.Equal(t, []interface{}{BookUpdate{
+		FirstUpdateID: 1, LastUpdateID: 6, EventTime: 300,
+		Bids: []BookEntry{
+			{Price: MustParseDecimal("1.2"), Quantity: MustParseDecimal("1")},
+			{Price: MustParseDecimal("1.1"), Quantity: MustParseDecimal("0")},
+		},
+		Asks: []BookEntry{
+			{Price: MustParseDecimal("1.3"), Quantity: MustParseDecimal("2")},
+			{Price: MustParseDecimal("1.4"), Quantity: MustParseDecimal("3")},
+		},
+	}}, poppedEvents(b))
+	assert.Equal(t, BufferStats{Merged: 2}, b.counts())
+}
+
+func TestEventBufferConflateDropsOldestEventsThatCannotBeMerged(t *testing.T) {
+	b := newEventBuffer(2, Conflate)
+
+	for i := 1; i <= 3; i++ {
+		assert.True(t, b.push(i, nil))
+	}
+	b.close()
+
+	assert.Equal(t, []interface{}{2, 3}, poppedEvents(b))
+	assert.Equal(t, BufferStats{Dropped: 1}, b.counts())
+}
+
+func newTestBufferedBinanceFeeder(ws *testServer, opts *BufferOptions) *binanceFeeder {
+	testDialer := websocket.DefaultDialer
+	testDialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+	bf := &binanceFeeder{
+		baseURL:       strings.TrimPrefix(ws.URL, "wss://"),
+		socketOptions: &SocketConnectionOptions{Dialer: testDialer},
+		symbol:        testSymbol,
+	}
+	bf.SetBufferOptions(opts)
+	return bf
+}
+
+func TestBinanceFeederBookUpdatesConflatesForSlowConsumer(t *testing.T) {
+	//arrange
+	mc := make(chan string, 10)
+	ws := newTestServer(depthURL, mc)
+	defer ws.Close()
+	for i := 1; i <= 5; i++ {
+		mc <- bookUpdateWithIDs(i, i)
+	}
+	close(mc)
+
+	bf := newTestBufferedBinanceFeeder(ws, &BufferOptions{Size: 1, Policy: Conflate})
+	defer bf.Close()
+
+	//act
+	buChan, err := bf.BookUpdates()
+	assert.NoError(t, err)
+
+	// the consumer doesn't read until every update has been buffered
+	assert.Eventually(t, func() bool {
+		return bf.BookUpdateBufferStats().Merged > 0
+	}, time.Second, 10*time.Millisecond)
+
+	//assert the updates received still follow on from each other
+	var gd gapDetector
+	var received []BookUpdate
+	for len(received) == 0 || received[len(received)-1].LastUpdateID < 5 {
+		b := <-buChan
+		_, gap := gd.check(b)
+		assert.False(t, gap)
+		received = append(received, b)
+	}
+	assert.Equal(t, 1, received[0].FirstUpdateID)
+	assert.True(t, len(received) < 5, len(received))
+	assert.Equal(t, uint64(5-len(received)), bf.BookUpdateBufferStats().Merged)
+}
+
+func TestBinanceFeederTradesDropsForSlowConsumer(t *testing.T) {
+	//arrange
+	mc := make(chan string, 10)
+	ws := newTestServer(tradesURL, mc)
+	defer ws.Close()
+	for i := 1; i <= 5; i++ {
+		mc <- tradeWithID(i)
+	}
+	close(mc)
+
+	bf := newTestBufferedBinanceFeeder(ws, &BufferOptions{Size: 1, Policy: DropNewest})
+	defer bf.Close()
+
+	//act
+	tc, err := bf.Trades()
+	assert.NoError(t, err)
+
+	//assert
+	assert.Eventually(t, func() bool {
+		return bf.TradeBufferStats().Dropped >= 3
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, (<-tc).ID)
+	assert.Equal(t, BufferStats{}, bf.BookUpdateBufferStats())
+}
+
+func TestMergeBookUpdatesDropsRawPayloads(t *testing.T) {
+	//arrange
+	older := BookUpdate{FirstUpdateID: 1, LastUpdateID: 2, Raw: []byte(`{"U":1,"u":2}`)}
+	newer := BookUpdate{FirstUpdateID: 3, LastUpdateID: 4, Raw: []byte(`{"U":3,"u":4}`)}
+
+	//act
+	merged := mergeBookUpdates(older, newer).(BookUpdate)
+
+	//assert
+	assert.Nil(t, merged.Raw)
+	assert.Equal(t, 1, merged.FirstUpdateID)
+	assert.Equal(t, 4, merged.LastUpdateID)
+}
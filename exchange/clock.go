@@ -0,0 +1,216 @@
+package exchange
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultClockSyncInterval is how often the server time is sampled
+	DefaultClockSyncInterval = time.Minute
+	// DefaultClockSamples is how many of the latest samples the offset is estimated from
+	DefaultClockSamples = 8
+
+	serverTimePath        = "/api/v3/time"
+	futuresServerTimePath = "/fapi/v1/time"
+)
+
+var errClockSyncClosed = errors.New("clock sync closed")
+
+// Clock tells the time. ClockSync is a Clock of Binance's time, which can be
+// shared by feeds, exchanges and strategies so that they agree with the server.
+type Clock interface {
+	Now() time.Time
+}
+
+// timeOf returns the clock's time, or the local time if there is no clock
+func timeOf(clock Clock) time.Time {
+	if clock == nil {
+		return time.Now()
+	}
+	return clock.Now()
+}
+
+// Taken from https://binance-docs.github.io/apidocs/spot/en/#check-server-time
+// {
+//   "serverTime": 1499827319559
+// }
+
+type serverTime struct {
+	ServerTime int `json:"serverTime"`
+}
+
+// clockSample is a single measurement of the server time. Offset is how far the
+// server's clock is ahead of the local clock, assuming the request took as long
+// to reach the server as the response took to come back.
+type clockSample struct {
+	offset time.Duration
+	rtt    time.Duration
+}
+
+// ClockSync estimates the offset of the local clock from Binance's server time
+// by periodically sampling it. As NTP does, the offset is taken from the sample
+// with the shortest round trip of the latest samples, as that with the least
+// room for delays on one leg of the trip to skew it. Until the first sample is
+// taken the offset is zero.
+type ClockSync struct {
+	rest     *restClient
+	path     string
+	interval time.Duration
+	samples  int
+	now      func() time.Time
+
+	startMu sync.Mutex
+	started bool
+	lc      lifecycle
+
+	mu     sync.RWMutex
+	window []clockSample
+	best   clockSample
+	synced bool
+}
+
+// NewClockSync returns a ClockSync of the Production environment's server time
+func NewClockSync() *ClockSync {
+	return &ClockSync{
+		rest:     newRESTClient(Production.RESTURL),
+		path:     serverTimePath,
+		interval: DefaultClockSyncInterval,
+		samples:  DefaultClockSamples,
+		now:      time.Now,
+	}
+}
+
+// SetEnvironment sets which environment's server time is sampled
+func (c *ClockSync) SetEnvironment(env Environment) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rest = newRESTClient(env.RESTURL)
+	c.path = env.ServerTimePath
+	if c.path == "" {
+		c.path = serverTimePath
+	}
+}
+
+// SetInterval sets how often the server time is sampled once started
+func (c *ClockSync) SetInterval(interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interval = interval
+}
+
+// Start samples the server time, returning an error if it can't, then carries
+// on sampling it in the background every interval until closed. Starting it
+// again once started does nothing, and once closed returns an error.
+func (c *ClockSync) Start() error {
+	c.startMu.Lock()
+	defer c.startMu.Unlock()
+
+	if c.lc.closed() {
+		return errClockSyncClosed
+	}
+	if c.started {
+		return nil
+	}
+	if err := c.Sync(); err != nil {
+		return err
+	}
+
+	c.started = true
+	c.lc.goroutine(func() {
+		for c.lc.sleep(c.getInterval()) {
+			if err := c.Sync(); err != nil {
+				log.Warn().Err(err).Msg("error syncing clock with server time")
+			}
+		}
+	})
+	return nil
+}
+
+func (c *ClockSync) getInterval() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.interval
+}
+
+// Sync samples the server time now, updating the estimated offset
+func (c *ClockSync) Sync() error {
+	c.mu.RLock()
+	rest, path := c.rest, c.path
+	c.mu.RUnlock()
+
+	sent := c.now()
+	var st serverTime
+	if err := rest.get(path, nil, &st); err != nil {
+		return err
+	}
+	received := c.now()
+
+	rtt := received.Sub(sent)
+	midpoint := sent.Add(rtt / 2)
+	c.add(clockSample{offset: msTime(st.ServerTime).Sub(midpoint), rtt: rtt})
+	return nil
+}
+
+func (c *ClockSync) add(s clockSample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.window = append(c.window, s)
+	if len(c.window) > c.samples {
+		c.window = c.window[len(c.window)-c.samples:]
+	}
+
+	sorted := append([]clockSample(nil), c.window...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].rtt < sorted[j].rtt
+	})
+	c.best = sorted[0]
+	c.synced = true
+}
+
+// Offset returns how far Binance's clock is estimated to be ahead of the local clock
+func (c *ClockSync) Offset() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.best.offset
+}
+
+// RTT returns the round trip time of the sample the offset was estimated from
+func (c *ClockSync) RTT() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.best.rtt
+}
+
+// Synced reports whether the server time has been sampled yet
+func (c *ClockSync) Synced() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.synced
+}
+
+// Now returns the local time adjusted by the offset, an estimate of Binance's time
+func (c *ClockSync) Now() time.Time {
+	return c.now().Add(c.Offset())
+}
+
+// Timestamp returns Binance's estimated time in Unix milliseconds, as used by the
+// timestamp parameter of signed requests
+func (c *ClockSync) Timestamp() int {
+	return eventTime(c.Now())
+}
+
+// Close stops sampling the server time. The last estimate can still be used,
+// but it can't be started again.
+func (c *ClockSync) Close() error {
+	c.startMu.Lock()
+	defer c.startMu.Unlock()
+	c.lc.close()
+	return nil
+}
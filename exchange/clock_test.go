@@ -0,0 +1,244 @@
+package exchange
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func serverTimeResponse(ms int) string {
+	return fmt.Sprintf(`{"serverTime":%d}`, ms)
+}
+
+// newTestClockSync returns a ClockSync whose local clock reads each of the given
+// Unix millisecond times in turn, then the last of them
+func newTestClockSync(rc *restClient, times ...int) *ClockSync {
+	var mu sync.Mutex
+	i := 0
+
+	c := NewClockSync()
+	c.rest = rc
+	c.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+
+		t := msTime(times[i])
+		if i < len(times)-1 {
+			i++
+		}
+		return t
+	}
+	return c
+}
+
+func TestNewClockSyncDefaultsToProduction(t *testing.T) {
+	c := NewClockSync()
+
+	assert.Equal(t, "api.binance.com", c.rest.baseURL)
+	assert.Equal(t, "/api/v3/time", c.path)
+	assert.Equal(t, DefaultClockSyncInterval, c.interval)
+	assert.False(t, c.Synced())
+	assert.Zero(t, c.Offset())
+}
+
+func TestClockSyncSetEnvironmentUsesItsServerTimePath(t *testing.T) {
+	//arrange
+	c := NewClockSync()
+
+	//act
+	c.SetEnvironment(FuturesTestnet)
+
+	//assert
+	assert.Equal(t, "testnet.binancefuture.com", c.rest.baseURL)
+	assert.Equal(t, "/fapi/v1/time", c.path)
+
+	c.SetEnvironment(Testnet)
+	assert.Equal(t, "testnet.binance.vision", c.rest.baseURL)
+	assert.Equal(t, "/api/v3/time", c.path)
+
+	c.SetEnvironment(Environment{RESTURL: "futures.proxy.local", ServerTimePath: "/fapi/v1/time"})
+	assert.Equal(t, "futures.proxy.local", c.rest.baseURL)
+	assert.Equal(t, "/fapi/v1/time", c.path)
+}
+
+func TestClockSyncSyncEstimatesOffsetFromRoundTripMidpoint(t *testing.T) {
+	//arrange
+	server, rc := newTestRESTServer(serverTimePath, serverTimeResponse(2050))
+	defer server.Close()
+
+	c := newTestClockSync(rc, 1000, 1100, 1100)
+
+	//act
+	err := c.Sync()
+
+	//assert
+	assert.NoError(t, err)
+	assert.True(t, c.Synced())
+	assert.Equal(t, time.Second, c.Offset())
+	assert.Equal(t, 100*time.Millisecond, c.RTT())
+	assert.Equal(t, msTime(2100), c.Now())
+	assert.Equal(t, 2100, c.Timestamp())
+}
+
+func TestClockSyncUsesOffsetOfShortestRoundTripInWindow(t *testing.T) {
+	//arrange
+	server, rc := newTestRESTServer(serverTimePath,
+		serverTimeResponse(2050), // rtt 100ms, offset 1000ms
+		serverTimeResponse(2210), // rtt 20ms, offset 500ms
+		serverTimeResponse(3025), // rtt 50ms, offset 700ms
+		serverTimeResponse(4030), // rtt 60ms, offset 700ms
+	)
+	defer server.Close()
+
+	c := newTestClockSync(rc, 1000, 1100, 1700, 1720, 2300, 2350, 3300, 3360)
+	c.samples = 2
+
+	//act & assert
+	assert.NoError(t, c.Sync())
+	assert.Equal(t, 1000*time.Millisecond, c.Offset())
+
+	assert.NoError(t, c.Sync())
+	assert.Equal(t, 500*time.Millisecond, c.Offset())
+	assert.Equal(t, 20*time.Millisecond, c.RTT())
+
+	assert.NoError(t, c.Sync())
+	assert.Equal(t, 500*time.Millisecond, c.Offset())
+
+	assert.NoError(t, c.Sync())
+	assert.Equal(t, 700*time.Millisecond, c.Offset())
+	assert.Equal(t, 50*time.Millisecond, c.RTT())
+}
+
+func TestClockSyncSyncReturnsErrorAndKeepsEstimateOnFailure(t *testing.T) {
+	//arrange
+	server, rc := newTestRESTServer("/elsewhere", serverTimeResponse(0))
+	defer server.Close()
+
+	c := newTestClockSync(rc, 1000)
+
+	//act
+	err := c.Sync()
+
+	//assert
+	assert.Error(t, err)
+	assert.False(t, c.Synced())
+	assert.Zero(t, c.Offset())
+	assert.Equal(t, msTime(1000), c.Now())
+}
+
+func TestClockSyncStartSyncsPeriodicallyUntilClosed(t *testing.T) {
+	//arrange
+	server, rc := newTestRESTServer(serverTimePath, serverTimeResponse(eventTime(time.Now().Add(time.Hour))))
+	defer server.Close()
+
+	c := NewClockSync()
+	c.rest = rc
+	c.SetInterval(10 * time.Millisecond)
+
+	var mu sync.Mutex
+	calls := 0
+	c.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return time.Now()
+	}
+
+	//act
+	err := c.Start()
+
+	//assert
+	assert.NoError(t, err)
+	assert.True(t, c.Synced())
+	assert.InDelta(t, float64(time.Hour), float64(c.Offset()), float64(time.Second))
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls >= 6
+	}, time.Second, 5*time.Millisecond)
+
+	assert.NoError(t, c.Close())
+	c.lc.wg.Wait()
+}
+
+func TestClockSyncStartTwiceStartsOneSyncGoroutine(t *testing.T) {
+	//arrange
+	server, rc := newTestRESTServer(serverTimePath, serverTimeResponse(2000))
+	defer server.Close()
+
+	c := newTestClockSync(rc, 1000)
+	c.SetInterval(time.Hour)
+
+	//act
+	err := c.Start()
+	err2 := c.Start()
+
+	//assert
+	assert.NoError(t, err)
+	assert.NoError(t, err2)
+
+	done := make(chan struct{})
+	go func() {
+		c.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't return")
+	}
+	assert.Equal(t, errClockSyncClosed, c.Start())
+}
+
+func TestClockSyncStartReturnsErrorIfFirstSyncFails(t *testing.T) {
+	//arrange
+	server, rc := newTestRESTServer("/elsewhere", serverTimeResponse(0))
+	defer server.Close()
+
+	c := newTestClockSync(rc, 1000)
+
+	//act
+	err := c.Start()
+
+	//assert
+	assert.Error(t, err)
+	assert.False(t, c.Synced())
+}
+
+func TestFeedMetricsSetClockMeasuresLatencyAgainstClock(t *testing.T) {
+	//arrange
+	server, rc := newTestRESTServer(serverTimePath, serverTimeResponse(6000))
+	defer server.Close()
+
+	c := newTestClockSync(rc, 1000) // server's clock is 5s ahead
+	assert.NoError(t, c.Sync())
+
+	m := NewFeedMetrics(testSymbol)
+
+	//act
+	m.SetClock(c)
+	m.received(TradeStreamMetrics, 5990)
+
+	//assert
+	assert.Equal(t, 10*time.Millisecond, m.Snapshot().Streams[TradeStreamMetrics].Latency.Last)
+}
+
+func TestWithClockTimestampsEventsWithClock(t *testing.T) {
+	//arrange
+	clock := NewClockSync()
+	clock.now = func() time.Time { return msTime(1000) }
+
+	//act
+	bf := NewBinanceFeeder("bnbbtc", WithClock(clock))
+	mf := NewBinanceMultiFeederWithOptions([]string{"bnbbtc"}, WithClock(clock))
+
+	//assert
+	assert.Equal(t, clock, bf.clock)
+	assert.Equal(t, clock, mf.clock)
+	assert.Equal(t, msTime(1000), timeOf(bf.clock))
+	assert.Equal(t, msTime(1000), bf.metrics.now())
+}
@@ -0,0 +1,383 @@
+package exchange
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// rolloverOverlap is the longest both connections are kept open during a
+	// rollover, should the old connection not catch up with the replacement
+	rolloverOverlap = 30 * time.Second
+	// rolloverRetry is the wait before trying again after a failed rollover
+	rolloverRetry = time.Minute
+
+	controlWriteWait = 10 * time.Second
+)
+
+// connectAndListen dials the url and starts a goroutine sending every message read
+// from the connection to mChan. The connection is re-established after read errors,
+// waiting between attempts as directed by the reconnect policy of opts, and is
+// proactively replaced before Binance's connection lifetime runs out. mChan is
+// closed once the policy gives up or the lifecycle is closed. onReconnect, if set,
+// is called whenever the connection is re-established.
+// An error is returned if the first connection can't be established within the
+// retries of the dial policy of opts.
+func connectAndListen(lc *lifecycle, opts *SocketConnectionOptions, url string, mChan chan []byte, onReconnect func()) error {
+	conn, _, err := dial(lc, opts, opts.dialPolicy(), url, 0)
+	if err != nil {
+		close(mChan)
+		return err
+	}
+
+	policy := opts.reconnectPolicy()
+	failures := 0
+
+	lc.goroutine(func() {
+		defer close(mChan)
+
+		current := startReading(lc, opts, conn, mChan, nil)
+
+		var rollover <-chan time.Time
+		resetRollover := func(d time.Duration) {
+			if opts.RolloverAfter > 0 {
+				rollover = time.After(d)
+			}
+		}
+		resetRollover(opts.RolloverAfter)
+
+		for {
+			select {
+			case <-current.done:
+				if lc.closed() {
+					log.Info().Msgf("disconnected from %s", url)
+					return
+				}
+				log.Error().Err(current.err).Msg("error on read")
+
+				if current.receivedAny() {
+					failures = 0
+				}
+				failures++
+				backOff, ok := policy.NextBackOff(failures)
+				if !ok {
+					log.Error().Msg("max retries reached")
+					return
+				}
+				log.Info().Msgf("reconnecting to %s in %s", url, backOff)
+				if !lc.sleep(backOff) {
+					return
+				}
+
+				if conn, failures, err = dial(lc, opts, policy, url, failures); err != nil {
+					return
+				}
+				if onReconnect != nil {
+					onReconnect()
+				}
+				current = startReading(lc, opts, conn, mChan, nil)
+				resetRollover(opts.RolloverAfter)
+
+			case <-rollover:
+				var ok bool
+				if current, ok = rollOver(lc, opts, url, current, mChan); ok {
+					resetRollover(opts.RolloverAfter)
+				} else {
+					resetRollover(rolloverRetry)
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+// dial attempts to connect to the url until successful, the reconnect policy gives up
+// or the lifecycle is closed. The number of consecutive failures is returned with the
+// connection, so that the policy can carry on from it when the connection is lost.
+func dial(lc *lifecycle, opts *SocketConnectionOptions, policy ReconnectPolicy, url string, failures int) (*websocket.Conn, int, error) {
+	log.Info().Msgf("connecting to %s", url)
+
+	for {
+		conn, _, err := opts.Dialer.DialContext(lc.context(), url, nil)
+		if err == nil {
+			log.Info().Msgf("successfully connected to %s", url)
+			return conn, failures, nil
+		}
+		if lc.closed() {
+			return nil, failures, errFeederClosed
+		}
+		log.Error().Err(err).Msg("connection error")
+
+		failures++
+		backOff, ok := policy.NextBackOff(failures)
+		if !ok {
+			log.Error().Msg("max retries reached")
+			return nil, failures, errDialConnection
+		}
+		if !lc.sleep(backOff) {
+			return nil, failures, errFeederClosed
+		}
+	}
+}
+
+// rollOver replaces the current connection with a new one. The new connection's
+// messages are held back until the current one has sent on the new one's first
+// message, so that the stream continues without a gap, although some messages
+// are sent twice. Should the current connection not catch up within the overlap,
+// the messages between the two are lost.
+// The reader to carry on with is returned, with false if the rollover failed.
+func rollOver(lc *lifecycle, opts *SocketConnectionOptions, url string, current *streamReader, mChan chan []byte) (*streamReader, bool) {
+	log.Info().Msgf("rolling over connection to %s", url)
+
+	// watch from before connecting, as the new connection may receive its first
+	// message before the current one is watched otherwise
+	current.watch()
+	conn, _, err := opts.Dialer.DialContext(lc.context(), url, nil)
+	if err != nil {
+		current.unwatch()
+		log.Error().Err(err).Msg("rollover connection error")
+		return current, false
+	}
+	release := make(chan struct{})
+	next := startReading(lc, opts, conn, mChan, release)
+
+	overlap := time.NewTimer(rolloverOverlap)
+	defer overlap.Stop()
+
+	received := next.received
+	var caughtUp <-chan struct{} // nil until the new connection receives its first message
+	for switchOver := false; !switchOver; {
+		select {
+		case <-received:
+			received, caughtUp = nil, current.caughtUpWith(next.first)
+		case <-caughtUp:
+			switchOver = true
+		case <-overlap.C:
+			if caughtUp != nil {
+				log.Warn().Msgf("rolling over connection to %s before the old connection caught up, so messages may be lost", url)
+			}
+			switchOver = true
+		case <-next.done:
+			current.unwatch()
+			log.Error().Err(next.err).Msg("error on read of rollover connection")
+			return current, false
+		case <-current.done:
+			// the old connection was lost during the overlap, so switch over straight away
+			close(release)
+			return next, true
+		}
+	}
+
+	current.stop()
+	close(release)
+	log.Info().Msgf("rolled over connection to %s", url)
+	return next, true
+}
+
+// streamReader reads messages from a single websocket connection
+type streamReader struct {
+	conn     *websocket.Conn
+	release  chan struct{} // closed once messages may be sent, nil to send them straight away
+	received chan struct{} // closed once the first message is received
+	first    []byte        // the first message received, set before received is closed
+	done     chan struct{} // closed once reading has stopped
+	err      error         // the error that stopped reading, set before done is closed
+
+	mu       sync.Mutex
+	watching bool
+	sent     [][]byte // the messages sent while watching
+	target   []byte   // the message caughtUp is closed once sent
+	caughtUp chan struct{}
+}
+
+// startReading sends every message read from the connection to mChan until a read
+// error occurs or the lifecycle is closed, holding them back until release is
+// closed if it isn't nil. Reads fail if nothing, including pings and pongs, is
+// received within the read timeout of opts, so that half-dead connections are detected.
+func startReading(lc *lifecycle, opts *SocketConnectionOptions, conn *websocket.Conn, mChan chan []byte, release chan struct{}) *streamReader {
+	sr := &streamReader{
+		conn:     conn,
+		release:  release,
+		received: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	extendDeadline := func() {
+		if opts.ReadTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(opts.ReadTimeout))
+		}
+	}
+
+	conn.SetPingHandler(func(data string) error {
+		extendDeadline()
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(controlWriteWait))
+		if err == websocket.ErrCloseSent {
+			return nil
+		} else if e, ok := err.(net.Error); ok && e.Temporary() {
+			return nil
+		}
+		return err
+	})
+	conn.SetPongHandler(func(string) error {
+		extendDeadline()
+		return nil
+	})
+
+	lc.goroutine(func() {
+		defer close(sr.done)
+		defer conn.Close()
+
+		// sends pings, and unblocks the read below when the lifecycle is closed
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			var pings <-chan time.Time
+			if opts.PingInterval > 0 {
+				ticker := time.NewTicker(opts.PingInterval)
+				defer ticker.Stop()
+				pings = ticker.C
+			}
+
+			for {
+				select {
+				case <-pings:
+					conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(controlWriteWait))
+				case <-lc.done():
+					conn.Close()
+					return
+				case <-stop:
+					return
+				}
+			}
+		}()
+
+		extendDeadline()
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				sr.err = err
+				return
+			}
+			extendDeadline()
+
+			if !sr.receivedAny() {
+				sr.first = message
+				close(sr.received)
+				if !sr.held(lc) {
+					sr.err = errFeederClosed
+					return
+				}
+			}
+
+			select {
+			case mChan <- message:
+				sr.sentMessage(message)
+			case <-lc.done():
+				sr.err = errFeederClosed
+				return
+			}
+		}
+	})
+
+	return sr
+}
+
+func (sr *streamReader) receivedAny() bool {
+	select {
+	case <-sr.received:
+		return true
+	default:
+		return false
+	}
+}
+
+// held waits until messages may be sent, returning false if the lifecycle is
+// closed first
+func (sr *streamReader) held(lc *lifecycle) bool {
+	if sr.release == nil {
+		return true
+	}
+	select {
+	case <-sr.release:
+		return true
+	case <-lc.done():
+		return false
+	}
+}
+
+// watch records the messages sent from now on, so that a rollover can tell when
+// they catch up with those of its new connection
+func (sr *streamReader) watch() {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.watching = true
+}
+
+// unwatch stops recording the messages sent
+func (sr *streamReader) unwatch() {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.watching, sr.sent, sr.target = false, nil, nil
+}
+
+// caughtUpWith returns a channel that is closed once the message has been sent,
+// which it already is if sent since watching began
+func (sr *streamReader) caughtUpWith(message []byte) <-chan struct{} {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	sr.caughtUp = make(chan struct{})
+	for _, m := range sr.sent {
+		if bytes.Equal(m, message) {
+			close(sr.caughtUp)
+			sr.watching, sr.sent = false, nil
+			return sr.caughtUp
+		}
+	}
+	sr.sent, sr.target = nil, message
+	return sr.caughtUp
+}
+
+func (sr *streamReader) sentMessage(message []byte) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	switch {
+	case sr.target != nil:
+		if bytes.Equal(message, sr.target) {
+			close(sr.caughtUp)
+			sr.watching, sr.target = false, nil
+		}
+	case sr.watching:
+		sr.sent = append(sr.sent, message)
+	}
+}
+
+// stop closes the connection and waits for reading to stop
+func (sr *streamReader) stop() {
+	sr.conn.Close()
+	<-sr.done
+}
+
+// sequencer drops events whose ID is not greater than that of the last event,
+// such as those received twice while connections overlap during a rollover
+type sequencer struct {
+	last int
+	seen bool
+}
+
+// next reports whether the ID is new, recording it as the last if so
+func (s *sequencer) next(id int) bool {
+	if s.seen && id <= s.last {
+		return false
+	}
+	s.last = id
+	s.seen = true
+	return true
+}
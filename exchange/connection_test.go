@@ -0,0 +1,269 @@
+package exchange
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// broadcastServer sends every message to all of its open connections,
+// as Binance does to every connection subscribed to the same stream
+type broadcastServer struct {
+	*testServer
+
+	mu     sync.Mutex
+	conns  map[*websocket.Conn]bool
+	order  []*websocket.Conn
+	opened int
+}
+
+func newBroadcastServer(path string) *broadcastServer {
+	bs := &broadcastServer{conns: make(map[*websocket.Conn]bool)}
+
+	router := http.NewServeMux()
+	router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		var upgrader = websocket.Upgrader{}
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		bs.mu.Lock()
+		bs.conns[c] = true
+		bs.order = append(bs.order, c)
+		bs.opened++
+		bs.mu.Unlock()
+
+		// read until the client closes the connection
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				break
+			}
+		}
+
+		bs.mu.Lock()
+		delete(bs.conns, c)
+		bs.mu.Unlock()
+		c.Close()
+	})
+
+	server := httptest.NewTLSServer(router)
+	bs.testServer = &testServer{Server: server, path: path}
+	bs.URL = "wss" + strings.TrimPrefix(server.URL, "https")
+	return bs
+}
+
+func (bs *broadcastServer) broadcast(message string) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	for c := range bs.conns {
+		c.WriteMessage(websocket.TextMessage, []byte(message))
+	}
+}
+
+// sendTo sends the message to only the nth connection opened, counting from 1
+func (bs *broadcastServer) sendTo(n int, message string) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.order[n-1].WriteMessage(websocket.TextMessage, []byte(message))
+}
+
+func (bs *broadcastServer) counts() (open int, opened int) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return len(bs.conns), bs.opened
+}
+
+func tradeWithID(id int) string {
+	return strings.Replace(rawTrade, `"t": 12345`, fmt.Sprintf(`"t": %d`, id), 1)
+}
+
+func TestBinanceFeederRollsOverConnectionWithoutLosingOrDuplicatingTrades(t *testing.T) {
+	//arrange
+	bs := newBroadcastServer(tradesURL)
+	defer bs.Close()
+
+	bf := newTestBinanceFeeder(bs.testServer, 0)
+	bf.socketOptions.RolloverAfter = 200 * time.Millisecond
+	defer bf.Close()
+
+	//act
+	tc, err := bf.Trades()
+	assert.NoError(t, err)
+
+	//assert
+	assert.Eventually(t, func() bool { open, _ := bs.counts(); return open == 1 }, time.Second, 10*time.Millisecond)
+	bs.broadcast(tradeWithID(1))
+	assert.Equal(t, 1, (<-tc).ID)
+
+	// wait for the replacement connection to overlap the first
+	assert.Eventually(t, func() bool { open, _ := bs.counts(); return open == 2 }, time.Second, 10*time.Millisecond)
+	bs.broadcast(tradeWithID(2))
+	bs.broadcast(tradeWithID(3))
+
+	assert.Equal(t, 2, (<-tc).ID)
+	assert.Equal(t, 3, (<-tc).ID)
+
+	// old connections are closed once replaced
+	assert.Eventually(t, func() bool {
+		open, opened := bs.counts()
+		return open == 1 && opened >= 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestBinanceFeederRollsOverConnectionOnceOldConnectionCatchesUp(t *testing.T) {
+	//arrange
+	bs := newBroadcastServer(tradesURL)
+	defer bs.Close()
+
+	bf := newTestBinanceFeeder(bs.testServer, 0)
+	bf.socketOptions.RolloverAfter = 200 * time.Millisecond
+	defer bf.Close()
+
+	tc, err := bf.Trades()
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { open, _ := bs.counts(); return open == 1 }, time.Second, 10*time.Millisecond)
+	bs.broadcast(tradeWithID(1))
+	assert.Equal(t, 1, (<-tc).ID)
+	assert.Eventually(t, func() bool { open, _ := bs.counts(); return open == 2 }, time.Second, 10*time.Millisecond)
+
+	//act
+	// the replacement connection gets ahead of the old one
+	bs.sendTo(2, tradeWithID(3))
+	bs.sendTo(2, tradeWithID(4))
+	time.Sleep(50 * time.Millisecond)
+	bs.sendTo(1, tradeWithID(2))
+	bs.sendTo(1, tradeWithID(3))
+	bs.sendTo(1, tradeWithID(4))
+
+	//assert
+	assert.Equal(t, 2, (<-tc).ID)
+	assert.Equal(t, 3, (<-tc).ID)
+	assert.Equal(t, 4, (<-tc).ID)
+	bs.broadcast(tradeWithID(5))
+	assert.Equal(t, 5, (<-tc).ID)
+}
+
+func TestSequencerDropsRepeatedAndOlderIDs(t *testing.T) {
+	var seq sequencer
+
+	assert.True(t, seq.next(5))
+	assert.False(t, seq.next(5))
+	assert.False(t, seq.next(4))
+	assert.True(t, seq.next(6))
+	assert.True(t, seq.next(10))
+}
+
+func TestBinanceFeederReconnectsWhenNothingReceivedWithinReadTimeout(t *testing.T) {
+	//arrange
+	logBuffer.Reset()
+
+	// the server never sends anything or replies to pings, as it doesn't read
+	opened := make(chan struct{}, 10)
+	router := http.NewServeMux()
+	router.HandleFunc(tradesURL, func(w http.ResponseWriter, r *http.Request) {
+		var upgrader = websocket.Upgrader{}
+		c, _ := upgrader.Upgrade(w, r, nil)
+		defer c.Close()
+		opened <- struct{}{}
+		time.Sleep(2 * time.Second)
+	})
+	server := httptest.NewTLSServer(router)
+	defer server.Close()
+	ws := &testServer{Server: server}
+	ws.URL = "wss" + strings.TrimPrefix(server.URL, "https")
+
+	bf := newTestBinanceFeeder(ws, 1)
+	bf.socketOptions.ReadTimeout = 100 * time.Millisecond
+	defer bf.Close()
+
+	//act
+	_, err := bf.Trades()
+
+	//assert
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-opened:
+		case <-time.After(time.Second):
+			assert.Fail(t, "feeder did not reconnect after read timeout")
+		}
+	}
+	assertContainsErrorLog(t, logBuffer.Contents(), "i/o timeout")
+}
+
+func TestBinanceFeederStaysConnectedWhileReceivingPings(t *testing.T) {
+	//arrange
+	var mu sync.Mutex
+	connections := 0
+
+	router := http.NewServeMux()
+	router.HandleFunc(tradesURL, func(w http.ResponseWriter, r *http.Request) {
+		var upgrader = websocket.Upgrader{}
+		c, _ := upgrader.Upgrade(w, r, nil)
+		defer c.Close()
+
+		mu.Lock()
+		connections++
+		mu.Unlock()
+
+		// only pings are sent for longer than the read timeout
+		for i := 0; i < 10; i++ {
+			c.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(time.Second))
+			time.Sleep(50 * time.Millisecond)
+		}
+		c.WriteMessage(websocket.TextMessage, []byte(rawTrade))
+		time.Sleep(time.Second)
+	})
+	server := httptest.NewTLSServer(router)
+	defer server.Close()
+	ws := &testServer{Server: server}
+	ws.URL = "wss" + strings.TrimPrefix(server.URL, "https")
+
+	bf := newTestBinanceFeeder(ws, 1)
+	bf.socketOptions.ReadTimeout = 200 * time.Millisecond
+	defer bf.Close()
+
+	//act
+	tc, err := bf.Trades()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedTrade, withoutReceipt(<-tc))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, connections)
+}
+
+func TestBinanceFeederStaysConnectedWhileReceivingPongs(t *testing.T) {
+	//arrange
+	bs := newBroadcastServer(tradesURL)
+	defer bs.Close()
+
+	bf := newTestBinanceFeeder(bs.testServer, 1)
+	bf.socketOptions.ReadTimeout = 200 * time.Millisecond
+	bf.socketOptions.PingInterval = 50 * time.Millisecond
+	defer bf.Close()
+
+	//act
+	tc, err := bf.Trades()
+	assert.NoError(t, err)
+
+	// only pongs are received for longer than the read timeout
+	time.Sleep(500 * time.Millisecond)
+	bs.broadcast(rawTrade)
+
+	//assert
+	assert.Equal(t, expectedTrade, withoutReceipt(<-tc))
+
+	_, opened := bs.counts()
+	assert.Equal(t, 1, opened)
+}
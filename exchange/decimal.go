@@ -0,0 +1,405 @@
+package exchange
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxDigits is the most significant digits every Decimal can hold. Results
+// needing more are rounded half to even, as floats are, but in base 10.
+const maxDigits = 18
+
+var pow10 = [maxDigits + 1]int64{
+	1, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9,
+	1e10, 1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18,
+}
+
+// Decimal is an exact fixed-point number, used for prices and quantities so
+// that they can be compared to tick sizes and summed without rounding errors.
+// Its value is coef * 10^-scale. Decimals are kept normalised, so equal values
+// are equal with ==, and can be used as map keys. The zero value is 0.
+type Decimal struct {
+	coef  int64
+	scale int32
+}
+
+// NewDecimal returns the Decimal coef * 10^-scale, e.g. NewDecimal(15, 1) is 1.5
+func NewDecimal(coef int64, scale int32) Decimal {
+	if coef == 0 {
+		return Decimal{}
+	}
+	for coef%10 == 0 {
+		coef /= 10
+		scale--
+	}
+	return Decimal{coef: coef, scale: scale}
+}
+
+// NewDecimalFromInt returns the Decimal of an integer
+func NewDecimalFromInt(i int64) Decimal {
+	return NewDecimal(i, 0)
+}
+
+// NewDecimalFromFloat returns the Decimal with the shortest representation that
+// rounds to the float, e.g. 0.1 rather than 0.1000000000000000055511151231257827.
+// It panics if the float is NaN or infinite.
+func NewDecimalFromFloat(f float64) Decimal {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		panic(fmt.Sprintf("exchange: can't convert %v to a Decimal", f))
+	}
+	d, err := ParseDecimal(strconv.FormatFloat(f, 'g', -1, 64))
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// ParseDecimal parses a decimal number such as "0.00100000", "-12" or "1.5e-7",
+// as used for prices and quantities by Binance
+func ParseDecimal(s string) (Decimal, error) {
+	str := s
+	var exp int64
+	if i := strings.IndexAny(str, "eE"); i >= 0 {
+		var err error
+		if exp, err = strconv.ParseInt(str[i+1:], 10, 32); err != nil {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+		}
+		str = str[:i]
+	}
+
+	neg := false
+	if len(str) > 0 && (str[0] == '-' || str[0] == '+') {
+		neg = str[0] == '-'
+		str = str[1:]
+	}
+
+	intPart, fracPart := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		intPart, fracPart = str[:i], str[i+1:]
+	}
+	digits := strings.TrimLeft(intPart+fracPart, "0")
+	if intPart == "" && fracPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	if neg {
+		digits = "-" + digits
+	}
+	scale := int32(len(fracPart)) - int32(exp)
+
+	if digits == "" || digits == "-" {
+		return Decimal{}, nil
+	}
+	if coef, err := strconv.ParseInt(digits, 10, 64); err == nil {
+		return NewDecimal(coef, scale), nil
+	}
+	coef, _ := new(big.Int).SetString(digits, 10)
+	return fromBig(coef, scale), nil
+}
+
+// MustParseDecimal is like ParseDecimal but panics if the string can't be parsed.
+// It simplifies the initialisation of Decimal constants.
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// fromBig returns the Decimal coef * 10^-scale, rounding coef to maxDigits
+// significant digits if it doesn't fit
+func fromBig(coef *big.Int, scale int32) Decimal {
+	if coef.IsInt64() {
+		return NewDecimal(coef.Int64(), scale)
+	}
+
+	drop := len(new(big.Int).Abs(coef).String()) - maxDigits
+	q := roundQuo(coef, bigPow10(int32(drop)))
+	if q.IsInt64() {
+		return NewDecimal(q.Int64(), scale-int32(drop))
+	}
+	// rounding up added a digit, e.g. 999... to 1000...
+	return fromBig(q, scale-int32(drop))
+}
+
+// roundQuo returns x/y rounded half to even
+func roundQuo(x *big.Int, y *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	half := new(big.Int).Abs(r)
+	half.Lsh(half, 1)
+	if c := half.Cmp(new(big.Int).Abs(y)); c > 0 || c == 0 && q.Bit(0) == 1 {
+		if x.Sign()*y.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+func bigPow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// bigAt returns the coefficient of d at the given scale, which must be at least d's scale
+func (d Decimal) bigAt(scale int32) *big.Int {
+	coef := big.NewInt(d.coef)
+	return coef.Mul(coef, bigPow10(scale-d.scale))
+}
+
+// align returns the coefficients of d and d2 at a common scale, with false
+// if one of them doesn't fit in an int64 at that scale
+func align(d Decimal, d2 Decimal) (int64, int64, int32, bool) {
+	if d.scale == d2.scale {
+		return d.coef, d2.coef, d.scale, true
+	}
+	if d.scale < d2.scale {
+		a, ok := scaleUp(d.coef, d2.scale-d.scale)
+		return a, d2.coef, d2.scale, ok
+	}
+	b, ok := scaleUp(d2.coef, d.scale-d2.scale)
+	return d.coef, b, d.scale, ok
+}
+
+func scaleUp(coef int64, by int32) (int64, bool) {
+	if by > maxDigits {
+		return 0, coef == 0
+	}
+	p := pow10[by]
+	if coef > math.MaxInt64/p || coef < math.MinInt64/p {
+		return 0, false
+	}
+	return coef * p, true
+}
+
+func maxScale(d Decimal, d2 Decimal) int32 {
+	if d.scale > d2.scale {
+		return d.scale
+	}
+	return d2.scale
+}
+
+// Add returns d + d2
+func (d Decimal) Add(d2 Decimal) Decimal {
+	if a, b, scale, ok := align(d, d2); ok {
+		sum := a + b
+		if (a >= 0) == (b >= 0) && (sum >= 0) != (a >= 0) {
+			return fromBig(new(big.Int).Add(big.NewInt(a), big.NewInt(b)), scale)
+		}
+		return NewDecimal(sum, scale)
+	}
+	scale := maxScale(d, d2)
+	return fromBig(new(big.Int).Add(d.bigAt(scale), d2.bigAt(scale)), scale)
+}
+
+// Sub returns d - d2
+func (d Decimal) Sub(d2 Decimal) Decimal {
+	return d.Add(d2.Neg())
+}
+
+// Mul returns d * d2
+func (d Decimal) Mul(d2 Decimal) Decimal {
+	if d.coef == 0 || d2.coef == 0 {
+		return Decimal{}
+	}
+	product := d.coef * d2.coef
+	if product/d2.coef == d.coef && !(d.coef == -1 && d2.coef == math.MinInt64) && !(d2.coef == -1 && d.coef == math.MinInt64) {
+		return NewDecimal(product, d.scale+d2.scale)
+	}
+	return fromBig(new(big.Int).Mul(big.NewInt(d.coef), big.NewInt(d2.coef)), d.scale+d2.scale)
+}
+
+// Div returns d / d2 rounded half to even to the given number of decimal places.
+// It panics if d2 is zero.
+func (d Decimal) Div(d2 Decimal, places int32) Decimal {
+	if d2.coef == 0 {
+		panic("exchange: division of Decimal by zero")
+	}
+
+	// d / d2 = (d.coef / d2.coef) * 10^(d2.scale - d.scale), so at the given
+	// number of places the coefficient is d.coef * 10^shift / d2.coef
+	num, den := big.NewInt(d.coef), big.NewInt(d2.coef)
+	if shift := places + d2.scale - d.scale; shift >= 0 {
+		num.Mul(num, bigPow10(shift))
+	} else {
+		den.Mul(den, bigPow10(-shift))
+	}
+	return fromBig(roundQuo(num, den), places)
+}
+
+// Neg returns -d
+func (d Decimal) Neg() Decimal {
+	if d.coef == math.MinInt64 {
+		return fromBig(new(big.Int).Neg(big.NewInt(d.coef)), d.scale)
+	}
+	return Decimal{coef: -d.coef, scale: d.scale}
+}
+
+// Abs returns the absolute value of d
+func (d Decimal) Abs() Decimal {
+	if d.coef < 0 {
+		return d.Neg()
+	}
+	return d
+}
+
+// Sign returns -1, 0 or +1 when d is negative, zero or positive
+func (d Decimal) Sign() int {
+	switch {
+	case d.coef < 0:
+		return -1
+	case d.coef > 0:
+		return 1
+	}
+	return 0
+}
+
+// IsZero reports whether d is 0
+func (d Decimal) IsZero() bool {
+	return d.coef == 0
+}
+
+// Cmp returns -1, 0 or +1 when d is less than, equal to or greater than d2
+func (d Decimal) Cmp(d2 Decimal) int {
+	if a, b, _, ok := align(d, d2); ok {
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+	scale := maxScale(d, d2)
+	return d.bigAt(scale).Cmp(d2.bigAt(scale))
+}
+
+// Equal reports whether d == d2
+func (d Decimal) Equal(d2 Decimal) bool {
+	return d == d2
+}
+
+// LessThan reports whether d < d2
+func (d Decimal) LessThan(d2 Decimal) bool {
+	return d.Cmp(d2) < 0
+}
+
+// GreaterThan reports whether d > d2
+func (d Decimal) GreaterThan(d2 Decimal) bool {
+	return d.Cmp(d2) > 0
+}
+
+// steps returns the coefficients of d and step at a common scale
+func (d Decimal) steps(step Decimal) (*big.Int, *big.Int, int32) {
+	scale := maxScale(d, step)
+	return d.bigAt(scale), step.bigAt(scale), scale
+}
+
+// IsMultipleOf reports whether d is a whole number of steps, such as a price
+// that is a multiple of the tick size. Every Decimal is a multiple of a zero step.
+func (d Decimal) IsMultipleOf(step Decimal) bool {
+	if step.coef == 0 {
+		return true
+	}
+	a, s, _ := d.steps(step)
+	return new(big.Int).Rem(a, s).Sign() == 0
+}
+
+// FloorToStep rounds d down to a multiple of the step. d is returned unchanged
+// if the step isn't positive.
+func (d Decimal) FloorToStep(step Decimal) Decimal {
+	if step.coef <= 0 {
+		return d
+	}
+	a, s, scale := d.steps(step)
+	q := new(big.Int).Div(a, s) // Euclidean, so floored as s > 0
+	return fromBig(q.Mul(q, s), scale)
+}
+
+// CeilToStep rounds d up to a multiple of the step. d is returned unchanged
+// if the step isn't positive.
+func (d Decimal) CeilToStep(step Decimal) Decimal {
+	return d.Neg().FloorToStep(step).Neg()
+}
+
+// RoundToStep rounds d to the nearest multiple of the step, with halves
+// rounded away from zero. d is returned unchanged if the step isn't positive.
+func (d Decimal) RoundToStep(step Decimal) Decimal {
+	if step.coef <= 0 {
+		return d
+	}
+	down := d.Abs().FloorToStep(step)
+	if d.Abs().Sub(down).Mul(NewDecimalFromInt(2)).Cmp(step) >= 0 {
+		down = down.Add(step)
+	}
+	if d.coef < 0 {
+		return down.Neg()
+	}
+	return down
+}
+
+// Float64 returns the nearest float to d
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// String returns d without an exponent or trailing zeros, e.g. "0.001" or "-120"
+func (d Decimal) String() string {
+	if d.coef == 0 {
+		return "0"
+	}
+
+	digits := strconv.FormatInt(d.coef, 10)
+	sign := ""
+	if d.coef < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	if d.scale <= 0 {
+		return sign + digits + strings.Repeat("0", int(-d.scale))
+	}
+	if pad := int(d.scale) - len(digits) + 1; pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+	point := len(digits) - int(d.scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// MarshalJSON encodes d as a string, as Binance does, so that no precision is lost
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+// UnmarshalJSON decodes a Decimal from either a string or a number
+func (d *Decimal) UnmarshalJSON(buf []byte) error {
+	if string(buf) == "null" {
+		return nil
+	}
+
+	if len(buf) > 1 && buf[0] == '"' && buf[len(buf)-1] == '"' {
+		buf = buf[1 : len(buf)-1]
+	}
+	parsed, err := ParseDecimal(string(buf))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
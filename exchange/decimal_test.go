@@ -0,0 +1,136 @@
+package exchange
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDecimalParsesBinanceStrings(t *testing.T) {
+	tests := map[string]string{
+		"0.00100000":  "0.001",
+		"100":         "100",
+		"-12.50":      "-12.5",
+		"+3":          "3",
+		".5":          "0.5",
+		"5.":          "5",
+		"0.00000000":  "0",
+		"-0":          "0",
+		"1.5e-7":      "0.00000015",
+		"2E3":         "2000",
+		"00012.3400":  "12.34",
+		"12345678.12": "12345678.12",
+	}
+
+	for in, expected := range tests {
+		d, err := ParseDecimal(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, expected, d.String(), in)
+	}
+}
+
+func TestParseDecimalReturnsErrorOnInvalidStrings(t *testing.T) {
+	for _, in := range []string{"", ".", "-", "abc", "1.2.3", "1e", "1,5", "0x10", " 1"} {
+		_, err := ParseDecimal(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestParseDecimalRoundsTooManyDigitsHalfToEven(t *testing.T) {
+	assert.Equal(t, "12345678901234567800", MustParseDecimal("12345678901234567850").String())
+	assert.Equal(t, "1234567890123456.8", MustParseDecimal("1234567890123456.7950").String())
+	assert.Equal(t, "0.123456789012345679", MustParseDecimal("0.12345678901234567891").String())
+	assert.Equal(t, "100000000000000000000", MustParseDecimal("99999999999999999999").String())
+}
+
+func TestDecimalsOfEqualValueAreEqual(t *testing.T) {
+	assert.True(t, MustParseDecimal("0.0010") == MustParseDecimal("0.001"))
+	assert.True(t, NewDecimal(1500, 3) == NewDecimalFromFloat(1.5))
+	assert.True(t, NewDecimalFromInt(0) == Decimal{})
+
+	levels := map[Decimal]bool{MustParseDecimal("0.0024000"): true}
+	assert.True(t, levels[MustParseDecimal("0.0024")])
+}
+
+func TestDecimalArithmeticIsExact(t *testing.T) {
+	a, b := MustParseDecimal("0.1"), MustParseDecimal("0.2")
+
+	assert.Equal(t, MustParseDecimal("0.3"), a.Add(b))
+	assert.Equal(t, MustParseDecimal("-0.1"), a.Sub(b))
+	assert.Equal(t, MustParseDecimal("0.02"), a.Mul(b))
+	assert.Equal(t, MustParseDecimal("0.5"), a.Div(b, 8))
+	assert.Equal(t, MustParseDecimal("0.33333333"), a.Div(MustParseDecimal("0.3"), 8))
+	assert.Equal(t, MustParseDecimal("0.66666667"), b.Div(MustParseDecimal("0.3"), 8))
+	assert.Equal(t, MustParseDecimal("0.1"), a.Neg().Abs())
+}
+
+func TestDecimalArithmeticFallsBackOnOverflow(t *testing.T) {
+	large := MustParseDecimal("9000000000000000000")
+
+	assert.Equal(t, "18000000000000000000", large.Add(large).String())
+	assert.Equal(t, "81000000000000000000000000000000000000", large.Mul(large).String())
+	assert.Equal(t, "9000000000000000000", large.Add(MustParseDecimal("0.1")).String(), "rounded to the digits held")
+	assert.Equal(t, 1, large.Add(large).Cmp(large))
+	assert.Equal(t, -1, MustParseDecimal("0.000000000000000000001").Cmp(MustParseDecimal("1")))
+}
+
+func TestDecimalComparison(t *testing.T) {
+	a, b := MustParseDecimal("0.0025"), MustParseDecimal("0.0024")
+
+	assert.Equal(t, 1, a.Cmp(b))
+	assert.Equal(t, -1, b.Cmp(a))
+	assert.Equal(t, 0, a.Cmp(MustParseDecimal("0.00250")))
+	assert.True(t, a.GreaterThan(b))
+	assert.True(t, b.LessThan(a))
+	assert.True(t, a.Equal(MustParseDecimal("0.00250")))
+	assert.Equal(t, -1, b.Neg().Sign())
+	assert.True(t, MustParseDecimal("0.000").IsZero())
+}
+
+func TestDecimalRoundsToStep(t *testing.T) {
+	tick := MustParseDecimal("0.01")
+
+	assert.Equal(t, MustParseDecimal("1.23"), MustParseDecimal("1.2389").FloorToStep(tick))
+	assert.Equal(t, MustParseDecimal("1.24"), MustParseDecimal("1.2301").CeilToStep(tick))
+	assert.Equal(t, MustParseDecimal("1.24"), MustParseDecimal("1.235").RoundToStep(tick))
+	assert.Equal(t, MustParseDecimal("1.23"), MustParseDecimal("1.2349").RoundToStep(tick))
+	assert.Equal(t, MustParseDecimal("-1.24"), MustParseDecimal("-1.2301").FloorToStep(tick))
+	assert.Equal(t, MustParseDecimal("-1.24"), MustParseDecimal("-1.235").RoundToStep(tick))
+	assert.Equal(t, MustParseDecimal("1.23"), MustParseDecimal("1.23").CeilToStep(tick))
+	assert.Equal(t, MustParseDecimal("150"), MustParseDecimal("174").FloorToStep(MustParseDecimal("25")))
+	assert.Equal(t, MustParseDecimal("1.2389"), MustParseDecimal("1.2389").FloorToStep(Decimal{}))
+
+	assert.True(t, MustParseDecimal("1.23").IsMultipleOf(tick))
+	assert.False(t, MustParseDecimal("1.234").IsMultipleOf(tick))
+}
+
+func TestDecimalFloat64(t *testing.T) {
+	assert.Equal(t, 0.001, MustParseDecimal("0.00100000").Float64())
+	assert.Equal(t, -120.0, MustParseDecimal("-120").Float64())
+	assert.Equal(t, 0.1, NewDecimalFromFloat(0.1).Float64())
+	assert.Equal(t, "0.1", NewDecimalFromFloat(0.1).String())
+	assert.Panics(t, func() { NewDecimalFromFloat(math.NaN()) })
+}
+
+func TestDecimalJSONRoundTrip(t *testing.T) {
+	var v struct {
+		Quoted Decimal `json:"quoted"`
+		Bare   Decimal `json:"bare"`
+		Null   Decimal `json:"null"`
+	}
+
+	err := json.Unmarshal([]byte(`{"quoted": "0.00100000", "bare": 1.5, "null": null}`), &v)
+	assert.NoError(t, err)
+	assert.Equal(t, MustParseDecimal("0.001"), v.Quoted)
+	assert.Equal(t, MustParseDecimal("1.5"), v.Bare)
+	assert.True(t, v.Null.IsZero())
+
+	buf, err := json.Marshal(v)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"quoted": "0.001", "bare": "1.5", "null": "0"}`, string(buf))
+
+	err = json.Unmarshal([]byte(`{"quoted": "abc"}`), &v)
+	assert.Error(t, err)
+}
@@ -0,0 +1,455 @@
+package exchange
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// errUnsupportedJSON is returned by the decoder for anything outside the subset
+// of JSON that Binance sends, so that the message is decoded by encoding/json instead
+var errUnsupportedJSON = errors.New("unsupported JSON")
+
+const (
+	// maxInterned is how many distinct strings are interned before new strings
+	// are allocated instead
+	maxInterned = 10000
+	// maxPooledEntries is how many released entry slices are held for reuse
+	maxPooledEntries = 1024
+)
+
+// DecodeTrade decodes a trade stream payload into t without allocating. Payloads
+// it doesn't recognise are decoded with encoding/json, giving the same result.
+func DecodeTrade(data []byte, t *Trade) error {
+	*t = Trade{}
+	d := decoder{data: data}
+	d.object(func(key []byte) {
+		switch string(key) {
+		case "e":
+			t.Type = d.str()
+		case "M":
+			t.Ignore = d.bool()
+		case "s":
+			t.Symbol = d.str()
+		case "t":
+			t.ID = d.int()
+		case "b":
+			t.BuyerOrderID = d.int()
+		case "a":
+			t.SellerOrderID = d.int()
+		case "T":
+			t.TradeTime = d.int()
+		case "E":
+			t.EventTime = d.int()
+		case "p":
+			t.Price = d.decimal()
+		case "q":
+			t.Quantity = d.decimal()
+		case "m":
+			t.IsBuyerMaker = d.bool()
+		default:
+			d.skip()
+		}
+	})
+	if d.finish() == nil {
+		return nil
+	}
+
+	// decoded separately so that t doesn't escape, which would allocate every call
+	var fallback Trade
+	err := json.Unmarshal(data, &fallback)
+	*t = fallback
+	return err
+}
+
+// DecodeBookUpdate decodes a depth stream payload into b, reusing the capacity
+// of b's Bids and Asks. It doesn't allocate once they have grown large enough.
+// Payloads it doesn't recognise are decoded with encoding/json, giving the same result.
+func DecodeBookUpdate(data []byte, b *BookUpdate) error {
+	bids, asks := b.Bids[:0], b.Asks[:0]
+	*b = BookUpdate{}
+
+	d := decoder{data: data}
+	d.object(func(key []byte) {
+		switch string(key) {
+		case "e":
+			b.Type = d.str()
+		case "E":
+			b.EventTime = d.int()
+		case "s":
+			b.Symbol = d.str()
+		case "U":
+			b.FirstUpdateID = d.int()
+		case "u":
+			b.LastUpdateID = d.int()
+		case "b":
+			b.Bids = d.entries(bids)
+		case "a":
+			b.Asks = d.entries(asks)
+		default:
+			d.skip()
+		}
+	})
+	if d.finish() == nil {
+		return nil
+	}
+
+	fallback := BookUpdate{Bids: bids, Asks: asks}
+	err := json.Unmarshal(data, &fallback)
+	*b = fallback
+	return err
+}
+
+// ReleaseBookUpdate hands the book update's Bids and Asks back to be reused by
+// book updates decoded later, reducing garbage on busy streams. It is optional,
+// and must only be called once nothing else holds the update, so not for updates
+// shared between the subscribers of a hub.
+func ReleaseBookUpdate(b BookUpdate) {
+	bookEntryPool.put(b.Bids)
+	bookEntryPool.put(b.Asks)
+}
+
+var bookEntryPool entryPool
+
+// entryPool is a free list of entry slices. Unlike sync.Pool, putting a slice
+// doesn't allocate.
+type entryPool struct {
+	mu   sync.Mutex
+	free [][]BookEntry
+}
+
+// get returns a released slice, or nil if there are none
+func (p *entryPool) get() []BookEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := len(p.free)
+	if n == 0 {
+		return nil
+	}
+	s := p.free[n-1]
+	p.free[n-1] = nil
+	p.free = p.free[:n-1]
+	return s
+}
+
+func (p *entryPool) put(s []BookEntry) {
+	if cap(s) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.free) < maxPooledEntries {
+		p.free = append(p.free, s[:0])
+	}
+}
+
+// interned holds a single copy of the strings decoded, such as symbols, so that
+// each message doesn't allocate its own
+var interned = struct {
+	sync.RWMutex
+	strings map[string]string
+}{strings: make(map[string]string)}
+
+func intern(b []byte) string {
+	interned.RLock()
+	s, ok := interned.strings[string(b)]
+	interned.RUnlock()
+	if ok {
+		return s
+	}
+
+	s = string(b)
+	interned.Lock()
+	if len(interned.strings) < maxInterned {
+		interned.strings[s] = s
+	}
+	interned.Unlock()
+	return s
+}
+
+// decoder scans a single JSON object of the subset of JSON that Binance sends:
+// strings without escapes, integers, decimals as strings or numbers, booleans
+// and arrays of them. After the first error every method does nothing.
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = errUnsupportedJSON
+	}
+}
+
+func (d *decoder) space() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\n', '\r':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the next byte that isn't white space, or 0 at the end of the data
+func (d *decoder) peek() byte {
+	d.space()
+	if d.err != nil || d.pos >= len(d.data) {
+		return 0
+	}
+	return d.data[d.pos]
+}
+
+// consume moves past the next byte if it is c, reporting whether it was
+func (d *decoder) consume(c byte) bool {
+	if d.peek() != c {
+		return false
+	}
+	d.pos++
+	return true
+}
+
+func (d *decoder) expect(c byte) {
+	if !d.consume(c) {
+		d.fail()
+	}
+}
+
+// finish checks nothing but white space follows the object
+func (d *decoder) finish() error {
+	if d.peek() != 0 {
+		d.fail()
+	}
+	return d.err
+}
+
+// object calls field with each key of an object, which must consume the value
+func (d *decoder) object(field func(key []byte)) {
+	d.expect('{')
+	if d.consume('}') {
+		return
+	}
+	for d.err == nil {
+		key := d.raw()
+		d.expect(':')
+		field(key)
+		if d.consume('}') {
+			return
+		}
+		d.expect(',')
+	}
+}
+
+// raw returns the contents of a string without copying them
+func (d *decoder) raw() []byte {
+	if !d.consume('"') {
+		d.fail()
+		return nil
+	}
+	start := d.pos
+	for d.pos < len(d.data) {
+		switch c := d.data[d.pos]; {
+		case c == '"':
+			d.pos++
+			return d.data[start : d.pos-1]
+		case c == '\\' || c < ' ':
+			d.fail()
+			return nil
+		}
+		d.pos++
+	}
+	d.fail()
+	return nil
+}
+
+func (d *decoder) str() string {
+	b := d.raw()
+	if d.err != nil {
+		return ""
+	}
+	return intern(b)
+}
+
+// token returns the bytes of a number or literal
+func (d *decoder) token() []byte {
+	d.space()
+	start := d.pos
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ',', '}', ']', ' ', '\t', '\n', '\r':
+			return d.data[start:d.pos]
+		}
+		d.pos++
+	}
+	return d.data[start:d.pos]
+}
+
+func (d *decoder) int() int {
+	b := d.token()
+	if len(b) == 0 || d.err != nil {
+		d.fail()
+		return 0
+	}
+
+	neg := b[0] == '-'
+	if neg {
+		b = b[1:]
+	}
+	if len(b) == 0 || len(b) > 18 {
+		d.fail()
+		return 0
+	}
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			d.fail()
+			return 0
+		}
+		n = n*10 + int(c-'0')
+	}
+	if neg {
+		return -n
+	}
+	return n
+}
+
+func (d *decoder) bool() bool {
+	switch string(d.token()) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	d.fail()
+	return false
+}
+
+// decimal decodes a decimal given as a string or a number
+func (d *decoder) decimal() Decimal {
+	var b []byte
+	if d.peek() == '"' {
+		b = d.raw()
+	} else {
+		b = d.token()
+	}
+	if d.err != nil {
+		return Decimal{}
+	}
+
+	v, ok := parseDecimalBytes(b)
+	if !ok {
+		d.fail()
+	}
+	return v
+}
+
+// entries decodes an array of [price, quantity] pairs, appending them to dst
+func (d *decoder) entries(dst []BookEntry) []BookEntry {
+	if d.peek() == 'n' {
+		if string(d.token()) != "null" {
+			d.fail()
+		}
+		return nil
+	}
+
+	d.expect('[')
+	if dst == nil {
+		dst = []BookEntry{}
+	}
+	if d.consume(']') {
+		return dst
+	}
+	for d.err == nil {
+		d.expect('[')
+		price := d.decimal()
+		d.expect(',')
+		quantity := d.decimal()
+		d.expect(']')
+		dst = append(dst, BookEntry{Price: price, Quantity: quantity})
+
+		if d.consume(']') {
+			return dst
+		}
+		d.expect(',')
+	}
+	return dst
+}
+
+// skip moves past a value of any type
+func (d *decoder) skip() {
+	switch d.peek() {
+	case '"':
+		d.raw()
+	case '{':
+		d.object(func(key []byte) {
+			d.skip()
+		})
+	case '[':
+		d.pos++
+		if d.consume(']') {
+			return
+		}
+		for d.err == nil {
+			d.skip()
+			if d.consume(']') {
+				return
+			}
+			d.expect(',')
+		}
+	default:
+		if len(d.token()) == 0 {
+			d.fail()
+		}
+	}
+}
+
+// parseDecimalBytes parses a plain decimal such as "0.00100000" or "-12" of up
+// to maxDigits significant digits without allocating, reporting false for
+// anything else. Other decimals are parsed by ParseDecimal.
+func parseDecimalBytes(b []byte) (Decimal, bool) {
+	orig := b
+	neg := false
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		neg = b[0] == '-'
+		b = b[1:]
+	}
+
+	var coef int64
+	var scale int32
+	digits, significant := 0, 0
+	point := false
+	for _, c := range b {
+		switch {
+		case c == '.' && !point:
+			point = true
+		case c >= '0' && c <= '9':
+			digits++
+			if point {
+				scale++
+			}
+			if coef == 0 && c == '0' {
+				continue
+			}
+			if significant++; significant > maxDigits {
+				d, err := ParseDecimal(string(orig))
+				return d, err == nil
+			}
+			coef = coef*10 + int64(c-'0')
+		default:
+			d, err := ParseDecimal(string(orig))
+			return d, err == nil
+		}
+	}
+	if digits == 0 {
+		return Decimal{}, false
+	}
+
+	if neg {
+		coef = -coef
+	}
+	return NewDecimal(coef, scale), true
+}
@@ -0,0 +1,244 @@
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// busyBookUpdate returns a depth payload of the given number of levels each side,
+// the size of those of a busy market
+func busyBookUpdate(levels int) []byte {
+	var bids, asks []string
+	for i := 0; i < levels; i++ {
+		bids = append(bids, fmt.Sprintf(`["%d.%08d","%d.%08d"]`, 41000-i, i*1234, i+1, i*5678))
+		asks = append(asks, fmt.Sprintf(`["%d.%08d","%d.%08d"]`, 41001+i, i*4321, i+1, i*8765))
+	}
+	return []byte(fmt.Sprintf(`{"e":"depthUpdate","E":1672515782136,"s":"BTCUSDT","U":157,"u":160,"b":[%s],"a":[%s]}`,
+		strings.Join(bids, ","), strings.Join(asks, ",")))
+}
+
+func TestDecodeTradeMatchesEncodingJSON(t *testing.T) {
+	//arrange
+	var expected Trade
+	assert.NoError(t, json.Unmarshal([]byte(rawTrade), &expected))
+
+	//act
+	var trade Trade
+	err := DecodeTrade([]byte(rawTrade), &trade)
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expected, trade)
+	assert.Equal(t, expectedTrade, trade)
+}
+
+func TestDecodeBookUpdateMatchesEncodingJSON(t *testing.T) {
+	for _, payload := range []string{
+		rawBookUpdate,
+		string(busyBookUpdate(50)),
+		`{"e":"depthUpdate","E":1,"s":"BNBBTC","U":1,"u":2,"b":[],"a":null}`,
+		`{"e":"depthUpdate","E":1,"s":"BNBBTC","U":1,"u":2,"b":[[0.5,1]],"x":{"y":[1,"]",true]}}`,
+		` { "u" : 2 , "U" : 1 } `,
+	} {
+		//arrange
+		var expected BookUpdate
+		assert.NoError(t, json.Unmarshal([]byte(payload), &expected))
+
+		//act
+		var b BookUpdate
+		err := DecodeBookUpdate([]byte(payload), &b)
+
+		//assert
+		assert.NoError(t, err, payload)
+		assert.Equal(t, expected, b, payload)
+	}
+}
+
+func TestDecodeBookUpdateReusesEntryCapacity(t *testing.T) {
+	//arrange
+	b := BookUpdate{Bids: make([]BookEntry, 0, 100), Asks: make([]BookEntry, 0, 100)}
+	bids := &b.Bids[:1][0]
+
+	//act
+	err := DecodeBookUpdate([]byte(rawBookUpdate), &b)
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedBookUpdate, b)
+	assert.Same(t, bids, &b.Bids[0])
+}
+
+func TestDecodeFallsBackToEncodingJSONForUnsupportedPayloads(t *testing.T) {
+	//arrange
+	escaped := `{"e":"trade","s":"BNB\u0042TC","t":12345,"p":"1e-3","q":"100"}`
+
+	//act
+	var trade Trade
+	err := DecodeTrade([]byte(escaped), &trade)
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, "BNBBTC", trade.Symbol)
+	assert.Equal(t, MustParseDecimal("0.001"), trade.Price)
+}
+
+func TestDecodeReturnsEncodingJSONErrorForBadPayloads(t *testing.T) {
+	for _, payload := range []string{
+		`{"e":"trade","t":"abc"}`,
+		`{"e":"trade","p":"1.2.3"}`,
+		`{"e":"trade"`,
+		`{"e":"trade"} extra`,
+		`[]`,
+	} {
+		//act
+		var trade Trade
+		err := DecodeTrade([]byte(payload), &trade)
+		expectedErr := json.Unmarshal([]byte(payload), &Trade{})
+
+		//assert
+		assert.Error(t, err, payload)
+		assert.Equal(t, expectedErr, err, payload)
+	}
+
+	var b BookUpdate
+	err := DecodeBookUpdate([]byte(`{"b":[["0.0024"]]}`), &b)
+	assert.EqualError(t, err, "wrong number of fields in bookEntry: 1 != 2")
+}
+
+func TestParseDecimalBytesMatchesParseDecimal(t *testing.T) {
+	for _, s := range []string{
+		"0.00100000", "41000.12345678", "-12", "+1.5", "0", "-0.0", "007", "5.",
+		"1.5e-7", "123456789012345678901", "0.000000000000000000000012345",
+		"", ".", "-", "1.2.3", "--1", "1a", "0x10",
+	} {
+		//act
+		d, ok := parseDecimalBytes([]byte(s))
+		expected, err := ParseDecimal(s)
+
+		//assert
+		assert.Equal(t, err == nil, ok, s)
+		assert.Equal(t, expected, d, s)
+	}
+}
+
+func TestDecodeDoesNotAllocate(t *testing.T) {
+	//arrange
+	payload := busyBookUpdate(50)
+	var b BookUpdate
+	assert.NoError(t, DecodeBookUpdate(payload, &b))
+	trade := []byte(rawTrade)
+	var tr Trade
+
+	//act
+	bookUpdateAllocs := testing.AllocsPerRun(100, func() {
+		DecodeBookUpdate(payload, &b)
+	})
+	tradeAllocs := testing.AllocsPerRun(100, func() {
+		DecodeTrade(trade, &tr)
+	})
+
+	//assert
+	assert.Zero(t, bookUpdateAllocs)
+	assert.Zero(t, tradeAllocs)
+}
+
+func TestEntryPoolReusesPutSlices(t *testing.T) {
+	//arrange
+	var p entryPool
+	s := make([]BookEntry, 3, 10)
+
+	//act
+	p.put(s)
+	p.put(nil)
+	reused := p.get()
+	empty := p.get()
+
+	//assert
+	assert.Len(t, reused, 0)
+	assert.Equal(t, 10, cap(reused))
+	assert.Same(t, &s[0], &reused[:1][0])
+	assert.Nil(t, empty)
+}
+
+func TestEntryPoolHoldsAtMostMaxPooledEntries(t *testing.T) {
+	//arrange
+	var p entryPool
+
+	//act
+	for i := 0; i < maxPooledEntries+10; i++ {
+		p.put(make([]BookEntry, 0, 1))
+	}
+
+	//assert
+	assert.Len(t, p.free, maxPooledEntries)
+}
+
+func BenchmarkBookUpdateEncodingJSON(b *testing.B) {
+	payload := busyBookUpdate(20)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var bu BookUpdate
+		if err := json.Unmarshal(payload, &bu); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeBookUpdate(b *testing.B) {
+	payload := busyBookUpdate(20)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+
+	var bu BookUpdate
+	for i := 0; i < b.N; i++ {
+		if err := DecodeBookUpdate(payload, &bu); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeBookUpdatePooled(b *testing.B) {
+	payload := busyBookUpdate(20)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		bu, err := decodeBookUpdate(payload)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ReleaseBookUpdate(bu)
+	}
+}
+
+func BenchmarkTradeEncodingJSON(b *testing.B) {
+	payload := []byte(rawTrade)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var t Trade
+		if err := json.Unmarshal(payload, &t); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeTrade(b *testing.B) {
+	payload := []byte(rawTrade)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+
+	var t Trade
+	for i := 0; i < b.N; i++ {
+		if err := DecodeTrade(payload, &t); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
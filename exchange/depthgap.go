@@ -0,0 +1,84 @@
+package exchange
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// depthGapBuffer is how many gaps are held for a consumer before further gaps are dropped
+const depthGapBuffer = 16
+
+// DepthGap reports that book updates were missed, so any order book built from
+// them is no longer trustworthy and should be rebuilt from a fresh snapshot.
+// Expected is the first update ID that should have followed the last update,
+// and Received is the first update ID of the event that arrived instead.
+type DepthGap struct {
+	Symbol    string
+	EventTime int
+	Expected  int
+	Received  int
+}
+
+// gapDetector checks that each book update carries on from the last, i.e. that
+// its first update ID is no greater than the last update ID of the previous
+// update plus one
+type gapDetector struct {
+	last int
+	seen bool
+}
+
+// check records the update, returning the gap before it if there is one
+func (gd *gapDetector) check(b BookUpdate) (DepthGap, bool) {
+	defer func() {
+		gd.last = b.LastUpdateID
+		gd.seen = true
+	}()
+
+	if !gd.seen || b.FirstUpdateID <= gd.last+1 {
+		return DepthGap{}, false
+	}
+	return DepthGap{
+		Symbol:    b.Symbol,
+		EventTime: b.EventTime,
+		Expected:  gd.last + 1,
+		Received:  b.FirstUpdateID,
+	}, true
+}
+
+// gapChannel is the side channel gaps are reported on. Gaps never hold up the
+// book updates, so they're dropped if the channel is full. The zero value is
+// ready to use.
+type gapChannel struct {
+	init   sync.Once
+	ch     chan DepthGap
+	closer sync.Once
+}
+
+func (gc *gapChannel) channel() chan DepthGap {
+	gc.init.Do(func() {
+		gc.ch = make(chan DepthGap, depthGapBuffer)
+	})
+	return gc.ch
+}
+
+func (gc *gapChannel) report(gap DepthGap) {
+	log.Warn().
+		Str("symbol", gap.Symbol).
+		Int("expected", gap.Expected).
+		Int("received", gap.Received).
+		Msg("gap in book updates")
+
+	select {
+	case gc.channel() <- gap:
+	default:
+		log.Warn().Str("symbol", gap.Symbol).Msg("depth gap channel full, dropping gap")
+	}
+}
+
+// close closes the channel, which must only happen once nothing else can report
+func (gc *gapChannel) close() {
+	gc.closer.Do(func() {
+		close(gc.channel())
+	})
+}
@@ -0,0 +1,123 @@
+package exchange
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bookUpdateWithIDs(first int, last int) string {
+	b := strings.Replace(rawBookUpdate, `"U": 157`, fmt.Sprintf(`"U": %d`, first), 1)
+	return strings.Replace(b, `"u": 160`, fmt.Sprintf(`"u": %d`, last), 1)
+}
+
+func TestGapDetectorReportsUpdatesThatDoNotFollowOnFromTheLast(t *testing.T) {
+	var gd gapDetector
+
+	_, gap := gd.check(BookUpdate{FirstUpdateID: 157, LastUpdateID: 160})
+	assert.False(t, gap, "first update can't be checked")
+
+	_, gap = gd.check(BookUpdate{FirstUpdateID: 161, LastUpdateID: 165})
+	assert.False(t, gap)
+
+	_, gap = gd.check(BookUpdate{FirstUpdateID: 163, LastUpdateID: 167})
+	assert.False(t, gap, "overlapping updates miss nothing")
+
+	actual, gap := gd.check(BookUpdate{Symbol: "BNBBTC", EventTime: 123, FirstUpdateID: 170, LastUpdateID: 172})
+	assert.True(t, gap)
+	assert.Equal(t, DepthGap{Symbol: "BNBBTC", EventTime: 123, Expected: 168, Received: 170}, actual)
+
+	_, gap = gd.check(BookUpdate{FirstUpdateID: 173, LastUpdateID: 175})
+	assert.False(t, gap, "carries on from the update after the gap")
+}
+
+func TestGapChannelDropsGapsWhenFull(t *testing.T) {
+	var gc gapChannel
+
+	for i := 0; i < depthGapBuffer+5; i++ {
+		gc.report(DepthGap{Expected: i})
+	}
+	gc.close()
+
+	var received []int
+	for gap := range gc.channel() {
+		received = append(received, gap.Expected)
+	}
+	assert.Len(t, received, depthGapBuffer)
+	assert.Equal(t, 0, received[0])
+}
+
+func TestBinanceFeederDepthGapsReportsMissedBookUpdates(t *testing.T) {
+	//arrange
+	mc := make(chan string, 3)
+	defer close(mc)
+
+	ws := newTestServer(depthURL, mc)
+	defer ws.Close()
+
+	mc <- bookUpdateWithIDs(157, 160)
+	mc <- bookUpdateWithIDs(161, 162)
+	mc <- bookUpdateWithIDs(170, 175)
+
+	bf := newTestBinanceFeeder(ws, 0)
+	defer bf.Close()
+
+	//act
+	gaps := bf.DepthGaps()
+	buChan, err := bf.BookUpdates()
+
+	//assert
+	assert.NoError(t, err)
+	for _, id := range []int{160, 162, 175} {
+		assert.Equal(t, id, (<-buChan).LastUpdateID)
+	}
+
+	assert.Equal(t, DepthGap{Symbol: "BNBBTC", EventTime: 123456789, Expected: 163, Received: 170}, <-gaps)
+	assert.Len(t, gaps, 0)
+}
+
+func TestBinanceFeederCloseClosesDepthGapsChannel(t *testing.T) {
+	//arrange
+	bf := NewBinanceFeeder(testSymbol)
+	gaps := bf.DepthGaps()
+
+	//act
+	assert.NoError(t, bf.Close())
+	assert.NoError(t, bf.Close())
+
+	//assert
+	_, ok := <-gaps
+	assert.False(t, ok)
+}
+
+func TestBinanceMultiFeederDepthGapsReportsMissedBookUpdatesOfSymbol(t *testing.T) {
+	//arrange
+	mc := make(chan string, 3)
+	defer close(mc)
+
+	ws := newTestServer(combinedURL, mc)
+	defer ws.Close()
+
+	mf := newTestMultiFeeder(ws, "bnbbtc", "ethbtc")
+	defer mf.Close()
+	bnb, _ := mf.Feeder("bnbbtc")
+	eth, _ := mf.Feeder("ethbtc")
+
+	//act
+	bnbGaps := bnb.(DepthGapFeeder).DepthGaps()
+	ethGaps := eth.(DepthGapFeeder).DepthGaps()
+	buChan, err := bnb.BookUpdates()
+	assert.NoError(t, err)
+
+	mc <- combined("bnbbtc@depth@100ms", bookUpdateWithIDs(157, 160))
+	mc <- combined("bnbbtc@depth@100ms", bookUpdateWithIDs(165, 170))
+
+	//assert
+	assert.Equal(t, 160, (<-buChan).LastUpdateID)
+	assert.Equal(t, 170, (<-buChan).LastUpdateID)
+
+	assert.Equal(t, DepthGap{Symbol: "BNBBTC", EventTime: 123456789, Expected: 161, Received: 165}, <-bnbGaps)
+	assert.Len(t, ethGaps, 0)
+}
@@ -0,0 +1,174 @@
+package exchange
+
+import "strings"
+
+// Environment is a set of Binance hosts to connect to. StreamURL is the host of
+// the websocket market streams and RESTURL the host of the REST API.
+// ServerTimePath and ExchangeInfoPath are the REST API's server time and exchange
+// info paths, the spot API's if empty.
+type Environment struct {
+	StreamURL        string
+	RESTURL          string
+	ServerTimePath   string
+	ExchangeInfoPath string
+}
+
+var (
+	// Production is the Binance spot exchange
+	Production = Environment{StreamURL: BinanceURL, RESTURL: BinanceRESTURL}
+	// Testnet is the Binance spot test network
+	Testnet = Environment{StreamURL: "stream.testnet.binance.vision", RESTURL: "testnet.binance.vision"}
+	// US is the Binance.US exchange
+	US = Environment{StreamURL: "stream.binance.us:9443", RESTURL: "api.binance.us"}
+	// MarketData is the Binance spot exchange's hosts serving only public market data
+	MarketData = Environment{StreamURL: "data-stream.binance.vision", RESTURL: "data-api.binance.vision"}
+	// Futures is the Binance USDⓈ-M futures exchange
+	Futures = Environment{
+		StreamURL:        BinanceFuturesURL,
+		RESTURL:          BinanceFuturesRESTURL,
+		ServerTimePath:   futuresServerTimePath,
+		ExchangeInfoPath: futuresExchangeInfoPath,
+	}
+	// FuturesTestnet is the Binance USDⓈ-M futures test network
+	FuturesTestnet = Environment{
+		StreamURL:        "stream.binancefuture.com",
+		RESTURL:          "testnet.binancefuture.com",
+		ServerTimePath:   futuresServerTimePath,
+		ExchangeInfoPath: futuresExchangeInfoPath,
+	}
+)
+
+// Option configures a feeder made by NewBinanceFeeder, NewBinanceFuturesFeeder or
+// NewBinanceMultiFeederWithOptions
+type Option func(c *feederConfig)
+
+// feederConfig is what a feeder is made with, the defaults being those of Production
+type feederConfig struct {
+	baseURL       string
+	restURL       string
+	socketOptions *SocketConnectionOptions
+	bufferOptions *BufferOptions
+	rawPayloads   bool
+	clock         Clock
+}
+
+func newFeederConfig(opts []Option) feederConfig {
+	c := feederConfig{
+		baseURL:       Production.StreamURL,
+		restURL:       Production.RESTURL,
+		socketOptions: DefaultSocketOptions,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithEnvironment connects to the environment's hosts
+func WithEnvironment(env Environment) Option {
+	return func(c *feederConfig) {
+		c.baseURL = env.StreamURL
+		c.restURL = env.RESTURL
+	}
+}
+
+// WithBaseURL connects to the given websocket stream host, e.g. "stream.binance.com:9443"
+func WithBaseURL(host string) Option {
+	return func(c *feederConfig) {
+		c.baseURL = host
+	}
+}
+
+// WithRESTURL takes REST API requests made for the feed, such as order book
+// snapshots, to the given host, e.g. "api.binance.com"
+func WithRESTURL(host string) Option {
+	return func(c *feederConfig) {
+		c.restURL = host
+	}
+}
+
+// WithSocketOptions sets how the feeder's streams connect and reconnect
+func WithSocketOptions(opts *SocketConnectionOptions) Option {
+	return func(c *feederConfig) {
+		c.socketOptions = opts
+	}
+}
+
+// WithBufferOptions sets how the feeder's streams buffer events for a slow consumer
+func WithBufferOptions(opts *BufferOptions) Option {
+	return func(c *feederConfig) {
+		c.bufferOptions = opts
+	}
+}
+
+// WithRawPayloads keeps the JSON payload of each event received, for auditing,
+// in its Raw field
+func WithRawPayloads() Option {
+	return func(c *feederConfig) {
+		c.rawPayloads = true
+	}
+}
+
+// WithClock timestamps events received and measures their latency with the
+// clock, e.g. a started ClockSync so that they are in the exchange's time
+func WithClock(clock Clock) Option {
+	return func(c *feederConfig) {
+		c.clock = clock
+	}
+}
+
+// restURLer is implemented by feeds that know the REST API host of their exchange
+type restURLer interface {
+	RESTURL() string
+}
+
+// restURLOf returns the REST API host of the feed's exchange, Production's if unknown.
+// Feeds wrapping another feed, such as hubs, middleware and recorders, forward
+// it from the feed they wrap.
+func restURLOf(feed Feeder) string {
+	if r, ok := feed.(restURLer); ok && r.RESTURL() != "" {
+		return r.RESTURL()
+	}
+	return Production.RESTURL
+}
+
+// depthGapsOf returns the feed's channel of depth gaps, or nil if it doesn't
+// check book updates are in sequence
+func depthGapsOf(feed Feeder) <-chan DepthGap {
+	if g, ok := feed.(DepthGapFeeder); ok {
+		return g.DepthGaps()
+	}
+	return nil
+}
+
+// rawPayloadKeeper is implemented by feeds that can keep the raw payloads of
+// the events they receive from Binance
+type rawPayloadKeeper interface {
+	keepRawPayloads() bool
+}
+
+// keepRawPayloadsOf has the feed keep the raw payloads of events received from
+// now on, reporting whether it can. Feeds wrapping another feed forward it to
+// the feed they wrap.
+func keepRawPayloadsOf(feed Feeder) bool {
+	if k, ok := feed.(rawPayloadKeeper); ok {
+		return k.keepRawPayloads()
+	}
+	return false
+}
+
+// streamNamer is implemented by feeds that know the names Binance gives their
+// trade and book update streams
+type streamNamer interface {
+	streamNames() (trades string, bookUpdates string)
+}
+
+// streamNamesOf returns the names of the feed's trade and book update streams,
+// those of a spot market of its symbol if unknown
+func streamNamesOf(feed Feeder) (trades string, bookUpdates string) {
+	if n, ok := feed.(streamNamer); ok {
+		return n.streamNames()
+	}
+	symbol := strings.ToLower(feed.GetSymbol())
+	return tradeStream(symbol), depthStream(symbol)
+}
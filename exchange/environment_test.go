@@ -0,0 +1,115 @@
+package exchange
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBinanceFeederDefaultsToProduction(t *testing.T) {
+	//act
+	b := NewBinanceFeeder("BTCBNB")
+
+	//assert
+	assert.Equal(t, Production.StreamURL, b.baseURL)
+	assert.Equal(t, Production.RESTURL, b.RESTURL())
+	assert.Nil(t, b.bufferOptions)
+}
+
+func TestNewBinanceFeederWithEnvironmentUsesItsHosts(t *testing.T) {
+	for _, env := range []Environment{Production, Testnet, US, MarketData} {
+		//act
+		b := NewBinanceFeeder("BTCBNB", WithEnvironment(env))
+
+		//assert
+		assert.Equal(t, env.StreamURL, b.baseURL)
+		assert.Equal(t, env.RESTURL, b.RESTURL())
+	}
+}
+
+func TestNewBinanceFeederAppliesOptionsInOrder(t *testing.T) {
+	//arrange
+	socketOptions := &SocketConnectionOptions{BackOffTime: time.Second}
+
+	//act
+	b := NewBinanceFeeder("BTCBNB",
+		WithEnvironment(Testnet),
+		WithBaseURL("localhost:9443"),
+		WithSocketOptions(socketOptions),
+		WithBufferOptions(DefaultBufferOptions),
+	)
+
+	//assert
+	assert.Equal(t, "localhost:9443", b.baseURL)
+	assert.Equal(t, Testnet.RESTURL, b.RESTURL())
+	assert.Equal(t, socketOptions, b.socketOptions)
+	assert.Equal(t, DefaultBufferOptions, b.bufferOptions)
+}
+
+func TestNewBinanceMultiFeederWithOptionsUsesEnvironment(t *testing.T) {
+	//arrange
+	mf := NewBinanceMultiFeederWithOptions([]string{"BTCUSDT", "ETHUSDT"}, WithEnvironment(US))
+
+	//act
+	f, err := mf.Feeder("ethusdt")
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, US.StreamURL, mf.baseURL)
+	assert.Equal(t, US.RESTURL, restURLOf(f))
+	assert.Equal(t, []string{"btcusdt", "ethusdt"}, mf.GetSymbols())
+}
+
+func TestNewOrderBookTakesSnapshotsFromFeedsEnvironment(t *testing.T) {
+	//act
+	ob := NewOrderBook(NewBinanceFeeder("BTCUSDT", WithEnvironment(Testnet)))
+	other := NewOrderBook(newStubFeeder(testSymbol))
+
+	//assert
+	assert.Equal(t, Testnet.RESTURL, ob.rest.baseURL)
+	assert.Equal(t, Production.RESTURL, other.rest.baseURL)
+}
+
+func TestWrappedFeedsForwardTheirFeedsEnvironment(t *testing.T) {
+	//arrange
+	feed := NewBinanceFeeder("BTCUSDT", WithEnvironment(Testnet))
+	recorder, err := NewRecorder(feed, t.TempDir(), nil)
+	assert.NoError(t, err)
+	h := NewHub(feed, nil)
+
+	for name, wrapped := range map[string]Feeder{
+		"middleware":     Chain(feed, Throttle(time.Second), PriceBand(1)),
+		"hub":            h,
+		"hub subscriber": h.Subscribe(),
+		"recorder":       recorder,
+		"nested":         Chain(NewHub(recorder, nil), FilterTrades(nil)),
+	} {
+		//act
+		ob := NewOrderBook(wrapped)
+
+		//assert
+		assert.Equal(t, Testnet.RESTURL, ob.rest.baseURL, name)
+		assert.Equal(t, depthSnapshotPath, ob.snapshotPath, name)
+
+		gaps, ok := wrapped.(DepthGapFeeder)
+		assert.True(t, ok, name)
+		assert.Equal(t, feed.DepthGaps(), gaps.DepthGaps(), name)
+	}
+}
+
+func TestExchangeInfoClientSetEnvironmentFetchesFromItsRESTHost(t *testing.T) {
+	//arrange
+	server, rest := newTestRESTServer(exchangeInfoPath, `{"timezone":"UTC","symbols":[]}`)
+	defer server.Close()
+	c := NewExchangeInfoClient()
+
+	//act
+	c.SetEnvironment(Environment{RESTURL: strings.TrimPrefix(server.URL, "https://")})
+	c.rest.httpClient = rest.httpClient
+	err := c.Refresh()
+
+	//assert
+	assert.NoError(t, err)
+}
@@ -4,11 +4,11 @@ package exchange
 
 // MarketExchange structs implement the ability to manage orders and get exchange info
 type MarketExchange interface {
-	UpdateBid(orderID string, newPrice float64, newQuantity float64) error
-	UpdateAsk(orderID string, newPrice float64, newQuantity float64) error
-	OrderFulfilled(orderID string, price float64, quantity float64)
-	GetBestBid() float64
-	GetBestAsk() float64
+	UpdateBid(orderID string, newPrice Decimal, newQuantity Decimal) error
+	UpdateAsk(orderID string, newPrice Decimal, newQuantity Decimal) error
+	OrderFulfilled(orderID string, price Decimal, quantity Decimal)
+	GetBestBid() Decimal
+	GetBestAsk() Decimal
 }
 
 // TODO: implement MarketExchange interface on a new Exchange struct
@@ -0,0 +1,472 @@
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultExchangeInfoTTL is how long exchange info is cached before being refreshed
+	DefaultExchangeInfoTTL time.Duration = time.Hour
+
+	// SymbolStatusTrading is the status of symbols that orders can be placed on
+	SymbolStatusTrading string = "TRADING"
+
+	exchangeInfoPath        = "/api/v3/exchangeInfo"
+	futuresExchangeInfoPath = "/fapi/v1/exchangeInfo"
+)
+
+// Taken from https://binance-docs.github.io/apidocs/spot/en/#exchange-information
+// {
+//   "timezone": "UTC",
+//   "serverTime": 1565246363776,
+//   "rateLimits": [ { ... } ],
+//   "exchangeFilters": [],
+//   "symbols": [
+//     {
+//       "symbol": "ETHBTC",
+//       "status": "TRADING",
+//       "baseAsset": "ETH",
+//       "baseAssetPrecision": 8,
+//       "quoteAsset": "BTC",
+//       "quotePrecision": 8,
+//       "quoteAssetPrecision": 8,
+//       "orderTypes": ["LIMIT", "LIMIT_MAKER", "MARKET", ...],
+//       "icebergAllowed": true,
+//       "isSpotTradingAllowed": true,
+//       "filters": [ { "filterType": "PRICE_FILTER", ... }, ... ],
+//       "permissions": ["SPOT", "MARGIN"]
+//     }
+//   ]
+// }
+
+// ExchangeInfo contains the trading rules of the exchange and each of its symbols
+type ExchangeInfo struct {
+	Timezone   string       `json:"timezone"`
+	ServerTime int          `json:"serverTime"`
+	RateLimits []RateLimit  `json:"rateLimits"`
+	Symbols    []SymbolInfo `json:"symbols"`
+}
+
+// RateLimit is a limit on the requests or orders that can be made within an interval
+type RateLimit struct {
+	RateLimitType string `json:"rateLimitType"`
+	Interval      string `json:"interval"`
+	IntervalNum   int    `json:"intervalNum"`
+	Limit         int    `json:"limit"`
+}
+
+// SymbolInfo contains the trading rules of a symbol
+type SymbolInfo struct {
+	Symbol               string        `json:"symbol"`
+	Status               string        `json:"status"`
+	BaseAsset            string        `json:"baseAsset"`
+	BaseAssetPrecision   int           `json:"baseAssetPrecision"`
+	QuoteAsset           string        `json:"quoteAsset"`
+	QuoteAssetPrecision  int           `json:"quoteAssetPrecision"`
+	OrderTypes           []string      `json:"orderTypes"`
+	IcebergAllowed       bool          `json:"icebergAllowed"`
+	IsSpotTradingAllowed bool          `json:"isSpotTradingAllowed"`
+	Permissions          []string      `json:"permissions"`
+	Filters              SymbolFilters `json:"filters"`
+}
+
+// SymbolFilters holds the filters of a symbol, which are nil if the symbol
+// doesn't have them. See https://binance-docs.github.io/apidocs/spot/en/#filters
+type SymbolFilters struct {
+	Price              *PriceFilter
+	PercentPrice       *PercentPriceFilter
+	PercentPriceBySide *PercentPriceBySideFilter
+	LotSize            *LotSizeFilter
+	MarketLotSize      *LotSizeFilter
+	MinNotional        *MinNotionalFilter
+	Notional           *NotionalFilter
+	IcebergParts       *IcebergPartsFilter
+	MaxNumOrders       *MaxNumOrdersFilter
+	MaxNumAlgoOrders   *MaxNumOrdersFilter
+}
+
+// PriceFilter defines the price rules of a symbol. Each rule is disabled when zero.
+type PriceFilter struct {
+	MinPrice Decimal `json:"minPrice"`
+	MaxPrice Decimal `json:"maxPrice"`
+	TickSize Decimal `json:"tickSize"`
+}
+
+// PercentPriceFilter defines the range a price can be in, relative to the
+// average price over the last AvgPriceMins minutes
+type PercentPriceFilter struct {
+	MultiplierUp   Decimal `json:"multiplierUp"`
+	MultiplierDown Decimal `json:"multiplierDown"`
+	AvgPriceMins   int     `json:"avgPriceMins"`
+}
+
+// PercentPriceBySideFilter is a PercentPriceFilter with a different range for each side
+type PercentPriceBySideFilter struct {
+	BidMultiplierUp   Decimal `json:"bidMultiplierUp"`
+	BidMultiplierDown Decimal `json:"bidMultiplierDown"`
+	AskMultiplierUp   Decimal `json:"askMultiplierUp"`
+	AskMultiplierDown Decimal `json:"askMultiplierDown"`
+	AvgPriceMins      int     `json:"avgPriceMins"`
+}
+
+// LotSizeFilter defines the quantity rules of a symbol, for either all or market orders
+type LotSizeFilter struct {
+	MinQty   Decimal `json:"minQty"`
+	MaxQty   Decimal `json:"maxQty"`
+	StepSize Decimal `json:"stepSize"`
+}
+
+// MinNotionalFilter defines the minimum value (price * quantity) of an order
+type MinNotionalFilter struct {
+	MinNotional   Decimal `json:"minNotional"`
+	ApplyToMarket bool    `json:"applyToMarket"`
+	AvgPriceMins  int     `json:"avgPriceMins"`
+}
+
+// NotionalFilter defines the range of the value (price * quantity) of an order
+type NotionalFilter struct {
+	MinNotional      Decimal `json:"minNotional"`
+	ApplyMinToMarket bool    `json:"applyMinToMarket"`
+	MaxNotional      Decimal `json:"maxNotional"`
+	ApplyMaxToMarket bool    `json:"applyMaxToMarket"`
+	AvgPriceMins     int     `json:"avgPriceMins"`
+}
+
+// IcebergPartsFilter defines the most parts an iceberg order can have
+type IcebergPartsFilter struct {
+	Limit int `json:"limit"`
+}
+
+// MaxNumOrdersFilter defines the most orders that can be open on a symbol at once
+type MaxNumOrdersFilter struct {
+	MaxNumOrders     int `json:"maxNumOrders"`
+	MaxNumAlgoOrders int `json:"maxNumAlgoOrders"`
+}
+
+func (sf *SymbolFilters) UnmarshalJSON(buf []byte) error {
+	var filters []json.RawMessage
+	if err := json.Unmarshal(buf, &filters); err != nil {
+		return err
+	}
+
+	for _, raw := range filters {
+		var f struct {
+			FilterType string `json:"filterType"`
+		}
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return err
+		}
+
+		var v interface{}
+		switch f.FilterType {
+		case "PRICE_FILTER":
+			sf.Price = &PriceFilter{}
+			v = sf.Price
+		case "PERCENT_PRICE":
+			sf.PercentPrice = &PercentPriceFilter{}
+			v = sf.PercentPrice
+		case "PERCENT_PRICE_BY_SIDE":
+			sf.PercentPriceBySide = &PercentPriceBySideFilter{}
+			v = sf.PercentPriceBySide
+		case "LOT_SIZE":
+			sf.LotSize = &LotSizeFilter{}
+			v = sf.LotSize
+		case "MARKET_LOT_SIZE":
+			sf.MarketLotSize = &LotSizeFilter{}
+			v = sf.MarketLotSize
+		case "MIN_NOTIONAL":
+			sf.MinNotional = &MinNotionalFilter{}
+			v = sf.MinNotional
+		case "NOTIONAL":
+			sf.Notional = &NotionalFilter{}
+			v = sf.Notional
+		case "ICEBERG_PARTS":
+			sf.IcebergParts = &IcebergPartsFilter{}
+			v = sf.IcebergParts
+		case "MAX_NUM_ORDERS":
+			sf.MaxNumOrders = &MaxNumOrdersFilter{}
+			v = sf.MaxNumOrders
+		case "MAX_NUM_ALGO_ORDERS":
+			sf.MaxNumAlgoOrders = &MaxNumOrdersFilter{}
+			v = sf.MaxNumAlgoOrders
+		default:
+			continue
+		}
+
+		if err := json.Unmarshal(raw, v); err != nil {
+			return fmt.Errorf("error unmarshalling %s: %w", f.FilterType, err)
+		}
+	}
+	return nil
+}
+
+// FilterError reports an order that would be rejected by one of the symbol's filters
+type FilterError struct {
+	Symbol string
+	Filter string
+	Reason string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("order on %s fails %s: %s", e.Symbol, e.Filter, e.Reason)
+}
+
+// RoundOrder rounds a limit order's price to the tick size and its quantity to
+// the step size, counting steps from the minimum price and quantity as the
+// filters do. Bid prices are rounded down and ask prices up, so that the order
+// is never less favourable than asked for, and quantities are rounded down so
+// that no more than asked for is ever traded.
+// side is either Bid or Ask.
+func (si SymbolInfo) RoundOrder(side string, price Decimal, quantity Decimal) (Decimal, Decimal) {
+	if f := si.Filters.Price; f != nil {
+		if side == Bid {
+			price = price.Sub(f.MinPrice).FloorToStep(f.TickSize).Add(f.MinPrice)
+		} else {
+			price = price.Sub(f.MinPrice).CeilToStep(f.TickSize).Add(f.MinPrice)
+		}
+	}
+	if f := si.Filters.LotSize; f != nil {
+		quantity = quantity.Sub(f.MinQty).FloorToStep(f.StepSize).Add(f.MinQty)
+	}
+	return price, quantity
+}
+
+// ValidateOrder checks a limit order against the symbol's status and filters,
+// returning a *FilterError for the first one that would reject it.
+// side is either Bid or Ask. avgPrice is the symbol's current average price used
+// by the percent price filters, which are skipped when it is zero.
+func (si SymbolInfo) ValidateOrder(side string, price Decimal, quantity Decimal, avgPrice Decimal) error {
+	fail := func(filter string, format string, args ...interface{}) error {
+		return &FilterError{Symbol: si.Symbol, Filter: filter, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if si.Status != SymbolStatusTrading {
+		return fail("STATUS", "symbol status is %s", si.Status)
+	}
+	if side != Bid && side != Ask {
+		return fail("SIDE", "unknown side %q", side)
+	}
+
+	if f := si.Filters.Price; f != nil {
+		if !f.MinPrice.IsZero() && price.LessThan(f.MinPrice) {
+			return fail("PRICE_FILTER", "price %s is below the minimum %s", price, f.MinPrice)
+		}
+		if !f.MaxPrice.IsZero() && price.GreaterThan(f.MaxPrice) {
+			return fail("PRICE_FILTER", "price %s is above the maximum %s", price, f.MaxPrice)
+		}
+		if !price.Sub(f.MinPrice).IsMultipleOf(f.TickSize) {
+			return fail("PRICE_FILTER", "price %s is not a multiple of the tick size %s", price, f.TickSize)
+		}
+	}
+
+	if !avgPrice.IsZero() {
+		var up, down Decimal
+		filter := ""
+		if f := si.Filters.PercentPrice; f != nil {
+			up, down, filter = f.MultiplierUp, f.MultiplierDown, "PERCENT_PRICE"
+		}
+		if f := si.Filters.PercentPriceBySide; f != nil {
+			filter = "PERCENT_PRICE_BY_SIDE"
+			if side == Bid {
+				up, down = f.BidMultiplierUp, f.BidMultiplierDown
+			} else {
+				up, down = f.AskMultiplierUp, f.AskMultiplierDown
+			}
+		}
+		if filter != "" {
+			if max := avgPrice.Mul(up); price.GreaterThan(max) {
+				return fail(filter, "price %s is above %s, %s times the average price", price, max, up)
+			}
+			if min := avgPrice.Mul(down); price.LessThan(min) {
+				return fail(filter, "price %s is below %s, %s times the average price", price, min, down)
+			}
+		}
+	}
+
+	if f := si.Filters.LotSize; f != nil {
+		if quantity.LessThan(f.MinQty) {
+			return fail("LOT_SIZE", "quantity %s is below the minimum %s", quantity, f.MinQty)
+		}
+		if !f.MaxQty.IsZero() && quantity.GreaterThan(f.MaxQty) {
+			return fail("LOT_SIZE", "quantity %s is above the maximum %s", quantity, f.MaxQty)
+		}
+		if !quantity.Sub(f.MinQty).IsMultipleOf(f.StepSize) {
+			return fail("LOT_SIZE", "quantity %s is not a multiple of the step size %s", quantity, f.StepSize)
+		}
+	}
+
+	notional := price.Mul(quantity)
+	if f := si.Filters.MinNotional; f != nil && notional.LessThan(f.MinNotional) {
+		return fail("MIN_NOTIONAL", "value %s is below the minimum %s", notional, f.MinNotional)
+	}
+	if f := si.Filters.Notional; f != nil {
+		if notional.LessThan(f.MinNotional) {
+			return fail("NOTIONAL", "value %s is below the minimum %s", notional, f.MinNotional)
+		}
+		if !f.MaxNotional.IsZero() && notional.GreaterThan(f.MaxNotional) {
+			return fail("NOTIONAL", "value %s is above the maximum %s", notional, f.MaxNotional)
+		}
+	}
+
+	return nil
+}
+
+// PrepareOrder rounds a limit order with RoundOrder then validates it with
+// ValidateOrder, returning the price and quantity to pass on to
+// MarketExchange.UpdateBid or UpdateAsk
+func (si SymbolInfo) PrepareOrder(side string, price Decimal, quantity Decimal, avgPrice Decimal) (Decimal, Decimal, error) {
+	price, quantity = si.RoundOrder(side, price, quantity)
+	return price, quantity, si.ValidateOrder(side, price, quantity, avgPrice)
+}
+
+// ExchangeInfoClient fetches the trading rules of symbols from the Binance
+// REST API, caching them for a time to live. It is safe for concurrent use.
+type ExchangeInfoClient struct {
+	rest    *restClient
+	path    string
+	symbols []string
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu        sync.Mutex
+	info      ExchangeInfo
+	bySymbol  map[string]SymbolInfo
+	fetchedAt time.Time
+	fetching  chan struct{} // closed when the fetch in progress, if any, is done
+	fetchErr  error
+}
+
+// NewExchangeInfoClient returns a client for the trading rules of the given
+// symbols, or of every symbol on the exchange if none are given
+func NewExchangeInfoClient(symbols ...string) *ExchangeInfoClient {
+	c := &ExchangeInfoClient{
+		rest: newRESTClient(BinanceRESTURL),
+		path: exchangeInfoPath,
+		ttl:  DefaultExchangeInfoTTL,
+		now:  time.Now,
+	}
+	for _, s := range symbols {
+		c.symbols = append(c.symbols, strings.ToUpper(s))
+	}
+	return c
+}
+
+// SetTTL sets how long exchange info is cached before being refreshed
+func (c *ExchangeInfoClient) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// SetEnvironment sets which environment's REST API exchange info is fetched from,
+// taking effect from the next refresh
+func (c *ExchangeInfoClient) SetEnvironment(env Environment) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rest = newRESTClient(env.RESTURL)
+	c.path = env.ExchangeInfoPath
+	if c.path == "" {
+		c.path = exchangeInfoPath
+	}
+}
+
+// Refresh fetches the exchange info now, replacing the cache
+func (c *ExchangeInfoClient) Refresh() error {
+	return c.refresh()
+}
+
+// refresh fetches the exchange info without holding the lock, so that readers of
+// the cache aren't held up by a slow request. Concurrent refreshes share one fetch.
+func (c *ExchangeInfoClient) refresh() error {
+	c.mu.Lock()
+	if fetching := c.fetching; fetching != nil {
+		c.mu.Unlock()
+		<-fetching
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.fetchErr
+	}
+	fetching := make(chan struct{})
+	c.fetching = fetching
+	rest, path := c.rest, c.path
+	c.mu.Unlock()
+
+	query := url.Values{}
+	if len(c.symbols) > 0 {
+		symbols, _ := json.Marshal(c.symbols)
+		query.Set("symbols", string(symbols))
+	}
+	var info ExchangeInfo
+	err := rest.get(path, query, &info)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer close(fetching)
+
+	c.fetching = nil
+	c.fetchErr = err
+	if err != nil {
+		return err
+	}
+
+	c.info = info
+	c.bySymbol = make(map[string]SymbolInfo, len(info.Symbols))
+	for _, s := range info.Symbols {
+		c.bySymbol[s.Symbol] = s
+	}
+	c.fetchedAt = c.now()
+	return nil
+}
+
+// cached returns the cache, refreshing it first if it has expired. The stale cache
+// is used while another refresh is in progress, or if the refresh fails, so a
+// failed refresh is only returned if nothing has been cached yet.
+func (c *ExchangeInfoClient) cached() (ExchangeInfo, map[string]SymbolInfo, error) {
+	c.mu.Lock()
+	usable := c.bySymbol != nil && (c.fetching != nil || c.now().Sub(c.fetchedAt) < c.ttl)
+	info, bySymbol := c.info, c.bySymbol
+	c.mu.Unlock()
+	if usable {
+		return info, bySymbol, nil
+	}
+
+	err := c.refresh()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil && c.bySymbol == nil {
+		return ExchangeInfo{}, nil, err
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("error refreshing exchange info, using cached exchange info")
+	}
+	return c.info, c.bySymbol, nil
+}
+
+// ExchangeInfo returns the exchange info, fetching it if the cache has expired
+func (c *ExchangeInfoClient) ExchangeInfo() (ExchangeInfo, error) {
+	info, _, err := c.cached()
+	return info, err
+}
+
+// Symbol returns the trading rules of the symbol, fetching them if the cache has expired
+func (c *ExchangeInfoClient) Symbol(symbol string) (SymbolInfo, error) {
+	_, bySymbol, err := c.cached()
+	if err != nil {
+		return SymbolInfo{}, err
+	}
+
+	si, ok := bySymbol[strings.ToUpper(symbol)]
+	if !ok {
+		return SymbolInfo{}, fmt.Errorf("symbol %s not found in exchange info", symbol)
+	}
+	return si, nil
+}
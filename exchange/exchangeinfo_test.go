@@ -0,0 +1,413 @@
+package exchange
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testExchangeInfo = `{
+	"timezone": "UTC",
+	"serverTime": 1565246363776,
+	"rateLimits": [
+		{"rateLimitType": "REQUEST_WEIGHT", "interval": "MINUTE", "intervalNum": 1, "limit": 1200}
+	],
+	"exchangeFilters": [],
+	"symbols": [
+		{
+			"symbol": "BNBBTC",
+			"status": "TRADING",
+			"baseAsset": "BNB",
+			"baseAssetPrecision": 8,
+			"quoteAsset": "BTC",
+			"quotePrecision": 8,
+			"quoteAssetPrecision": 8,
+			"orderTypes": ["LIMIT", "LIMIT_MAKER", "MARKET"],
+			"icebergAllowed": true,
+			"isSpotTradingAllowed": true,
+			"permissions": ["SPOT"],
+			"filters": [
+				{"filterType": "PRICE_FILTER", "minPrice": "0.00000100", "maxPrice": "100000.00000000", "tickSize": "0.00000100"},
+				{"filterType": "PERCENT_PRICE", "multiplierUp": "5", "multiplierDown": "0.2", "avgPriceMins": 5},
+				{"filterType": "LOT_SIZE", "minQty": "0.01000000", "maxQty": "900000.00000000", "stepSize": "0.01000000"},
+				{"filterType": "MIN_NOTIONAL", "minNotional": "0.00010000", "applyToMarket": true, "avgPriceMins": 5},
+				{"filterType": "ICEBERG_PARTS", "limit": 10},
+				{"filterType": "MARKET_LOT_SIZE", "minQty": "0.00000000", "maxQty": "8000.00000000", "stepSize": "0.00000000"},
+				{"filterType": "TRAILING_DELTA", "minTrailingAboveDelta": 10},
+				{"filterType": "MAX_NUM_ORDERS", "maxNumOrders": 200},
+				{"filterType": "MAX_NUM_ALGO_ORDERS", "maxNumAlgoOrders": 5}
+			]
+		},
+		{
+			"symbol": "ETHBTC",
+			"status": "BREAK",
+			"filters": []
+		}
+	]
+}`
+
+func newTestExchangeInfoClient(rc *restClient) *ExchangeInfoClient {
+	c := NewExchangeInfoClient()
+	c.rest = rc
+	return c
+}
+
+func testSymbolInfo(t *testing.T) SymbolInfo {
+	server, rc := newTestRESTServer(exchangeInfoPath, testExchangeInfo)
+	defer server.Close()
+
+	si, err := newTestExchangeInfoClient(rc).Symbol("bnbbtc")
+	assert.NoError(t, err)
+	return si
+}
+
+func TestExchangeInfoClientDecodesSymbolFilters(t *testing.T) {
+	//act
+	si := testSymbolInfo(t)
+
+	//assert
+	assert.Equal(t, "BNBBTC", si.Symbol)
+	assert.Equal(t, SymbolStatusTrading, si.Status)
+	assert.Equal(t, "BNB", si.BaseAsset)
+	assert.Equal(t, []string{"LIMIT", "LIMIT_MAKER", "MARKET"}, si.OrderTypes)
+
+	f := si.Filters
+	assert.Equal(t, &PriceFilter{
+		MinPrice: MustParseDecimal("0.000001"),
+		MaxPrice: MustParseDecimal("100000"),
+		TickSize: MustParseDecimal("0.000001"),
+	}, f.Price)
+	assert.Equal(t, &PercentPriceFilter{
+		MultiplierUp:   MustParseDecimal("5"),
+		MultiplierDown: MustParseDecimal("0.2"),
+		AvgPriceMins:   5,
+	}, f.PercentPrice)
+	assert.Equal(t, &LotSizeFilter{
+		MinQty:   MustParseDecimal("0.01"),
+		MaxQty:   MustParseDecimal("900000"),
+		StepSize: MustParseDecimal("0.01"),
+	}, f.LotSize)
+	assert.Equal(t, &MinNotionalFilter{
+		MinNotional:   MustParseDecimal("0.0001"),
+		ApplyToMarket: true,
+		AvgPriceMins:  5,
+	}, f.MinNotional)
+	assert.Equal(t, &IcebergPartsFilter{Limit: 10}, f.IcebergParts)
+	assert.Equal(t, MustParseDecimal("8000"), f.MarketLotSize.MaxQty)
+	assert.Equal(t, 200, f.MaxNumOrders.MaxNumOrders)
+	assert.Equal(t, 5, f.MaxNumAlgoOrders.MaxNumAlgoOrders)
+	assert.Nil(t, f.Notional)
+	assert.Nil(t, f.PercentPriceBySide)
+}
+
+func TestExchangeInfoClientReturnsExchangeInfo(t *testing.T) {
+	//arrange
+	server, rc := newTestRESTServer(exchangeInfoPath, testExchangeInfo)
+	defer server.Close()
+
+	//act
+	info, err := newTestExchangeInfoClient(rc).ExchangeInfo()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, "UTC", info.Timezone)
+	assert.Equal(t, []RateLimit{{RateLimitType: "REQUEST_WEIGHT", Interval: "MINUTE", IntervalNum: 1, Limit: 1200}}, info.RateLimits)
+	assert.Len(t, info.Symbols, 2)
+}
+
+func TestExchangeInfoClientSetEnvironmentUsesItsExchangeInfoPath(t *testing.T) {
+	//arrange
+	server, rc := newTestRESTServer(futuresExchangeInfoPath, testExchangeInfo)
+	defer server.Close()
+
+	c := NewExchangeInfoClient()
+
+	//act
+	c.SetEnvironment(Futures)
+	c.rest = rc
+	info, err := c.ExchangeInfo()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Len(t, info.Symbols, 2)
+
+	c.SetEnvironment(Testnet)
+	assert.Equal(t, "testnet.binance.vision", c.rest.baseURL)
+	assert.Equal(t, exchangeInfoPath, c.path)
+}
+
+func TestExchangeInfoClientReturnsErrorForUnknownSymbol(t *testing.T) {
+	server, rc := newTestRESTServer(exchangeInfoPath, testExchangeInfo)
+	defer server.Close()
+
+	_, err := newTestExchangeInfoClient(rc).Symbol("xrpbtc")
+
+	assert.Error(t, err)
+}
+
+func TestExchangeInfoClientRequestsOnlyGivenSymbols(t *testing.T) {
+	//arrange
+	var query string
+	router := http.NewServeMux()
+	router.HandleFunc(exchangeInfoPath, func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("symbols")
+		w.Write([]byte(testExchangeInfo))
+	})
+	server := httptest.NewTLSServer(router)
+	defer server.Close()
+
+	c := NewExchangeInfoClient("bnbbtc", "ETHBTC")
+	c.rest = &restClient{baseURL: strings.TrimPrefix(server.URL, "https://"), httpClient: server.Client()}
+
+	//act
+	err := c.Refresh()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, `["BNBBTC","ETHBTC"]`, query)
+}
+
+func TestExchangeInfoClientCachesUntilTTLExpires(t *testing.T) {
+	//arrange
+	var mu sync.Mutex
+	calls := 0
+	router := http.NewServeMux()
+	router.HandleFunc(exchangeInfoPath, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(testExchangeInfo))
+	})
+	server := httptest.NewTLSServer(router)
+	defer server.Close()
+
+	c := NewExchangeInfoClient()
+	c.rest = &restClient{baseURL: strings.TrimPrefix(server.URL, "https://"), httpClient: server.Client()}
+	c.SetTTL(time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	//act & assert
+	_, err := c.Symbol("BNBBTC")
+	assert.NoError(t, err)
+	_, err = c.Symbol("ETHBTC")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls, "served from cache")
+
+	now = now.Add(time.Minute)
+	_, err = c.Symbol("BNBBTC")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls, "refreshed once expired")
+
+	now = now.Add(time.Minute)
+	_, err = c.Symbol("BNBBTC")
+	assert.NoError(t, err, "stale cache used when refresh fails")
+	assert.Equal(t, 3, calls)
+}
+
+func TestExchangeInfoClientReturnsErrorWhenFirstFetchFails(t *testing.T) {
+	router := http.NewServeMux()
+	router.HandleFunc(exchangeInfoPath, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	server := httptest.NewTLSServer(router)
+	defer server.Close()
+
+	c := NewExchangeInfoClient()
+	c.rest = &restClient{baseURL: strings.TrimPrefix(server.URL, "https://"), httpClient: server.Client()}
+
+	_, err := c.Symbol("BNBBTC")
+
+	assert.Error(t, err)
+}
+
+func TestExchangeInfoClientServesCacheWhileRefreshing(t *testing.T) {
+	//arrange
+	release := make(chan struct{})
+	var mu sync.Mutex
+	calls := 0
+	router := http.NewServeMux()
+	router.HandleFunc(exchangeInfoPath, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		slow := calls > 1
+		mu.Unlock()
+		if slow {
+			<-release
+		}
+		w.Write([]byte(testExchangeInfo))
+	})
+	server := httptest.NewTLSServer(router)
+	defer server.Close()
+
+	c := NewExchangeInfoClient()
+	c.rest = &restClient{baseURL: strings.TrimPrefix(server.URL, "https://"), httpClient: server.Client()}
+	assert.NoError(t, c.Refresh())
+
+	//act
+	refreshed := make(chan error)
+	go func() {
+		refreshed <- c.Refresh()
+	}()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls == 2
+	}, time.Second, time.Millisecond)
+
+	si, err := c.Symbol("BNBBTC")
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, "BNBBTC", si.Symbol)
+
+	close(release)
+	assert.NoError(t, <-refreshed)
+}
+
+func TestSymbolInfoRoundOrderRoundsInTheOrdersFavour(t *testing.T) {
+	si := testSymbolInfo(t)
+
+	price, quantity := si.RoundOrder(Bid, MustParseDecimal("0.00123456789"), MustParseDecimal("1.239"))
+	assert.Equal(t, MustParseDecimal("0.001234"), price)
+	assert.Equal(t, MustParseDecimal("1.23"), quantity)
+
+	price, quantity = si.RoundOrder(Ask, MustParseDecimal("0.00123456789"), MustParseDecimal("1.239"))
+	assert.Equal(t, MustParseDecimal("0.001235"), price)
+	assert.Equal(t, MustParseDecimal("1.23"), quantity)
+}
+
+func TestSymbolInfoRoundOrderCountsStepsFromTheMinimum(t *testing.T) {
+	//arrange
+	si := SymbolInfo{
+		Symbol: "OFFSETBTC",
+		Status: SymbolStatusTrading,
+		Filters: SymbolFilters{
+			Price:   &PriceFilter{MinPrice: MustParseDecimal("0.015"), TickSize: MustParseDecimal("0.01")},
+			LotSize: &LotSizeFilter{MinQty: MustParseDecimal("0.005"), StepSize: MustParseDecimal("0.01")},
+		},
+	}
+
+	//act
+	bidPrice, quantity, err := si.PrepareOrder(Bid, MustParseDecimal("1.234"), MustParseDecimal("2.5"), Decimal{})
+	askPrice, _, err2 := si.PrepareOrder(Ask, MustParseDecimal("1.234"), MustParseDecimal("2.5"), Decimal{})
+
+	//assert
+	assert.NoError(t, err)
+	assert.NoError(t, err2)
+	assert.True(t, MustParseDecimal("1.225").Equal(bidPrice), bidPrice.String())
+	assert.True(t, MustParseDecimal("1.235").Equal(askPrice), askPrice.String())
+	assert.True(t, MustParseDecimal("2.495").Equal(quantity), quantity.String())
+}
+
+func TestSymbolInfoValidateOrderAcceptsValidOrder(t *testing.T) {
+	si := testSymbolInfo(t)
+
+	err := si.ValidateOrder(Bid, MustParseDecimal("0.001234"), MustParseDecimal("1.23"), MustParseDecimal("0.0012"))
+
+	assert.NoError(t, err)
+}
+
+func TestSymbolInfoValidateOrderRejectsOrdersFailingFilters(t *testing.T) {
+	si := testSymbolInfo(t)
+	avg := MustParseDecimal("0.001")
+
+	tests := []struct {
+		price    string
+		quantity string
+		filter   string
+	}{
+		{"0.0000001", "1", "PRICE_FILTER"},
+		{"100001", "1", "PRICE_FILTER"},
+		{"0.0012345", "1", "PRICE_FILTER"},
+		{"0.006", "1", "PERCENT_PRICE"},
+		{"0.000199", "1", "PERCENT_PRICE"},
+		{"0.001", "0.001", "LOT_SIZE"},
+		{"0.001", "900001", "LOT_SIZE"},
+		{"0.001", "1.234", "LOT_SIZE"},
+		{"0.001", "0.05", "MIN_NOTIONAL"},
+	}
+
+	for _, tt := range tests {
+		err := si.ValidateOrder(Ask, MustParseDecimal(tt.price), MustParseDecimal(tt.quantity), avg)
+
+		var fe *FilterError
+		if assert.True(t, errors.As(err, &fe), tt) {
+			assert.Equal(t, tt.filter, fe.Filter, tt)
+			assert.Equal(t, "BNBBTC", fe.Symbol)
+		}
+	}
+}
+
+func TestSymbolInfoValidateOrderSkipsPercentPriceWithoutAveragePrice(t *testing.T) {
+	si := testSymbolInfo(t)
+
+	err := si.ValidateOrder(Bid, MustParseDecimal("1"), MustParseDecimal("1"), Decimal{})
+
+	assert.NoError(t, err)
+}
+
+func TestSymbolInfoValidateOrderUsesPercentPriceBySide(t *testing.T) {
+	si := SymbolInfo{
+		Symbol: "BNBBTC",
+		Status: SymbolStatusTrading,
+		Filters: SymbolFilters{
+			PercentPriceBySide: &PercentPriceBySideFilter{
+				BidMultiplierUp:   MustParseDecimal("1.1"),
+				BidMultiplierDown: MustParseDecimal("0.5"),
+				AskMultiplierUp:   MustParseDecimal("2"),
+				AskMultiplierDown: MustParseDecimal("0.9"),
+			},
+		},
+	}
+	avg := MustParseDecimal("10")
+
+	assert.Error(t, si.ValidateOrder(Bid, MustParseDecimal("12"), MustParseDecimal("1"), avg))
+	assert.NoError(t, si.ValidateOrder(Ask, MustParseDecimal("12"), MustParseDecimal("1"), avg))
+	assert.NoError(t, si.ValidateOrder(Bid, MustParseDecimal("6"), MustParseDecimal("1"), avg))
+	assert.Error(t, si.ValidateOrder(Ask, MustParseDecimal("6"), MustParseDecimal("1"), avg))
+}
+
+func TestSymbolInfoValidateOrderUsesNotional(t *testing.T) {
+	si := SymbolInfo{
+		Symbol: "BNBBTC",
+		Status: SymbolStatusTrading,
+		Filters: SymbolFilters{
+			Notional: &NotionalFilter{MinNotional: MustParseDecimal("10"), MaxNotional: MustParseDecimal("100")},
+		},
+	}
+
+	assert.Error(t, si.ValidateOrder(Bid, MustParseDecimal("9"), MustParseDecimal("1"), Decimal{}))
+	assert.NoError(t, si.ValidateOrder(Bid, MustParseDecimal("50"), MustParseDecimal("2"), Decimal{}))
+	assert.Error(t, si.ValidateOrder(Bid, MustParseDecimal("50"), MustParseDecimal("2.1"), Decimal{}))
+}
+
+func TestSymbolInfoValidateOrderRejectsSymbolsNotTrading(t *testing.T) {
+	si := SymbolInfo{Symbol: "ETHBTC", Status: "BREAK"}
+
+	err := si.ValidateOrder(Bid, MustParseDecimal("1"), MustParseDecimal("1"), Decimal{})
+
+	assert.EqualError(t, err, "order on ETHBTC fails STATUS: symbol status is BREAK")
+}
+
+func TestSymbolInfoPrepareOrderRoundsThenValidates(t *testing.T) {
+	si := testSymbolInfo(t)
+
+	price, quantity, err := si.PrepareOrder(Bid, MustParseDecimal("0.0012349"), MustParseDecimal("2.005"), Decimal{})
+	assert.NoError(t, err)
+	assert.Equal(t, MustParseDecimal("0.001234"), price)
+	assert.Equal(t, MustParseDecimal("2"), quantity)
+
+	_, _, err = si.PrepareOrder(Bid, MustParseDecimal("0.001"), MustParseDecimal("0.009"), Decimal{})
+	assert.Error(t, err)
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -25,18 +27,51 @@ const (
 
 var (
 	errDialConnection = errors.New("Failed to establish a connection")
+	errFeederClosed   = errors.New("Feeder has been closed")
 )
 
 // Feeder is an interface for market exchange feeds
 // Trades returns a channel of Trades made in the market
 // BookUpdates returns a channel of batched BookUpdates indicating market order book activity
+// Close stops the feeds, closing every channel returned
 type Feeder interface {
 	Trades() (<-chan Trade, error)
 	BookUpdates() (<-chan BookUpdate, error)
 	GetSymbol() string
+	Close() error
 }
 
-// Taken from https://binance-docs.github.io/apidocs/spot/en/#aggregate-trade-streams
+// AggTradeFeeder is an interface for feeds of aggregated trades
+// AggTrades returns a channel of trades aggregated by taker order and price
+type AggTradeFeeder interface {
+	AggTrades() (<-chan AggTrade, error)
+}
+
+// KlineFeeder is an interface for feeds of candlestick bars
+// Klines returns a channel of updates to the current bar of the given interval
+type KlineFeeder interface {
+	Klines(interval KlineInterval) (<-chan Kline, error)
+}
+
+// BookTickerFeeder is an interface for feeds of the best bid & ask in the market
+// BookTicker returns a channel of updates to the best bid or ask price or quantity
+type BookTickerFeeder interface {
+	BookTicker() (<-chan BookTicker, error)
+}
+
+// PartialDepthFeeder is an interface for feeds of the top levels of the order book
+// PartialDepth returns a channel of snapshots of the top levels of the order book
+type PartialDepthFeeder interface {
+	PartialDepth(levels int, speed UpdateSpeed) (<-chan DepthSnapshot, error)
+}
+
+// DepthGapFeeder is an interface for feeds that check book updates are in sequence
+// DepthGaps returns a channel of gaps found between consecutive book updates
+type DepthGapFeeder interface {
+	DepthGaps() <-chan DepthGap
+}
+
+// Taken from https://binance-docs.github.io/apidocs/spot/en/#trade-streams
 // {
 //   "e": "trade",     // Event type
 //   "E": 123456789,   // Event time
@@ -51,20 +86,45 @@ type Feeder interface {
 //   "M": true         // Ignore
 // }
 
-// Trade contains information about a completed trade
+// Trade contains information about a completed trade. ReceivedAt is the local time
+// the trade was received from Binance, and Raw its JSON payload if the feeder was
+// made WithRawPayloads. Both are zero for trades not received from Binance, such
+// as replayed or synthetic trades.
 type Trade struct {
-	// Have to include json:"e" even though not wanted as encoding/json Unmarshal() has a bug with case-sensitivity on named parameters
+	// Have to include json:"e" & json:"M" even though not wanted as encoding/json Unmarshal() has a bug with case-sensitivity on named parameters
 	// Issue discussed here: https://github.com/golang/go/issues/14750
 	// Watching proposed change to package here: https://go-review.googlesource.com/c/go/+/224079/
-	Type string `json:"e"` // Will always be "trade"
+	Type   string `json:"e"` // Will always be "trade"
+	Ignore bool   `json:"M"`
 
+	Symbol        string  `json:"s"`
 	ID            int     `json:"t"`
 	BuyerOrderID  int     `json:"b"`
 	SellerOrderID int     `json:"a"`
 	TradeTime     int     `json:"T"`
 	EventTime     int     `json:"E"`
-	Price         float64 `json:"p,string"`
-	Quantity      float64 `json:"q,string"`
+	Price         Decimal `json:"p"`
+	Quantity      Decimal `json:"q"`
+	IsBuyerMaker  bool    `json:"m"`
+
+	ReceivedAt time.Time       `json:"-"`
+	Raw        json.RawMessage `json:"-"`
+}
+
+// AggressorSide returns the side of the taker's order, Bid if a buy order took
+// liquidity and Ask if a sell order did
+func (t Trade) AggressorSide() string {
+	return aggressorSide(t.IsBuyerMaker)
+}
+
+// EventTimestamp returns the trade's event time
+func (t Trade) EventTimestamp() time.Time {
+	return msTime(t.EventTime)
+}
+
+// TradeTimestamp returns the time the trade was made
+func (t Trade) TradeTimestamp() time.Time {
+	return msTime(t.TradeTime)
 }
 
 // Taken from https://binance-docs.github.io/apidocs/spot/en/#diff-depth-stream
@@ -95,61 +155,154 @@ type BookUpdate struct {
 	// Watching proposed change to package here: https://go-review.googlesource.com/c/go/+/224079/
 	Type string `json:"e"` // Will always be "depthUpdate"
 
-	EventTime    int         `json:"E"`
-	Bids         []BookEntry `json:"b"`
-	Asks         []BookEntry `json:"a"`
-	LastUpdateID int         `json:"u"` // Final update ID in event
+	EventTime     int         `json:"E"`
+	Symbol        string      `json:"s"`
+	Bids          []BookEntry `json:"b"`
+	Asks          []BookEntry `json:"a"`
+	FirstUpdateID int         `json:"U"` // First update ID in event
+	LastUpdateID  int         `json:"u"` // Final update ID in event
+
+	ReceivedAt time.Time       `json:"-"` // as for Trade
+	Raw        json.RawMessage `json:"-"` // as for Trade, nil for updates merged from many
+}
+
+// EventTimestamp returns the update's event time
+func (b BookUpdate) EventTimestamp() time.Time {
+	return msTime(b.EventTime)
+}
+
+func aggressorSide(isBuyerMaker bool) string {
+	if isBuyerMaker {
+		return Ask
+	}
+	return Bid
+}
+
+// msTime returns the time of a Binance timestamp in Unix milliseconds
+func msTime(ms int) time.Time {
+	return time.Unix(0, int64(ms)*int64(time.Millisecond))
 }
 
 type BookEntry struct {
-	Price    float64
-	Quantity float64
+	Price    Decimal
+	Quantity Decimal
 }
 
 func (be *BookEntry) UnmarshalJSON(buf []byte) error {
-	var tmp []json.Number
+	var tmp []Decimal
 
-	var err error
-	if err = json.Unmarshal(buf, &tmp); err != nil {
+	if err := json.Unmarshal(buf, &tmp); err != nil {
 		return err
 	}
 	if numFields := len(tmp); numFields != 2 {
 		return fmt.Errorf("wrong number of fields in bookEntry: %d != 2", numFields)
 	}
 
-	if be.Price, err = tmp[0].Float64(); err != nil {
-		return err
-	}
-	if be.Quantity, err = tmp[1].Float64(); err != nil {
-		return err
-	}
-
+	be.Price = tmp[0]
+	be.Quantity = tmp[1]
 	return nil
 }
 
+// MarshalJSON encodes the entry as Binance does, as a [price, quantity] pair
+func (be BookEntry) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]Decimal{be.Price, be.Quantity})
+}
+
 type binanceFeeder struct {
 	baseURL       string
+	restURL       string
 	socketOptions *SocketConnectionOptions
+	bufferOptions *BufferOptions
+	rawPayloads   bool
+	clock         Clock
 	symbol        string
+	metrics       *FeedMetrics
+
+	lc   lifecycle
+	gaps gapChannel
+
+	mu             sync.Mutex
+	tradePipe      *eventPipe
+	bookUpdatePipe *eventPipe
 }
 
+// SocketConnectionOptions configures how streams connect and reconnect.
+// MaxRetries and BackOffTime give a fixed back off policy, used when no
+// ReconnectPolicy is set and otherwise ignored.
+// DialPolicy decides the retries of a stream's first connection, which the
+// request for the stream waits on, so should give up eventually. The reconnect
+// policy is used when it is nil.
+// RolloverAfter is how long a connection is used before it is replaced,
+// as Binance disconnects every connection after 24 hours.
+// ReadTimeout is how long a connection can go without receiving anything,
+// including pings and pongs, before it is considered dead.
+// PingInterval is how often pings are sent to the server.
+// Each of these is disabled when zero.
 type SocketConnectionOptions struct {
-	Dialer      *websocket.Dialer
-	MaxRetries  int
-	BackOffTime time.Duration
+	Dialer          *websocket.Dialer
+	MaxRetries      int
+	BackOffTime     time.Duration
+	ReconnectPolicy ReconnectPolicy
+	DialPolicy      ReconnectPolicy
+	RolloverAfter   time.Duration
+	ReadTimeout     time.Duration
+	PingInterval    time.Duration
 }
 
 var DefaultSocketOptions = &SocketConnectionOptions{
-	Dialer:      websocket.DefaultDialer,
-	MaxRetries:  5,
-	BackOffTime: 5 * time.Second,
+	Dialer: websocket.DefaultDialer,
+	ReconnectPolicy: &FullJitter{
+		Policy: &ExponentialBackOff{
+			Initial:    time.Second,
+			Max:        time.Minute,
+			Multiplier: 2,
+			MaxRetries: UnlimitedRetries,
+		},
+	},
+	DialPolicy: &FullJitter{
+		Policy: &ExponentialBackOff{
+			Initial:    time.Second,
+			Max:        time.Minute,
+			Multiplier: 2,
+			MaxRetries: 5,
+		},
+	},
+	RolloverAfter: 23*time.Hour + 50*time.Minute,
+	ReadTimeout:   5 * time.Minute,
+	PingInterval:  time.Minute,
 }
 
-func NewBinanceFeeder(symbol string) *binanceFeeder {
+func (so *SocketConnectionOptions) reconnectPolicy() ReconnectPolicy {
+	if so.ReconnectPolicy != nil {
+		return so.ReconnectPolicy
+	}
+	return &FixedBackOff{Interval: so.BackOffTime, MaxRetries: so.MaxRetries}
+}
+
+func (so *SocketConnectionOptions) dialPolicy() ReconnectPolicy {
+	if so.DialPolicy != nil {
+		return so.DialPolicy
+	}
+	return so.reconnectPolicy()
+}
+
+// NewBinanceFeeder returns a feeder of the symbol's streams, connecting to
+// Production unless configured otherwise by the options
+func NewBinanceFeeder(symbol string, opts ...Option) *binanceFeeder {
+	c := newFeederConfig(opts)
+	metrics := NewFeedMetrics(symbol)
+	if c.clock != nil {
+		metrics.SetClock(c.clock)
+	}
 	return &binanceFeeder{
-		baseURL:       BinanceURL,
-		socketOptions: DefaultSocketOptions,
+		baseURL:       c.baseURL,
+		restURL:       c.restURL,
+		socketOptions: c.socketOptions,
+		bufferOptions: c.bufferOptions,
+		rawPayloads:   c.rawPayloads,
+		clock:         c.clock,
 		symbol:        symbol,
+		metrics:       metrics,
 	}
 }
 
@@ -157,97 +310,232 @@ func (bf *binanceFeeder) GetSymbol() string {
 	return bf.symbol
 }
 
-func (bf *binanceFeeder) connectAndListen(url string, mChan chan []byte, attempt int) error {
-	log.Info().Msgf("connecting to %s", url)
-
-	var err error
-	var conn *websocket.Conn
-	for attempt <= bf.socketOptions.MaxRetries {
-		conn, _, err = bf.socketOptions.Dialer.Dial(url, nil)
-		if err == nil {
-			log.Info().Msgf("successfully connected to %s", url)
-			break
-		} else {
-			log.Error().Err(err).Msg("connection error")
-			attempt++
-			time.Sleep(bf.socketOptions.BackOffTime)
-		}
-	}
-	if err != nil {
-		close(mChan)
-		log.Error().Msg("max retries reached")
-		return errDialConnection
+// RESTURL returns the REST API host of the feeder's exchange
+func (bf *binanceFeeder) RESTURL() string {
+	return bf.restURL
+}
+
+func (bf *binanceFeeder) keepRawPayloads() bool {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	bf.rawPayloads = true
+	return true
+}
+
+func (bf *binanceFeeder) streamNames() (string, string) {
+	symbol := strings.ToLower(bf.symbol)
+	return tradeStream(symbol), depthStream(symbol)
+}
+
+// SetBufferOptions sets how streams requested from now on buffer events for a slow
+// consumer. Streams are unbuffered by default.
+func (bf *binanceFeeder) SetBufferOptions(opts *BufferOptions) {
+	bf.bufferOptions = opts
+}
+
+// TradeBufferStats returns the trades discarded by the trade stream's buffer
+func (bf *binanceFeeder) TradeBufferStats() BufferStats {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+
+	if bf.tradePipe == nil {
+		return BufferStats{}
 	}
+	return bf.tradePipe.counts()
+}
 
-	go func() {
-		defer conn.Close()
-		for {
-			_, message, err := conn.ReadMessage()
-			if err != nil {
-				log.Error().Err(err).Msg("error on read")
-				if attempt == bf.socketOptions.MaxRetries {
-					log.Error().Msg("max retries reached")
-					close(mChan)
-					return
-				}
-				attempt++
-				time.Sleep(bf.socketOptions.BackOffTime)
-				go bf.connectAndListen(url, mChan, attempt)
-				return
-			}
+// BookUpdateBufferStats returns the book updates discarded or conflated by the
+// book update stream's buffer
+func (bf *binanceFeeder) BookUpdateBufferStats() BufferStats {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
 
-			attempt = 0
-			mChan <- message
-		}
-	}()
+	if bf.bookUpdatePipe == nil {
+		return BufferStats{}
+	}
+	return bf.bookUpdatePipe.counts()
+}
 
+// Metrics returns the latency and throughput metrics of the feeder's streams
+func (bf *binanceFeeder) Metrics() *FeedMetrics {
+	return bf.metrics
+}
+
+// Close disconnects every stream of the feeder and closes their channels,
+// returning once all of the feeder's goroutines have stopped
+func (bf *binanceFeeder) Close() error {
+	bf.lc.close()
+	bf.gaps.close()
 	return nil
 }
 
+// listen connects to the named stream of the feeder's symbol, returning a
+// channel of the raw messages received
+func (bf *binanceFeeder) listen(stream string) (chan []byte, error) {
+	return bf.listenTo(fmt.Sprintf("%s@%s", bf.symbol, stream))
+}
+
+// listenTo connects to the stream of the given full name
+func (bf *binanceFeeder) listenTo(stream string) (chan []byte, error) {
+	u := url.URL{Scheme: "wss", Host: bf.baseURL, Path: "ws/" + stream}
+
+	mChan := make(chan []byte)
+	err := connectAndListen(&bf.lc, bf.socketOptions, u.String(), mChan, bf.metrics.reconnected)
+	return mChan, err
+}
+
+// receipt is when a message was received, and its payload if the feeder keeps them
+type receipt struct {
+	at  time.Time
+	raw json.RawMessage
+}
+
+// streamEvent is an event decoded from a message. Its sequence number orders
+// the events of its stream, and its event time, in Unix milliseconds, is zero
+// for events without one.
+type streamEvent struct {
+	event     interface{}
+	seqNo     int
+	eventTime int
+}
+
+// read decodes each message received on the named stream until the channel is
+// closed, given when it was received, and sends on the events that weren't
+// received before until send returns false. Messages that can't be decoded are
+// logged as the kind of event. Duplicates aren't measured by the stream's metrics.
+func (bf *binanceFeeder) read(mChan <-chan []byte, stream string, kind string,
+	decode func(message []byte, r receipt) (streamEvent, error), send func(e interface{}) bool) {
+	bf.mu.Lock()
+	keepRaw := bf.rawPayloads
+	bf.mu.Unlock()
+
+	var seq sequencer
+	for message := range mChan {
+		r := receipt{at: timeOf(bf.clock)}
+		if keepRaw {
+			r.raw = message
+		}
+		e, err := decode(message, r)
+		if err != nil {
+			bf.metrics.message(stream)
+			bf.metrics.decodeError(stream)
+			log.Error().Err(err).
+				Str("detail", string(message)).
+				Msgf("error unmarshalling %s", kind)
+			continue
+		}
+		if !seq.next(e.seqNo) {
+			continue
+		}
+		bf.metrics.message(stream)
+		if e.eventTime != 0 {
+			bf.metrics.received(stream, e.eventTime)
+		}
+		if !send(e.event) {
+			return
+		}
+	}
+}
+
 // Trades returns a read-only channel of trades made on the market
 func (bf *binanceFeeder) Trades() (<-chan Trade, error) {
-	u := url.URL{Scheme: "wss", Host: bf.baseURL, Path: fmt.Sprintf("ws/%s@trade", bf.symbol)}
+	return bf.trades("trade", decodeTrade)
+}
 
-	mChan := make(chan []byte)
-	err := bf.connectAndListen(u.String(), mChan, 0)
+func decodeTrade(message []byte) (Trade, error) {
+	var t Trade
+	err := DecodeTrade(message, &t)
+	return t, err
+}
+
+// trades returns a channel of the trades decoded from the named stream
+func (bf *binanceFeeder) trades(stream string, decode func(message []byte) (Trade, error)) (<-chan Trade, error) {
+	mChan, err := bf.listen(stream)
 
 	tChan := make(chan Trade)
-	go func() {
-		defer close(tChan)
-		for message := range mChan {
-			var t Trade
-			if err := json.Unmarshal(message, &t); err != nil {
-				log.Error().Err(err).
-					Str("detail", string(message)).
-					Msgf("error unmarshalling trade")
-				continue
+	out := newEventPipe(&bf.lc, bf.bufferOptions, nil,
+		func(e interface{}) bool {
+			select {
+			case tChan <- e.(Trade):
+				return true
+			case <-bf.lc.done():
+				return false
 			}
-			tChan <- t
-		}
-	}()
+		},
+		func() { close(tChan) })
+
+	bf.mu.Lock()
+	bf.tradePipe = out
+	bf.mu.Unlock()
+	bf.metrics.setBacklog(TradeStreamMetrics, out.backlog)
+
+	bf.lc.goroutine(func() {
+		defer out.close()
+		bf.read(mChan, TradeStreamMetrics, "trade", func(message []byte, r receipt) (streamEvent, error) {
+			t, err := decode(message)
+			t.ReceivedAt, t.Raw = r.at, r.raw
+			return streamEvent{event: t, seqNo: t.ID, eventTime: t.EventTime}, err
+		}, out.push)
+	})
 	return tChan, err
 }
 
 // BookUpdates returns a read-only channel of updates made on the orderbook in the market.
+// Any gaps between consecutive updates are reported on the DepthGaps channel.
+// Updates can be handed back with ReleaseBookUpdate once used, to save on garbage.
 func (bf *binanceFeeder) BookUpdates() (<-chan BookUpdate, error) {
-	u := url.URL{Scheme: "wss", Host: bf.baseURL, Path: fmt.Sprintf("ws/%s@depth@100ms", bf.symbol)}
+	return bf.bookUpdates(fmt.Sprintf("depth@%s", Speed100ms), decodeBookUpdate)
+}
 
-	mChan := make(chan []byte)
-	err := bf.connectAndListen(u.String(), mChan, 0)
+// decodeBookUpdate decodes a book update into entry slices released by earlier
+// updates, if there are any
+func decodeBookUpdate(message []byte) (BookUpdate, error) {
+	b := BookUpdate{Bids: bookEntryPool.get(), Asks: bookEntryPool.get()}
+	err := DecodeBookUpdate(message, &b)
+	return b, err
+}
+
+// bookUpdates returns a channel of the book updates decoded from the named stream
+func (bf *binanceFeeder) bookUpdates(stream string, decode func(message []byte) (BookUpdate, error)) (<-chan BookUpdate, error) {
+	mChan, err := bf.listen(stream)
 
 	buChan := make(chan BookUpdate)
-	go func() {
-		defer close(buChan)
-		for message := range mChan {
-			var b BookUpdate
-			if err := json.Unmarshal(message, &b); err != nil {
-				log.Error().Err(err).
-					Str("detail", string(message)).
-					Msgf("error unmarshalling book update")
-				continue
+	out := newEventPipe(&bf.lc, bf.bufferOptions, mergeBookUpdates,
+		func(e interface{}) bool {
+			select {
+			case buChan <- e.(BookUpdate):
+				return true
+			case <-bf.lc.done():
+				return false
 			}
-			buChan <- b
-		}
-	}()
+		},
+		func() { close(buChan) })
+
+	bf.mu.Lock()
+	bf.bookUpdatePipe = out
+	bf.mu.Unlock()
+	bf.metrics.setBacklog(DepthStreamMetrics, out.backlog)
+
+	bf.lc.goroutine(func() {
+		defer out.close()
+		var gd gapDetector
+		bf.read(mChan, DepthStreamMetrics, "book update", func(message []byte, r receipt) (streamEvent, error) {
+			b, err := decode(message)
+			b.ReceivedAt, b.Raw = r.at, r.raw
+			return streamEvent{event: b, seqNo: b.LastUpdateID, eventTime: b.EventTime}, err
+		}, func(e interface{}) bool {
+			if gap, ok := gd.check(e.(BookUpdate)); ok {
+				bf.gaps.report(gap)
+			}
+			return out.push(e)
+		})
+	})
 	return buChan, err
 }
+
+// DepthGaps returns a read-only channel of gaps between consecutive book updates,
+// such as those missed while reconnecting. Gaps are dropped if the channel isn't
+// read. The channel is closed when the feeder is closed.
+func (bf *binanceFeeder) DepthGaps() <-chan DepthGap {
+	return bf.gaps.channel()
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -40,6 +41,13 @@ func (s *SyncBuffer) Write(p []byte) (int, error) {
 	return s.buf.Write(p)
 }
 
+// Contents returns a copy of the buffer that is safe to read while logs are still being written
+func (s *SyncBuffer) Contents() bytes.Buffer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *bytes.NewBuffer(append([]byte(nil), s.buf.Bytes()...))
+}
+
 func (s *SyncBuffer) Reset() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -88,14 +96,17 @@ var (
 	}`
 
 	expectedTrade = Trade{
+		Ignore:        true,
+		IsBuyerMaker:  true,
 		BuyerOrderID:  88,
 		SellerOrderID: 50,
 		TradeTime:     123456785,
 		ID:            12345,
+		Symbol:        "BNBBTC",
 		Type:          "trade",
 		EventTime:     123456789,
-		Price:         0.001,
-		Quantity:      100,
+		Price:         MustParseDecimal("0.001"),
+		Quantity:      MustParseDecimal("100"),
 	}
 )
 
@@ -128,7 +139,7 @@ func TestBinanceFeederTradesReturnsWorkingChannelThatReceivesTrades(t *testing.T
 	//assert
 	assert.NoError(t, err)
 
-	actualTrade := <-tc
+	actualTrade := withoutReceipt(<-tc)
 	assert.Equal(t, expectedTrade, actualTrade)
 }
 
@@ -178,7 +189,7 @@ func TestBinanceFeederTradesRetriesOnConnectionFailure(t *testing.T) {
 
 	assertContainsErrorLog(t, logBuffer.buf, "connection error")
 
-	actualTrade := <-tc
+	actualTrade := withoutReceipt(<-tc)
 	assert.Equal(t, expectedTrade, actualTrade)
 }
 
@@ -244,18 +255,22 @@ func TestBinanceFeederTradesRetriesOnWebsocketReadError(t *testing.T) {
 	mc = ws.RestartWithDelay(100 * time.Millisecond)
 	defer close(mc)
 
-	mc <- rawTrade
+	// trade IDs increase, as repeated IDs are dropped as duplicates
+	mc <- tradeWithID(12346)
 
 	//assert
 	assert.NoError(t, err)
 
 	actualTrade1, ok := <-tc
 	assert.True(t, ok)
-	assert.Equal(t, expectedTrade, actualTrade1)
+	assert.Equal(t, expectedTrade, withoutReceipt(actualTrade1))
+
+	nextTrade := expectedTrade
+	nextTrade.ID = 12346
 
 	actualTrade2, ok := <-tc
 	assert.True(t, ok)
-	assert.Equal(t, expectedTrade, actualTrade2)
+	assert.Equal(t, nextTrade, withoutReceipt(actualTrade2))
 }
 
 func TestBinanceFeederTradesClosesChannelAfterMaxRetries(t *testing.T) {
@@ -326,14 +341,17 @@ func TestBinanceFeederTradesSkipsAndLogsOnUnmarshalError(t *testing.T) {
 	}`
 
 	var expectedGoodTrade = Trade{
+		Ignore:        true,
+		IsBuyerMaker:  true,
 		BuyerOrderID:  88,
 		SellerOrderID: 50,
 		TradeTime:     123456785,
 		ID:            12345,
+		Symbol:        "BNBBTC",
 		Type:          "trade",
 		EventTime:     123456789,
-		Price:         0.001,
-		Quantity:      100,
+		Price:         MustParseDecimal("0.001"),
+		Quantity:      MustParseDecimal("100"),
 	}
 
 	mc := make(chan string, 3)
@@ -367,7 +385,7 @@ func TestBinanceFeederTradesSkipsAndLogsOnUnmarshalError(t *testing.T) {
 
 	actualTrade, ok := <-tc
 	assert.True(t, ok)
-	assert.Equal(t, expectedGoodTrade, actualTrade)
+	assert.Equal(t, expectedGoodTrade, withoutReceipt(actualTrade))
 
 	assertContainsErrorLog(t, logBuffer.buf, "error unmarshalling trade")
 }
@@ -396,19 +414,21 @@ var (
 	expectedBookUpdate = BookUpdate{
 		Type:      "depthUpdate",
 		EventTime: 123456789,
+		Symbol:    "BNBBTC",
 		Bids: []BookEntry{
 			{
-				Price:    0.0024,
-				Quantity: 10,
+				Price:    MustParseDecimal("0.0024"),
+				Quantity: MustParseDecimal("10"),
 			},
 		},
 		Asks: []BookEntry{
 			{
-				Price:    0.0026,
-				Quantity: 100,
+				Price:    MustParseDecimal("0.0026"),
+				Quantity: MustParseDecimal("100"),
 			},
 		},
-		LastUpdateID: 160,
+		FirstUpdateID: 157,
+		LastUpdateID:  160,
 	}
 )
 
@@ -442,7 +462,7 @@ func TestBinanceFeederBookUpdatesReturnsWorkingChannelThatReturnsEvents(t *testi
 	assert.NoError(t, err)
 
 	var actuals []BookUpdate
-	actuals = append(actuals, <-buChan)
+	actuals = append(actuals, bookUpdateWithoutReceipt(<-buChan))
 
 	assert.Contains(t, actuals, expectedBookUpdate)
 }
@@ -483,7 +503,7 @@ func TestBinanceFeederBookUpdatesRetriesOnConnectionFailure(t *testing.T) {
 	assertContainsErrorLog(t, logBuffer.buf, "connection error")
 
 	var actuals []BookUpdate
-	actuals = append(actuals, <-buChan)
+	actuals = append(actuals, bookUpdateWithoutReceipt(<-buChan))
 
 	assert.Contains(t, actuals, expectedBookUpdate)
 }
@@ -550,18 +570,23 @@ func TestBinanceFeederBookUpdatesRetriesOnWebsocketReadError(t *testing.T) {
 	mc = ws.RestartWithDelay(100 * time.Millisecond)
 	defer close(mc)
 
-	mc <- rawBookUpdate
+	// update IDs increase, as repeated IDs are dropped as duplicates
+	mc <- strings.NewReplacer(`"U": 157`, `"U": 161`, `"u": 160`, `"u": 162`).Replace(rawBookUpdate)
 
 	//assert
 	assert.NoError(t, err)
 
+	nextBookUpdate := expectedBookUpdate
+	nextBookUpdate.FirstUpdateID = 161
+	nextBookUpdate.LastUpdateID = 162
+
 	var actuals []BookUpdate
 
-	actuals = append(actuals, <-buChan)
-	actuals = append(actuals, <-buChan)
+	actuals = append(actuals, bookUpdateWithoutReceipt(<-buChan))
+	actuals = append(actuals, bookUpdateWithoutReceipt(<-buChan))
 
 	assert.Contains(t, actuals, expectedBookUpdate)
-	assert.Contains(t, actuals, expectedBookUpdate)
+	assert.Contains(t, actuals, nextBookUpdate)
 	assert.Len(t, actuals, 2)
 }
 
@@ -654,7 +679,7 @@ func TestBinanceFeederBookUpdatesSkipsAndLogsOnUnmarshalError(t *testing.T) {
 	assert.NoError(t, err)
 
 	var actuals []BookUpdate
-	actuals = append(actuals, <-buChan)
+	actuals = append(actuals, bookUpdateWithoutReceipt(<-buChan))
 
 	assert.Contains(t, actuals, expectedBookUpdate)
 
@@ -737,7 +762,7 @@ func TestBinanceFeederBookUpdatesSkipsAndLogsOnUnmarshalBookEntryError(t *testin
 	assert.NoError(t, err)
 
 	var actuals []BookUpdate
-	actuals = append(actuals, <-buChan)
+	actuals = append(actuals, bookUpdateWithoutReceipt(<-buChan))
 
 	assert.Contains(t, actuals, expectedBookUpdate)
 
@@ -745,12 +770,153 @@ func TestBinanceFeederBookUpdatesSkipsAndLogsOnUnmarshalBookEntryError(t *testin
 	assertContainsErrorLog(t, logBuffer.buf, "wrong number of fields in bookEntry")
 }
 
+func TestBinanceFeederCloseClosesAllChannels(t *testing.T) {
+	//arrange
+	mc := make(chan string, 2)
+	defer close(mc)
+
+	ws := newTestServer("/", mc)
+	defer ws.Close()
+
+	bf := newTestBinanceFeeder(ws, 1)
+
+	tc, err := bf.Trades()
+	assert.NoError(t, err)
+	buChan, err := bf.BookUpdates()
+	assert.NoError(t, err)
+
+	//act
+	err = bf.Close()
+
+	//assert
+	assert.NoError(t, err)
+
+	_, ok := <-tc
+	assert.False(t, ok)
+	_, ok = <-buChan
+	assert.False(t, ok)
+}
+
+func TestBinanceFeederCloseStopsReconnectAttempts(t *testing.T) {
+	//arrange
+	mc := make(chan string, 2)
+	ws := newTestServer(tradesURL, mc)
+	defer ws.Close()
+
+	bf := newTestBinanceFeeder(ws, 5)
+	bf.socketOptions.BackOffTime = time.Hour
+
+	tc, err := bf.Trades()
+	assert.NoError(t, err)
+
+	// server drops the connection, leaving the feeder waiting to reconnect
+	close(mc)
+
+	//act
+	closed := make(chan struct{})
+	go func() {
+		bf.Close()
+		close(closed)
+	}()
+
+	//assert
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		assert.Fail(t, "Close did not return while waiting to reconnect")
+	}
+
+	_, ok := <-tc
+	assert.False(t, ok)
+}
+
+func TestBinanceFeederCloseUnblocksUnreadChannels(t *testing.T) {
+	//arrange
+	mc := make(chan string, 3)
+	defer close(mc)
+
+	ws := newTestServer(tradesURL, mc)
+	defer ws.Close()
+
+	mc <- rawTrade
+	mc <- rawTrade
+
+	bf := newTestBinanceFeeder(ws, 0)
+
+	_, err := bf.Trades()
+	assert.NoError(t, err)
+
+	// give the feeder time to block on sending the unread trades
+	time.Sleep(100 * time.Millisecond)
+
+	//act
+	closed := make(chan struct{})
+	go func() {
+		bf.Close()
+		close(closed)
+	}()
+
+	//assert
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		assert.Fail(t, "Close did not return while trades were unread")
+	}
+}
+
+func TestBinanceFeederTradesReturnsErrorAndClosedChannelAfterClose(t *testing.T) {
+	//arrange
+	mc := make(chan string, 2)
+	defer close(mc)
+
+	ws := newTestServer(tradesURL, mc)
+	defer ws.Close()
+
+	bf := newTestBinanceFeeder(ws, 0)
+	bf.Close()
+
+	//act
+	tc, err := bf.Trades()
+
+	//assert
+	assert.Equal(t, errFeederClosed, err)
+
+	_, ok := <-tc
+	assert.False(t, ok)
+}
+
 type logline struct {
 	Msg   string `json:"message"`
 	Error string `json:"error"`
 	Level string `json:"level"`
 }
 
+// withoutReceipt clears the local receipt of a trade received from Binance, so
+// that it can be compared with an expected trade
+func withoutReceipt(t Trade) Trade {
+	t.ReceivedAt = time.Time{}
+	t.Raw = nil
+	return t
+}
+
+// eventWithoutReceipt clears the local receipt of any kind of event received from
+// Binance, so that it can be compared with an expected event
+func eventWithoutReceipt(e interface{}) interface{} {
+	v := reflect.New(reflect.TypeOf(e)).Elem()
+	v.Set(reflect.ValueOf(e))
+	v.FieldByName("ReceivedAt").Set(reflect.ValueOf(time.Time{}))
+	v.FieldByName("Raw").Set(reflect.ValueOf(json.RawMessage(nil)))
+	return v.Interface()
+}
+
+// bookUpdateWithoutReceipt clears the local receipt of a book update received from
+// Binance, so that it can be compared with an expected book update
+func bookUpdateWithoutReceipt(b BookUpdate) BookUpdate {
+	b.ReceivedAt = time.Time{}
+	b.Raw = nil
+	return b
+}
+
 func assertContainsErrorLog(t *testing.T, b bytes.Buffer, msg string) {
 	logs, err := logContents(b)
 	assert.NoError(t, err)
@@ -858,3 +1024,131 @@ func newWebsocketHandler(path string, messages <-chan string) http.Handler {
 
 	return router
 }
+
+// stubFeeder is a Feeder whose channels are driven directly by tests
+type stubFeeder struct {
+	symbol      string
+	trades      chan Trade
+	bookUpdates chan BookUpdate
+}
+
+func newStubFeeder(symbol string) *stubFeeder {
+	return &stubFeeder{
+		symbol:      symbol,
+		trades:      make(chan Trade, 10),
+		bookUpdates: make(chan BookUpdate, 10),
+	}
+}
+
+func (sf *stubFeeder) Trades() (<-chan Trade, error) {
+	return sf.trades, nil
+}
+
+func (sf *stubFeeder) BookUpdates() (<-chan BookUpdate, error) {
+	return sf.bookUpdates, nil
+}
+
+func (sf *stubFeeder) GetSymbol() string {
+	return sf.symbol
+}
+
+func (sf *stubFeeder) Close() error {
+	return nil
+}
+
+// keepRawPayloads lets stub feeds be recorded, their events' raw payloads being set by tests
+func (sf *stubFeeder) keepRawPayloads() bool {
+	return true
+}
+
+func newTestBinanceFeeder(ws *testServer, maxRetries int) *binanceFeeder {
+	testDialer := websocket.DefaultDialer
+	testDialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	opts := &SocketConnectionOptions{
+		Dialer:      testDialer,
+		MaxRetries:  maxRetries,
+		BackOffTime: 10 * time.Millisecond,
+	}
+
+	return &binanceFeeder{
+		baseURL:       strings.TrimPrefix(ws.URL, "wss://"),
+		socketOptions: opts,
+		symbol:        testSymbol,
+	}
+}
+
+func TestBinanceFeederStampsEventsWithLocalReceiptTime(t *testing.T) {
+	//arrange
+	mc := make(chan string, 1)
+	defer close(mc)
+
+	ws := newTestServer(tradesURL, mc)
+	defer ws.Close()
+
+	mc <- rawTrade
+
+	bf := newTestBinanceFeeder(ws, 0)
+	defer bf.Close()
+	before := time.Now()
+
+	//act
+	tc, err := bf.Trades()
+	trade := <-tc
+
+	//assert
+	assert.NoError(t, err)
+	assert.False(t, trade.ReceivedAt.Before(before))
+	assert.False(t, trade.ReceivedAt.After(time.Now()))
+	assert.Nil(t, trade.Raw)
+}
+
+func TestBinanceFeederWithRawPayloadsKeepsEachEventsJSON(t *testing.T) {
+	//arrange
+	mc := make(chan string, 1)
+	defer close(mc)
+
+	ws := newTestServer(depthURL, mc)
+	defer ws.Close()
+
+	mc <- rawBookUpdate
+
+	bf := newTestBinanceFeeder(ws, 0)
+	bf.rawPayloads = true
+	defer bf.Close()
+
+	//act
+	buChan, err := bf.BookUpdates()
+	b := <-buChan
+
+	//assert
+	assert.NoError(t, err)
+	assert.JSONEq(t, rawBookUpdate, string(b.Raw))
+	assert.Equal(t, expectedBookUpdate, bookUpdateWithoutReceipt(b))
+}
+
+func TestWithRawPayloadsSetsFeedersToKeepRawPayloads(t *testing.T) {
+	//act
+	bf := NewBinanceFeeder("BTCBNB", WithRawPayloads())
+	mf := NewBinanceMultiFeederWithOptions([]string{"BTCBNB"}, WithRawPayloads())
+
+	//assert
+	assert.True(t, bf.rawPayloads)
+	assert.True(t, mf.rawPayloads)
+}
+
+func TestTradeAggressorSideIsOppositeTheMaker(t *testing.T) {
+	assert.Equal(t, Ask, Trade{IsBuyerMaker: true}.AggressorSide())
+	assert.Equal(t, Bid, Trade{IsBuyerMaker: false}.AggressorSide())
+	assert.Equal(t, Ask, AggTrade{IsBuyerMaker: true}.AggressorSide())
+}
+
+func TestEventTimestampsConvertMillisecondTimes(t *testing.T) {
+	//arrange
+	trade := Trade{EventTime: 1614556800123, TradeTime: 1614556800000}
+	bookUpdate := BookUpdate{EventTime: 1614556800456}
+
+	//assert
+	assert.True(t, time.Date(2021, 3, 1, 0, 0, 0, 123*int(time.Millisecond), time.UTC).Equal(trade.EventTimestamp()))
+	assert.True(t, time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC).Equal(trade.TradeTimestamp()))
+	assert.True(t, time.Date(2021, 3, 1, 0, 0, 0, 456*int(time.Millisecond), time.UTC).Equal(bookUpdate.EventTimestamp()))
+}
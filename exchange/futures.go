@@ -0,0 +1,443 @@
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// BinanceFuturesURL is the base URL for the Binance USDⓈ-M futures market streams
+	BinanceFuturesURL string = "fstream.binance.com"
+	// BinanceFuturesRESTURL is the base URL for the Binance USDⓈ-M futures REST API
+	BinanceFuturesRESTURL string = "fapi.binance.com"
+
+	futuresDepthSnapshotPath = "/fapi/v1/depth"
+)
+
+// Update speeds supported by Binance futures depth streams, as well as Speed100ms
+const (
+	Speed250ms UpdateSpeed = "250ms"
+	Speed500ms UpdateSpeed = "500ms"
+)
+
+// ContractType is the kind of futures contract followed by a continuous contract stream
+type ContractType string
+
+// Contract types supported by Binance continuous contract streams
+const (
+	Perpetual      ContractType = "perpetual"
+	CurrentQuarter ContractType = "current_quarter"
+	NextQuarter    ContractType = "next_quarter"
+)
+
+// Valid reports whether the contract type is supported by Binance
+func (ct ContractType) Valid() bool {
+	return ct == Perpetual || ct == CurrentQuarter || ct == NextQuarter
+}
+
+// MarkPriceFeeder is an interface for feeds of a futures market's mark price
+// MarkPrices returns a channel of the mark price, index price and funding rate
+type MarkPriceFeeder interface {
+	MarkPrices() (<-chan MarkPrice, error)
+}
+
+// LiquidationFeeder is an interface for feeds of a futures market's liquidations
+// Liquidations returns a channel of liquidation orders
+type LiquidationFeeder interface {
+	Liquidations() (<-chan Liquidation, error)
+}
+
+// ContinuousKlineFeeder is an interface for feeds of a futures pair's continuous contract klines
+// ContinuousKlines returns a channel of updates to the current bar of the given contract type & interval
+type ContinuousKlineFeeder interface {
+	ContinuousKlines(contractType ContractType, interval KlineInterval) (<-chan Kline, error)
+}
+
+// binanceFuturesFeeder is a feeder of a Binance USDⓈ-M futures market. It
+// shares the connection handling, buffering and metrics of binanceFeeder,
+// decoding the futures variants of the streams that differ from spot.
+type binanceFuturesFeeder struct {
+	*binanceFeeder
+}
+
+// NewBinanceFuturesFeeder returns a feeder of the futures symbol's streams,
+// connecting to Futures unless configured otherwise by the options
+func NewBinanceFuturesFeeder(symbol string, opts ...Option) *binanceFuturesFeeder {
+	opts = append([]Option{WithEnvironment(Futures)}, opts...)
+	return &binanceFuturesFeeder{NewBinanceFeeder(symbol, opts...)}
+}
+
+func (ff *binanceFuturesFeeder) depthSnapshotPath() string {
+	return futuresDepthSnapshotPath
+}
+
+func (ff *binanceFuturesFeeder) streamNames() (string, string) {
+	symbol := strings.ToLower(ff.symbol)
+	return symbol + "@aggTrade", depthStream(symbol)
+}
+
+// Taken from https://binance-docs.github.io/apidocs/futures/en/#aggregate-trade-streams
+// {
+//   "e": "aggTrade",  // Event type
+//   "E": 123456789,   // Event time
+//   "s": "BNBUSDT",   // Symbol
+//   "a": 5933014,     // Aggregate trade ID
+//   "p": "0.001",     // Price
+//   "q": "100",       // Quantity
+//   "f": 100,         // First trade ID
+//   "l": 105,         // Last trade ID
+//   "T": 123456785,   // Trade time
+//   "m": true         // Is the buyer the market maker?
+// }
+
+// Trades returns a read-only channel of trades made on the market. Futures
+// markets only stream aggregated trades, so each trade is an aggregate trade
+// whose ID is the aggregate trade ID and which has no order IDs.
+func (ff *binanceFuturesFeeder) Trades() (<-chan Trade, error) {
+	return ff.trades("aggTrade", decodeFuturesTrade)
+}
+
+func decodeFuturesTrade(message []byte) (Trade, error) {
+	var at AggTrade
+	if err := json.Unmarshal(message, &at); err != nil {
+		return Trade{}, err
+	}
+	return Trade{
+		Type:         "trade",
+		Symbol:       at.Symbol,
+		ID:           at.ID,
+		TradeTime:    at.TradeTime,
+		EventTime:    at.EventTime,
+		Price:        at.Price,
+		Quantity:     at.Quantity,
+		IsBuyerMaker: at.IsBuyerMaker,
+	}, nil
+}
+
+// Taken from https://binance-docs.github.io/apidocs/futures/en/#diff-book-depth-streams
+// {
+//   "e": "depthUpdate", // Event type
+//   "E": 123456789,     // Event time
+//   "T": 123456788,     // Transaction time
+//   "s": "BTCUSDT",     // Symbol
+//   "U": 157,           // First update ID in event
+//   "u": 160,           // Final update ID in event
+//   "pu": 149,          // Final update ID in last stream (ie `u` in last stream)
+//   "b": [ ... ],       // Bids to be updated
+//   "a": [ ... ]        // Asks to be updated
+// }
+
+type futuresDepthEvent struct {
+	BookUpdate
+	TransactionTime  int `json:"T"`
+	PrevLastUpdateID int `json:"pu"`
+}
+
+// BookUpdates returns a read-only channel of updates made on the orderbook in the market.
+// Futures update IDs aren't consecutive, so each update's FirstUpdateID is set to
+// follow on from the previous update's final update ID. Gaps are then detected,
+// and an OrderBook kept in sync, the same way as for spot markets.
+func (ff *binanceFuturesFeeder) BookUpdates() (<-chan BookUpdate, error) {
+	return ff.bookUpdates(fmt.Sprintf("depth@%s", Speed100ms), decodeFuturesBookUpdate)
+}
+
+func decodeFuturesBookUpdate(message []byte) (BookUpdate, error) {
+	var e futuresDepthEvent
+	if err := json.Unmarshal(message, &e); err != nil {
+		return BookUpdate{}, err
+	}
+	e.BookUpdate.FirstUpdateID = e.PrevLastUpdateID + 1
+	return e.BookUpdate, nil
+}
+
+// PartialDepth returns a read-only channel of snapshots of the top levels of the
+// order book, pushed at the given speed. Levels must be one of PartialDepthLevels
+// and speed one of Speed100ms, Speed250ms or Speed500ms.
+func (ff *binanceFuturesFeeder) PartialDepth(levels int, speed UpdateSpeed) (<-chan DepthSnapshot, error) {
+	if !validDepthLevels(levels) {
+		return nil, fmt.Errorf("unsupported partial depth levels: %d", levels)
+	}
+
+	var stream string
+	switch speed {
+	case Speed100ms, Speed500ms:
+		stream = fmt.Sprintf("depth%d@%s", levels, speed)
+	case Speed250ms:
+		stream = fmt.Sprintf("depth%d", levels)
+	default:
+		return nil, fmt.Errorf("unsupported update speed: %s", speed)
+	}
+
+	mChan, err := ff.listen(stream)
+
+	dsChan := make(chan DepthSnapshot)
+	ff.lc.goroutine(func() {
+		defer close(dsChan)
+		ff.read(mChan, stream, "partial depth", func(message []byte, r receipt) (streamEvent, error) {
+			var e futuresDepthEvent
+			err := json.Unmarshal(message, &e)
+			ds := DepthSnapshot{Symbol: e.Symbol, LastUpdateID: e.LastUpdateID, Bids: e.Bids, Asks: e.Asks,
+				ReceivedAt: r.at, Raw: r.raw}
+			return streamEvent{event: ds, seqNo: e.LastUpdateID, eventTime: e.EventTime}, err
+		}, ff.sendDepthSnapshot(dsChan))
+	})
+	return dsChan, err
+}
+
+// Taken from https://binance-docs.github.io/apidocs/futures/en/#mark-price-stream
+// {
+//   "e": "markPriceUpdate",     // Event type
+//   "E": 1562305380000,         // Event time
+//   "s": "BTCUSDT",             // Symbol
+//   "p": "11794.15000000",      // Mark price
+//   "i": "11784.62659091",      // Index price
+//   "P": "11784.25641265",      // Estimated Settle Price, only useful in the last hour before the settlement starts
+//   "r": "0.00038167",          // Funding rate
+//   "T": 1562306400000          // Next funding time
+// }
+
+type markPriceEvent struct {
+	// Have to include Type even though not wanted as encoding/json Unmarshal() has a bug with case-sensitivity on named parameters
+	// Issue discussed here: https://github.com/golang/go/issues/14750
+	// Watching proposed change to package here: https://go-review.googlesource.com/c/go/+/224079/
+	Type string `json:"e"` // Will always be "markPriceUpdate"
+
+	EventTime            int     `json:"E"`
+	Symbol               string  `json:"s"`
+	Price                Decimal `json:"p"`
+	IndexPrice           Decimal `json:"i"`
+	EstimatedSettlePrice Decimal `json:"P"`
+	FundingRate          string  `json:"r"` // empty for contracts without funding
+	NextFundingTime      int     `json:"T"`
+}
+
+// MarkPrice contains a futures market's mark price, index price and funding.
+// FundingRate and NextFundingTime are zero for contracts without funding.
+// ReceivedAt and Raw are as for Trade.
+type MarkPrice struct {
+	EventTime            int
+	Symbol               string
+	Price                Decimal
+	IndexPrice           Decimal
+	EstimatedSettlePrice Decimal
+	FundingRate          Decimal
+	NextFundingTime      int
+
+	ReceivedAt time.Time
+	Raw        json.RawMessage
+}
+
+// EventTimestamp returns the mark price's event time
+func (mp MarkPrice) EventTimestamp() time.Time {
+	return msTime(mp.EventTime)
+}
+
+// NextFundingTimestamp returns the time of the next funding, or the zero Unix
+// time for contracts without funding
+func (mp MarkPrice) NextFundingTimestamp() time.Time {
+	return msTime(mp.NextFundingTime)
+}
+
+// MarkPrices returns a read-only channel of the market's mark price, pushed every 3 seconds
+func (ff *binanceFuturesFeeder) MarkPrices() (<-chan MarkPrice, error) {
+	mChan, err := ff.listen("markPrice")
+
+	mpChan := make(chan MarkPrice)
+	ff.lc.goroutine(func() {
+		defer close(mpChan)
+		ff.read(mChan, "markPrice", "mark price", func(message []byte, r receipt) (streamEvent, error) {
+			mp, err := decodeMarkPrice(message)
+			mp.ReceivedAt, mp.Raw = r.at, r.raw
+			return streamEvent{event: mp, seqNo: mp.EventTime, eventTime: mp.EventTime}, err
+		}, func(e interface{}) bool {
+			select {
+			case mpChan <- e.(MarkPrice):
+				return true
+			case <-ff.lc.done():
+				return false
+			}
+		})
+	})
+	return mpChan, err
+}
+
+func decodeMarkPrice(message []byte) (MarkPrice, error) {
+	var e markPriceEvent
+	if err := json.Unmarshal(message, &e); err != nil {
+		return MarkPrice{}, err
+	}
+
+	mp := MarkPrice{
+		EventTime:            e.EventTime,
+		Symbol:               e.Symbol,
+		Price:                e.Price,
+		IndexPrice:           e.IndexPrice,
+		EstimatedSettlePrice: e.EstimatedSettlePrice,
+		NextFundingTime:      e.NextFundingTime,
+	}
+	if e.FundingRate != "" {
+		rate, err := ParseDecimal(e.FundingRate)
+		if err != nil {
+			return MarkPrice{}, err
+		}
+		mp.FundingRate = rate
+	}
+	return mp, nil
+}
+
+// Taken from https://binance-docs.github.io/apidocs/futures/en/#liquidation-order-streams
+// {
+//   "e": "forceOrder",              // Event Type
+//   "E": 1568014460893,             // Event Time
+//   "o": {
+//     "s": "BTCUSDT",               // Symbol
+//     "S": "SELL",                  // Side
+//     "o": "LIMIT",                 // Order Type
+//     "f": "IOC",                   // Time in Force
+//     "q": "0.014",                 // Original Quantity
+//     "p": "9910",                  // Price
+//     "ap": "9910",                 // Average Price
+//     "X": "FILLED",                // Order Status
+//     "l": "0.014",                 // Order Last Filled Quantity
+//     "z": "0.014",                 // Order Filled Accumulated Quantity
+//     "T": 1568014460893            // Order Trade Time
+//   }
+// }
+
+type liquidationEvent struct {
+	// Have to include Type even though not wanted as encoding/json Unmarshal() has a bug with case-sensitivity on named parameters
+	// Issue discussed here: https://github.com/golang/go/issues/14750
+	// Watching proposed change to package here: https://go-review.googlesource.com/c/go/+/224079/
+	Type string `json:"e"` // Will always be "forceOrder"
+
+	EventTime int         `json:"E"`
+	Order     Liquidation `json:"o"`
+}
+
+// Liquidation contains a liquidation order of a futures market. Side is the
+// side of the liquidation order, SELL closing a liquidated long position.
+// ReceivedAt and Raw are as for Trade.
+type Liquidation struct {
+	EventTime int `json:"-"`
+
+	Symbol             string  `json:"s"`
+	Side               string  `json:"S"`
+	OrderType          string  `json:"o"`
+	TimeInForce        string  `json:"f"`
+	Quantity           Decimal `json:"q"`
+	Price              Decimal `json:"p"`
+	AveragePrice       Decimal `json:"ap"`
+	Status             string  `json:"X"`
+	LastFilledQuantity Decimal `json:"l"`
+	FilledQuantity     Decimal `json:"z"`
+	TradeTime          int     `json:"T"`
+
+	ReceivedAt time.Time       `json:"-"`
+	Raw        json.RawMessage `json:"-"`
+}
+
+// EventTimestamp returns the liquidation's event time
+func (l Liquidation) EventTimestamp() time.Time {
+	return msTime(l.EventTime)
+}
+
+// TradeTimestamp returns the time the liquidation order last traded
+func (l Liquidation) TradeTimestamp() time.Time {
+	return msTime(l.TradeTime)
+}
+
+// Liquidations returns a read-only channel of liquidation orders on the market.
+// Binance pushes at most the latest liquidation of each second.
+func (ff *binanceFuturesFeeder) Liquidations() (<-chan Liquidation, error) {
+	mChan, err := ff.listen("forceOrder")
+
+	lChan := make(chan Liquidation)
+	ff.lc.goroutine(func() {
+		defer close(lChan)
+		ff.read(mChan, "forceOrder", "liquidation", func(message []byte, r receipt) (streamEvent, error) {
+			var e liquidationEvent
+			err := json.Unmarshal(message, &e)
+			e.Order.EventTime = e.EventTime
+			e.Order.ReceivedAt, e.Order.Raw = r.at, r.raw
+			return streamEvent{event: e.Order, seqNo: e.EventTime, eventTime: e.EventTime}, err
+		}, func(e interface{}) bool {
+			select {
+			case lChan <- e.(Liquidation):
+				return true
+			case <-ff.lc.done():
+				return false
+			}
+		})
+	})
+	return lChan, err
+}
+
+// Taken from https://binance-docs.github.io/apidocs/futures/en/#continuous-contract-kline-candlestick-streams
+// {
+//   "e": "continuous_kline",  // Event type
+//   "E": 1607443058651,       // Event time
+//   "ps": "BTCUSDT",          // Pair
+//   "ct": "PERPETUAL",        // Contract type
+//   "k": {
+//     "t": 1607443020000,     // Kline start time
+//     "T": 1607443079999,     // Kline close time
+//     "i": "1m",              // Interval
+//     "f": 116467658886,      // First updateId
+//     "L": 116468012423,      // Last updateId
+//     "o": "18787.00",        // Open price
+//     "c": "18804.04",        // Close price
+//     "h": "18804.04",        // High price
+//     "l": "18786.54",        // Low price
+//     "v": "197.664",         // volume
+//     "n": 543,               // Number of trades
+//     "x": false,             // Is this kline closed?
+//     "q": "3715253.19494",   // Quote asset volume
+//     "V": "184.769",         // Taker buy volume
+//     "Q": "3472925.84746",   // Taker buy quote asset volume
+//     "B": "0"                // Ignore
+//   }
+// }
+
+type continuousKlineEvent struct {
+	// Have to include Type even though not wanted as encoding/json Unmarshal() has a bug with case-sensitivity on named parameters
+	// Issue discussed here: https://github.com/golang/go/issues/14750
+	// Watching proposed change to package here: https://go-review.googlesource.com/c/go/+/224079/
+	Type string `json:"e"` // Will always be "continuous_kline"
+
+	EventTime    int    `json:"E"`
+	Pair         string `json:"ps"`
+	ContractType string `json:"ct"`
+	Kline        Kline  `json:"k"`
+}
+
+// ContinuousKlines returns a read-only channel of updates to the kline of the
+// given interval of the feeder's pair's contract of the given type, following
+// the contract across rollovers. The kline's Symbol is the pair, and its first
+// and last trade IDs are the first and last update IDs of the bar.
+func (ff *binanceFuturesFeeder) ContinuousKlines(contractType ContractType, interval KlineInterval) (<-chan Kline, error) {
+	if !contractType.Valid() {
+		return nil, fmt.Errorf("unsupported contract type: %s", contractType)
+	}
+	if !interval.Valid() || interval == Interval1s {
+		return nil, fmt.Errorf("unsupported kline interval: %s", interval)
+	}
+
+	stream := fmt.Sprintf("%s@continuousKline_%s", contractType, interval)
+	mChan, err := ff.listenTo(fmt.Sprintf("%s_%s", strings.ToLower(ff.symbol), stream))
+
+	kChan := make(chan Kline)
+	ff.lc.goroutine(func() {
+		defer close(kChan)
+		ff.read(mChan, stream, "continuous kline", func(message []byte, r receipt) (streamEvent, error) {
+			var e continuousKlineEvent
+			err := json.Unmarshal(message, &e)
+			e.Kline.EventTime = e.EventTime
+			e.Kline.Symbol = e.Pair
+			e.Kline.ReceivedAt, e.Kline.Raw = r.at, r.raw
+			return streamEvent{event: e.Kline, seqNo: e.EventTime, eventTime: e.EventTime}, err
+		}, ff.sendKline(kChan))
+	})
+	return kChan, err
+}
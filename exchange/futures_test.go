@@ -0,0 +1,445 @@
+package exchange
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	futuresTradesURL       = "/ws/test@aggTrade"
+	markPriceURL           = "/ws/test@markPrice"
+	liquidationsURL        = "/ws/test@forceOrder"
+	continuousKlinesURL    = "/ws/test_perpetual@continuousKline_1m"
+	futuresPartialDepthURL = "/ws/test@depth5@500ms"
+)
+
+var (
+	rawFuturesTrade = `{
+		"e": "aggTrade",
+		"E": 123456789,
+		"s": "BNBUSDT",
+		"a": 5933014,
+		"p": "0.001",
+		"q": "100",
+		"f": 100,
+		"l": 105,
+		"T": 123456785,
+		"m": true
+	}`
+
+	expectedFuturesTrade = Trade{
+		Type:         "trade",
+		Symbol:       "BNBUSDT",
+		ID:           5933014,
+		TradeTime:    123456785,
+		EventTime:    123456789,
+		Price:        MustParseDecimal("0.001"),
+		Quantity:     MustParseDecimal("100"),
+		IsBuyerMaker: true,
+	}
+
+	rawMarkPrice = `{
+		"e": "markPriceUpdate",
+		"E": 1562305380000,
+		"s": "BTCUSDT",
+		"p": "11794.15000000",
+		"i": "11784.62659091",
+		"P": "11784.25641265",
+		"r": "0.00038167",
+		"T": 1562306400000
+	}`
+
+	expectedMarkPrice = MarkPrice{
+		EventTime:            1562305380000,
+		Symbol:               "BTCUSDT",
+		Price:                MustParseDecimal("11794.15"),
+		IndexPrice:           MustParseDecimal("11784.62659091"),
+		EstimatedSettlePrice: MustParseDecimal("11784.25641265"),
+		FundingRate:          MustParseDecimal("0.00038167"),
+		NextFundingTime:      1562306400000,
+	}
+
+	rawLiquidation = `{
+		"e": "forceOrder",
+		"E": 1568014460893,
+		"o": {
+			"s": "BTCUSDT",
+			"S": "SELL",
+			"o": "LIMIT",
+			"f": "IOC",
+			"q": "0.014",
+			"p": "9910",
+			"ap": "9910",
+			"X": "FILLED",
+			"l": "0.014",
+			"z": "0.014",
+			"T": 1568014460893
+		}
+	}`
+
+	expectedLiquidation = Liquidation{
+		EventTime:          1568014460893,
+		Symbol:             "BTCUSDT",
+		Side:               "SELL",
+		OrderType:          "LIMIT",
+		TimeInForce:        "IOC",
+		Quantity:           MustParseDecimal("0.014"),
+		Price:              MustParseDecimal("9910"),
+		AveragePrice:       MustParseDecimal("9910"),
+		Status:             "FILLED",
+		LastFilledQuantity: MustParseDecimal("0.014"),
+		FilledQuantity:     MustParseDecimal("0.014"),
+		TradeTime:          1568014460893,
+	}
+
+	rawContinuousKline = `{
+		"e": "continuous_kline",
+		"E": 1607443058651,
+		"ps": "BTCUSDT",
+		"ct": "PERPETUAL",
+		"k": {
+			"t": 1607443020000,
+			"T": 1607443079999,
+			"i": "1m",
+			"f": 116467658886,
+			"L": 116468012423,
+			"o": "18787.00",
+			"c": "18804.04",
+			"h": "18804.04",
+			"l": "18786.54",
+			"v": "197.664",
+			"n": 543,
+			"x": false,
+			"q": "3715253.19494",
+			"V": "184.769",
+			"Q": "3472925.84746",
+			"B": "0"
+		}
+	}`
+
+	expectedContinuousKline = Kline{
+		EventTime:           1607443058651,
+		Symbol:              "BTCUSDT",
+		Interval:            Interval1m,
+		StartTime:           1607443020000,
+		CloseTime:           1607443079999,
+		FirstTradeID:        116467658886,
+		LastTradeID:         116468012423,
+		Open:                MustParseDecimal("18787"),
+		High:                MustParseDecimal("18804.04"),
+		Low:                 MustParseDecimal("18786.54"),
+		Close:               MustParseDecimal("18804.04"),
+		Volume:              MustParseDecimal("197.664"),
+		QuoteVolume:         MustParseDecimal("3715253.19494"),
+		TradeCount:          543,
+		TakerBuyVolume:      MustParseDecimal("184.769"),
+		TakerBuyQuoteVolume: MustParseDecimal("3472925.84746"),
+		Closed:              false,
+	}
+)
+
+func futuresBookUpdate(first int, last int, prevLast int) string {
+	return fmt.Sprintf(`{"e":"depthUpdate","E":123456789,"T":123456788,"s":"BTCUSDT","U":%d,"u":%d,"pu":%d,"b":[["0.0024","10"]],"a":[]}`,
+		first, last, prevLast)
+}
+
+func newTestBinanceFuturesFeeder(ws *testServer) *binanceFuturesFeeder {
+	return &binanceFuturesFeeder{newTestBinanceFeeder(ws, 0)}
+}
+
+func TestBinanceFuturesFeederImplementsFeederInterfaces(t *testing.T) {
+	ff := &binanceFuturesFeeder{&binanceFeeder{}}
+	assert.Implements(t, (*Feeder)(nil), ff)
+	assert.Implements(t, (*DepthGapFeeder)(nil), ff)
+	assert.Implements(t, (*MarkPriceFeeder)(nil), ff)
+	assert.Implements(t, (*LiquidationFeeder)(nil), ff)
+	assert.Implements(t, (*ContinuousKlineFeeder)(nil), ff)
+}
+
+func TestNewBinanceFuturesFeederConnectsToFutures(t *testing.T) {
+	//act
+	ff := NewBinanceFuturesFeeder("btcusdt")
+	testnet := NewBinanceFuturesFeeder("btcusdt", WithEnvironment(FuturesTestnet))
+
+	//assert
+	assert.Equal(t, "fstream.binance.com", ff.baseURL)
+	assert.Equal(t, "fapi.binance.com", ff.RESTURL())
+	assert.Equal(t, FuturesTestnet.StreamURL, testnet.baseURL)
+}
+
+func TestNewOrderBookTakesFuturesSnapshotsFromFuturesAPI(t *testing.T) {
+	//act
+	ob := NewOrderBook(NewBinanceFuturesFeeder("btcusdt"))
+
+	//assert
+	assert.Equal(t, "fapi.binance.com", ob.rest.baseURL)
+	assert.Equal(t, "/fapi/v1/depth", ob.snapshotPath)
+}
+
+func TestNewOrderBookOfWrappedFuturesFeedTakesFuturesSnapshots(t *testing.T) {
+	//arrange
+	feed := NewBinanceFuturesFeeder("btcusdt", WithEnvironment(FuturesTestnet))
+
+	//act
+	ob := NewOrderBook(Chain(NewHub(feed, nil).Subscribe(), Sample(time.Second)))
+
+	//assert
+	assert.Equal(t, FuturesTestnet.RESTURL, ob.rest.baseURL)
+	assert.Equal(t, futuresDepthSnapshotPath, ob.snapshotPath)
+}
+
+func TestBinanceFuturesFeederTradesReceivesAggregateTradesAsTrades(t *testing.T) {
+	//arrange
+	mc := make(chan string, 1)
+	defer close(mc)
+
+	ws := newTestServer(futuresTradesURL, mc)
+	defer ws.Close()
+
+	mc <- rawFuturesTrade
+
+	ff := newTestBinanceFuturesFeeder(ws)
+	defer ff.Close()
+
+	//act
+	tc, err := ff.Trades()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedFuturesTrade, withoutReceipt(<-tc))
+}
+
+func TestBinanceFuturesFeederBookUpdatesFollowOnFromPreviousFinalUpdateID(t *testing.T) {
+	//arrange
+	mc := make(chan string, 2)
+	defer close(mc)
+
+	ws := newTestServer(depthURL, mc)
+	defer ws.Close()
+
+	mc <- futuresBookUpdate(157, 160, 149)
+	mc <- futuresBookUpdate(165, 170, 160)
+
+	ff := newTestBinanceFuturesFeeder(ws)
+	defer ff.Close()
+
+	//act
+	buc, err := ff.BookUpdates()
+
+	//assert
+	assert.NoError(t, err)
+	first, second := <-buc, <-buc
+	assert.Equal(t, 150, first.FirstUpdateID)
+	assert.Equal(t, 160, first.LastUpdateID)
+	assert.Equal(t, 161, second.FirstUpdateID)
+	assert.Equal(t, 170, second.LastUpdateID)
+	assert.Equal(t, []BookEntry{{Price: MustParseDecimal("0.0024"), Quantity: MustParseDecimal("10")}}, second.Bids)
+	select {
+	case gap := <-ff.DepthGaps():
+		t.Fatalf("unexpected gap: %+v", gap)
+	default:
+	}
+}
+
+func TestBinanceFuturesFeederBookUpdatesReportsGapInPreviousFinalUpdateID(t *testing.T) {
+	//arrange
+	mc := make(chan string, 2)
+	defer close(mc)
+
+	ws := newTestServer(depthURL, mc)
+	defer ws.Close()
+
+	mc <- futuresBookUpdate(157, 160, 149)
+	mc <- futuresBookUpdate(175, 180, 172)
+
+	ff := newTestBinanceFuturesFeeder(ws)
+	defer ff.Close()
+	gaps := ff.DepthGaps()
+
+	//act
+	buc, err := ff.BookUpdates()
+	<-buc
+	<-buc
+
+	//assert
+	assert.NoError(t, err)
+	gap := <-gaps
+	assert.Equal(t, 161, gap.Expected)
+	assert.Equal(t, 173, gap.Received)
+}
+
+func TestBinanceFuturesFeederPartialDepthReceivesSnapshots(t *testing.T) {
+	//arrange
+	mc := make(chan string, 1)
+	defer close(mc)
+
+	ws := newTestServer(futuresPartialDepthURL, mc)
+	defer ws.Close()
+
+	mc <- futuresBookUpdate(157, 160, 149)
+
+	ff := newTestBinanceFuturesFeeder(ws)
+	defer ff.Close()
+
+	//act
+	dc, err := ff.PartialDepth(5, Speed500ms)
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, DepthSnapshot{
+		Symbol:       "BTCUSDT",
+		LastUpdateID: 160,
+		Bids:         []BookEntry{{Price: MustParseDecimal("0.0024"), Quantity: MustParseDecimal("10")}},
+		Asks:         []BookEntry{},
+	}, eventWithoutReceipt(<-dc))
+}
+
+func TestBinanceFuturesFeederPartialDepthReturnsErrorForSpotOnlySpeed(t *testing.T) {
+	//arrange
+	ff := &binanceFuturesFeeder{&binanceFeeder{}}
+
+	//act
+	_, err := ff.PartialDepth(5, Speed1000ms)
+
+	//assert
+	assert.EqualError(t, err, "unsupported update speed: 1000ms")
+}
+
+func TestBinanceFuturesFeederMarkPricesReceivesMarkPrices(t *testing.T) {
+	//arrange
+	mc := make(chan string, 1)
+	defer close(mc)
+
+	ws := newTestServer(markPriceURL, mc)
+	defer ws.Close()
+
+	mc <- rawMarkPrice
+
+	ff := newTestBinanceFuturesFeeder(ws)
+	defer ff.Close()
+
+	//act
+	mpc, err := ff.MarkPrices()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedMarkPrice, eventWithoutReceipt(<-mpc))
+}
+
+func TestBinanceFuturesFeederMarkPricesKeepReceiptAndRawPayload(t *testing.T) {
+	//arrange
+	mc := make(chan string, 1)
+	defer close(mc)
+
+	ws := newTestServer(markPriceURL, mc)
+	defer ws.Close()
+
+	mc <- rawMarkPrice
+
+	ff := newTestBinanceFuturesFeeder(ws)
+	ff.rawPayloads = true
+	defer ff.Close()
+	before := time.Now()
+
+	//act
+	mpc, err := ff.MarkPrices()
+	mp := <-mpc
+
+	//assert
+	assert.NoError(t, err)
+	assert.False(t, mp.ReceivedAt.Before(before))
+	assert.JSONEq(t, rawMarkPrice, string(mp.Raw))
+	assert.Equal(t, msTime(1562305380000), mp.EventTimestamp())
+	assert.Equal(t, msTime(1562306400000), mp.NextFundingTimestamp())
+}
+
+func TestDecodeMarkPriceAllowsContractsWithoutFunding(t *testing.T) {
+	//act
+	mp, err := decodeMarkPrice([]byte(`{"e":"markPriceUpdate","E":1,"s":"BTCUSDT_230331","p":"1","i":"1","P":"1","r":"","T":0}`))
+
+	//assert
+	assert.NoError(t, err)
+	assert.True(t, mp.FundingRate.IsZero())
+	assert.Equal(t, 0, mp.NextFundingTime)
+}
+
+func TestBinanceFuturesFeederLiquidationsReceivesLiquidations(t *testing.T) {
+	//arrange
+	mc := make(chan string, 1)
+	defer close(mc)
+
+	ws := newTestServer(liquidationsURL, mc)
+	defer ws.Close()
+
+	mc <- rawLiquidation
+
+	ff := newTestBinanceFuturesFeeder(ws)
+	defer ff.Close()
+
+	//act
+	lc, err := ff.Liquidations()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedLiquidation, eventWithoutReceipt(<-lc))
+}
+
+func TestBinanceFuturesFeederLiquidationsSkipsAndLogsOnUnmarshalError(t *testing.T) {
+	//arrange
+	mc := make(chan string, 2)
+	defer close(mc)
+
+	ws := newTestServer(liquidationsURL, mc)
+	defer ws.Close()
+
+	mc <- `{"e":"forceOrder","E":"bad"}`
+	mc <- rawLiquidation
+
+	ff := newTestBinanceFuturesFeeder(ws)
+	defer ff.Close()
+
+	//act
+	lc, err := ff.Liquidations()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedLiquidation, eventWithoutReceipt(<-lc))
+	assertContainsErrorLog(t, logBuffer.Contents(), "error unmarshalling liquidation")
+}
+
+func TestBinanceFuturesFeederContinuousKlinesReceivesKlinesOfPair(t *testing.T) {
+	//arrange
+	mc := make(chan string, 1)
+	defer close(mc)
+
+	ws := newTestServer(continuousKlinesURL, mc)
+	defer ws.Close()
+
+	mc <- rawContinuousKline
+
+	ff := newTestBinanceFuturesFeeder(ws)
+	defer ff.Close()
+
+	//act
+	kc, err := ff.ContinuousKlines(Perpetual, Interval1m)
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedContinuousKline, eventWithoutReceipt(<-kc))
+}
+
+func TestBinanceFuturesFeederContinuousKlinesReturnsErrorForUnsupportedArguments(t *testing.T) {
+	//arrange
+	ff := &binanceFuturesFeeder{&binanceFeeder{}}
+
+	//act
+	_, typeErr := ff.ContinuousKlines("weekly", Interval1m)
+	_, intervalErr := ff.ContinuousKlines(Perpetual, Interval1s)
+
+	//assert
+	assert.EqualError(t, typeErr, "unsupported contract type: weekly")
+	assert.EqualError(t, intervalErr, "unsupported kline interval: 1s")
+}
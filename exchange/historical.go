@@ -0,0 +1,453 @@
+package exchange
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Kinds of data published by Binance at https://data.binance.vision, as named in its
+// file names, e.g. BNBBTC-trades-2021-03-01.zip. Klines are named by their interval,
+// e.g. BNBBTC-1m-2021-03.zip.
+const (
+	HistoricalTrades    string = "trades"
+	HistoricalAggTrades string = "aggTrades"
+
+	// microsecondTimes is the smallest time in microseconds rather than milliseconds,
+	// as used by spot data from 2025 onwards
+	microsecondTimes = 1e14
+)
+
+var errHistoricalStreamStarted = errors.New("another stream of the historical data has already been started")
+
+// historicalFeeder is a Feeder of the CSV data published by Binance at
+// https://data.binance.vision, read from local zip or extracted CSV files
+type historicalFeeder struct {
+	files  []string
+	symbol string
+	kind   string
+	speed  float64
+
+	start       sync.Once
+	started     string
+	trades      chan Trade
+	aggTrades   chan AggTrade
+	klines      chan Kline
+	bookUpdates chan BookUpdate
+
+	lc lifecycle
+}
+
+// monthlyArchiveInterval is the name data.binance.vision gives Interval1M in kline
+// archives, as their names would otherwise clash with 1m on case-insensitive file systems
+const monthlyArchiveInterval = "1mo"
+
+// NewHistoricalFeeder returns a feeder of the given data.binance.vision files, which
+// must all be of the same symbol and kind, and keep their published names. Files are
+// read in name order, and so date order. speed is as for NewReplayFeeder.
+func NewHistoricalFeeder(speed float64, files ...string) (*historicalFeeder, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no historical data files given")
+	}
+
+	hf := &historicalFeeder{
+		speed:       speed,
+		trades:      make(chan Trade),
+		aggTrades:   make(chan AggTrade),
+		klines:      make(chan Kline),
+		bookUpdates: make(chan BookUpdate),
+	}
+
+	for _, f := range files {
+		parts := strings.Split(filepath.Base(f), "-")
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("unexpected historical data file name: %s", f)
+		}
+		symbol, kind := parts[0], parts[1]
+		if kind == monthlyArchiveInterval {
+			kind = string(Interval1M)
+		}
+		if kind != HistoricalTrades && kind != HistoricalAggTrades && !KlineInterval(kind).Valid() {
+			return nil, fmt.Errorf("unknown kind of historical data %s in %s", kind, f)
+		}
+
+		if hf.symbol == "" {
+			hf.symbol, hf.kind = symbol, kind
+		} else if symbol != hf.symbol || kind != hf.kind {
+			return nil, fmt.Errorf("historical data files must be of the same symbol and kind, %s isn't %s %s", f, hf.symbol, hf.kind)
+		}
+	}
+
+	hf.files = append([]string(nil), files...)
+	sort.Slice(hf.files, func(i, j int) bool { return filepath.Base(hf.files[i]) < filepath.Base(hf.files[j]) })
+	return hf, nil
+}
+
+// GetSymbol returns the symbol of the data, in lower case as for live feeders
+func (hf *historicalFeeder) GetSymbol() string {
+	return strings.ToLower(hf.symbol)
+}
+
+// Trades returns a read-only channel of the trades in trade or aggregated trade
+// data, sent as the live feed would. Trades from aggregated trade data have the
+// aggregate trade ID as their ID. No order IDs are published in the data.
+func (hf *historicalFeeder) Trades() (<-chan Trade, error) {
+	if hf.kind != HistoricalTrades && hf.kind != HistoricalAggTrades {
+		return nil, fmt.Errorf("no trades in %s data", hf.kind)
+	}
+	return hf.trades, hf.stream("trades")
+}
+
+// AggTrades returns a read-only channel of the aggregated trades in aggregated trade data
+func (hf *historicalFeeder) AggTrades() (<-chan AggTrade, error) {
+	if hf.kind != HistoricalAggTrades {
+		return nil, fmt.Errorf("no aggregated trades in %s data", hf.kind)
+	}
+	return hf.aggTrades, hf.stream("aggTrades")
+}
+
+// Klines returns a read-only channel of the closed klines in kline data of the interval
+func (hf *historicalFeeder) Klines(interval KlineInterval) (<-chan Kline, error) {
+	if KlineInterval(hf.kind) != interval {
+		return nil, fmt.Errorf("no %s klines in %s data", interval, hf.kind)
+	}
+	return hf.klines, hf.stream("klines")
+}
+
+// BookUpdates returns a channel that is never sent to, as Binance doesn't publish
+// order book data. It is closed once the rest of the data has been read.
+func (hf *historicalFeeder) BookUpdates() (<-chan BookUpdate, error) {
+	return hf.bookUpdates, nil
+}
+
+// stream starts reading the data into the named stream. Only one stream can be read.
+func (hf *historicalFeeder) stream(name string) error {
+	if hf.lc.closed() {
+		return errFeederClosed
+	}
+	hf.start.Do(func() {
+		hf.started = name
+		hf.lc.goroutine(hf.read)
+	})
+	if hf.started != name {
+		return errHistoricalStreamStarted
+	}
+	return nil
+}
+
+// Close stops reading the data and closes every channel
+func (hf *historicalFeeder) Close() error {
+	hf.lc.close()
+
+	hf.start.Do(func() {
+		hf.closeAll()
+	})
+	return nil
+}
+
+func (hf *historicalFeeder) closeAll() {
+	close(hf.trades)
+	close(hf.aggTrades)
+	close(hf.klines)
+	close(hf.bookUpdates)
+}
+
+func (hf *historicalFeeder) read() {
+	defer hf.closeAll()
+
+	rows := &csvRows{files: hf.files}
+	defer rows.close()
+	p := pacer{speed: hf.speed, lc: &hf.lc}
+
+	for {
+		row, ok := rows.next()
+		if !ok {
+			return
+		}
+
+		var err error
+		var sent bool
+		switch hf.started {
+		case "trades":
+			var t Trade
+			if hf.kind == HistoricalTrades {
+				t, err = parseHistoricalTrade(hf.symbol, row)
+			} else {
+				var at AggTrade
+				at, err = parseHistoricalAggTrade(hf.symbol, row)
+				t = Trade{Type: "trade", Symbol: at.Symbol, ID: at.ID, TradeTime: at.TradeTime, EventTime: at.EventTime, Price: at.Price, Quantity: at.Quantity, IsBuyerMaker: at.IsBuyerMaker}
+			}
+			if err == nil && p.wait(t.EventTime) {
+				select {
+				case hf.trades <- t:
+					sent = true
+				case <-hf.lc.done():
+				}
+			}
+		case "aggTrades":
+			var at AggTrade
+			if at, err = parseHistoricalAggTrade(hf.symbol, row); err == nil && p.wait(at.EventTime) {
+				select {
+				case hf.aggTrades <- at:
+					sent = true
+				case <-hf.lc.done():
+				}
+			}
+		case "klines":
+			var k Kline
+			if k, err = parseHistoricalKline(hf.symbol, KlineInterval(hf.kind), row); err == nil && p.wait(k.EventTime) {
+				select {
+				case hf.klines <- k:
+					sent = true
+				case <-hf.lc.done():
+				}
+			}
+		}
+
+		if err != nil {
+			if !isHeader(row) {
+				log.Error().Err(err).
+					Str("detail", strings.Join(row, ",")).
+					Msgf("error parsing historical %s", hf.kind)
+			}
+			continue
+		}
+		if !sent {
+			return
+		}
+	}
+}
+
+// isHeader reports whether the row is the header some files start with
+func isHeader(row []string) bool {
+	_, err := strconv.Atoi(row[0])
+	return err != nil
+}
+
+// fields parses CSV fields, keeping the first error
+type fields struct {
+	row []string
+	err error
+}
+
+func (f *fields) int(i int) int {
+	if f.err != nil {
+		return 0
+	}
+	var v int
+	if i >= len(f.row) {
+		f.err = fmt.Errorf("missing field %d", i)
+	} else if v, f.err = strconv.Atoi(f.row[i]); f.err != nil {
+		return 0
+	}
+	return v
+}
+
+// time parses a timestamp in milliseconds, converting it from microseconds if need be
+func (f *fields) time(i int) int {
+	t := f.int(i)
+	if t >= microsecondTimes {
+		t /= 1000
+	}
+	return t
+}
+
+func (f *fields) decimal(i int) Decimal {
+	if f.err != nil {
+		return Decimal{}
+	}
+	var d Decimal
+	if i >= len(f.row) {
+		f.err = fmt.Errorf("missing field %d", i)
+	} else {
+		d, f.err = ParseDecimal(f.row[i])
+	}
+	return d
+}
+
+func (f *fields) bool(i int) bool {
+	if f.err != nil {
+		return false
+	}
+	var b bool
+	if i >= len(f.row) {
+		f.err = fmt.Errorf("missing field %d", i)
+	} else {
+		b, f.err = strconv.ParseBool(f.row[i])
+	}
+	return b
+}
+
+// Trade rows are: trade ID, price, quantity, quote quantity, time, is buyer maker, is best match
+func parseHistoricalTrade(symbol string, row []string) (Trade, error) {
+	f := fields{row: row}
+	t := Trade{
+		Type:     "trade",
+		Symbol:   symbol,
+		ID:       f.int(0),
+		Price:    f.decimal(1),
+		Quantity: f.decimal(2),
+	}
+	t.TradeTime = f.time(4)
+	t.IsBuyerMaker = f.bool(5)
+	t.EventTime = t.TradeTime
+	return t, f.err
+}
+
+// Aggregated trade rows are: aggregate trade ID, price, quantity, first trade ID,
+// last trade ID, time, is buyer maker, is best match
+func parseHistoricalAggTrade(symbol string, row []string) (AggTrade, error) {
+	f := fields{row: row}
+	at := AggTrade{
+		Type:         "aggTrade",
+		Symbol:       symbol,
+		ID:           f.int(0),
+		Price:        f.decimal(1),
+		Quantity:     f.decimal(2),
+		FirstTradeID: f.int(3),
+		LastTradeID:  f.int(4),
+		TradeTime:    f.time(5),
+		IsBuyerMaker: f.bool(6),
+	}
+	at.EventTime = at.TradeTime
+	return at, f.err
+}
+
+// Kline rows are: open time, open, high, low, close, volume, close time, quote volume,
+// trade count, taker buy volume, taker buy quote volume, ignore
+func parseHistoricalKline(symbol string, interval KlineInterval, row []string) (Kline, error) {
+	f := fields{row: row}
+	k := Kline{
+		Symbol:              symbol,
+		Interval:            interval,
+		StartTime:           f.time(0),
+		Open:                f.decimal(1),
+		High:                f.decimal(2),
+		Low:                 f.decimal(3),
+		Close:               f.decimal(4),
+		Volume:              f.decimal(5),
+		CloseTime:           f.time(6),
+		QuoteVolume:         f.decimal(7),
+		TradeCount:          f.int(8),
+		TakerBuyVolume:      f.decimal(9),
+		TakerBuyQuoteVolume: f.decimal(10),
+		Closed:              true,
+	}
+	k.EventTime = k.CloseTime
+	return k, f.err
+}
+
+// csvRows reads the rows of a sequence of CSV files, or zip files of CSV files,
+// in turn. Files that can't be read are logged and skipped.
+type csvRows struct {
+	files []string
+
+	closers []io.Closer
+	entries []*zip.File
+	reader  *csv.Reader
+}
+
+func (cr *csvRows) next() ([]string, bool) {
+	for {
+		if cr.reader == nil && !cr.openNext() {
+			return nil, false
+		}
+
+		row, err := cr.reader.Read()
+		if err == io.EOF {
+			cr.closeReader()
+			continue
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("error reading historical data")
+			if _, ok := err.(*csv.ParseError); !ok {
+				cr.closeReader()
+			}
+			continue
+		}
+		return row, true
+	}
+}
+
+// openNext opens the next CSV file, either the next entry of the current zip
+// file or the next file, returning false once there are none left
+func (cr *csvRows) openNext() bool {
+	for {
+		if len(cr.entries) > 0 {
+			entry := cr.entries[0]
+			cr.entries = cr.entries[1:]
+			rc, err := entry.Open()
+			if err != nil {
+				log.Error().Err(err).Str("file", entry.Name).Msg("error opening historical data")
+				continue
+			}
+			cr.setReader(rc)
+			return true
+		}
+
+		cr.close()
+		if len(cr.files) == 0 {
+			return false
+		}
+		name := cr.files[0]
+		cr.files = cr.files[1:]
+
+		if strings.HasSuffix(name, ".zip") {
+			zr, err := zip.OpenReader(name)
+			if err != nil {
+				log.Error().Err(err).Str("file", name).Msg("error opening historical data")
+				continue
+			}
+			cr.closers = append(cr.closers, zr)
+			for _, entry := range zr.File {
+				if strings.HasSuffix(entry.Name, ".csv") {
+					cr.entries = append(cr.entries, entry)
+				}
+			}
+			continue
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			log.Error().Err(err).Str("file", name).Msg("error opening historical data")
+			continue
+		}
+		cr.setReader(f)
+		return true
+	}
+}
+
+func (cr *csvRows) setReader(rc io.ReadCloser) {
+	cr.closers = append(cr.closers, rc)
+	cr.reader = csv.NewReader(rc)
+	cr.reader.FieldsPerRecord = -1
+	cr.reader.ReuseRecord = true
+}
+
+// closeReader closes the current CSV file, leaving its zip file open for its other entries
+func (cr *csvRows) closeReader() {
+	if cr.reader == nil {
+		return
+	}
+	cr.reader = nil
+	last := len(cr.closers) - 1
+	cr.closers[last].Close()
+	cr.closers = cr.closers[:last]
+}
+
+func (cr *csvRows) close() {
+	for _, c := range cr.closers {
+		c.Close()
+	}
+	cr.closers, cr.entries, cr.reader = nil, nil, nil
+}
@@ -0,0 +1,263 @@
+package exchange
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	historicalTradesCSV = `12345,0.00100000,100.00000000,0.10000000,1614556800000,true,true
+12346,0.00110000,50.00000000,0.05500000,1614556801000,false,true
+`
+	historicalAggTradesCSV = `agg_trade_id,price,quantity,first_trade_id,last_trade_id,transact_time,is_buyer_maker,is_best_match
+500,0.00100000,100.00000000,12345,12346,1735689600000000,true,true
+`
+	historicalKlinesCSV = `1614556800000,0.00100000,0.00250000,0.00150000,0.00200000,1000.00000000,1614556859999,1.00000000,100,500.00000000,0.50000000,0
+`
+)
+
+// writeZippedCSV writes a zip file containing a single CSV file, as published by Binance
+func writeZippedCSV(t *testing.T, dir string, name string, csv string) string {
+	path := filepath.Join(dir, name+".zip")
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	w, err := zw.Create(name + ".csv")
+	assert.NoError(t, err)
+	_, err = w.Write([]byte(csv))
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+	return path
+}
+
+func writeCSV(t *testing.T, dir string, name string, csv string) string {
+	path := filepath.Join(dir, name+".csv")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(csv), 0644))
+	return path
+}
+
+func TestNewHistoricalFeederReturnsErrorForMixedFiles(t *testing.T) {
+	_, err := NewHistoricalFeeder(ReplayASAP, "BNBBTC-trades-2021-03-01.zip", "BNBBTC-aggTrades-2021-03-02.zip")
+	assert.Error(t, err)
+
+	_, err = NewHistoricalFeeder(ReplayASAP, "BNBBTC-trades-2021-03-01.zip", "ETHBTC-trades-2021-03-02.zip")
+	assert.Error(t, err)
+
+	_, err = NewHistoricalFeeder(ReplayASAP, "BNBBTC-bookDepth-2021-03-01.zip")
+	assert.Error(t, err)
+
+	_, err = NewHistoricalFeeder(ReplayASAP)
+	assert.Error(t, err)
+}
+
+func TestHistoricalFeederImplementsFeederInterfaces(t *testing.T) {
+	hf, err := NewHistoricalFeeder(ReplayASAP, "BNBBTC-trades-2021-03-01.zip")
+
+	assert.NoError(t, err)
+	assert.Implements(t, (*Feeder)(nil), hf, "Does not implement interface")
+	assert.Implements(t, (*AggTradeFeeder)(nil), hf, "Does not implement interface")
+	assert.Implements(t, (*KlineFeeder)(nil), hf, "Does not implement interface")
+	assert.Equal(t, "bnbbtc", hf.GetSymbol())
+}
+
+func TestHistoricalFeederTradesEmitsTradesAsLiveFeed(t *testing.T) {
+	//arrange
+	dir := t.TempDir()
+	// files are read in date order, whichever order they are given in
+	second := writeCSV(t, dir, "BNBBTC-trades-2021-03-02", "12347,0.00120000,1.00000000,0.00120000,1614643200000,true,true\n")
+	first := writeZippedCSV(t, dir, "BNBBTC-trades-2021-03-01", historicalTradesCSV)
+
+	hf, err := NewHistoricalFeeder(ReplayASAP, second, first)
+	assert.NoError(t, err)
+	defer hf.Close()
+
+	//act
+	tc, err := hf.Trades()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, Trade{
+		Type:         "trade",
+		Symbol:       "BNBBTC",
+		ID:           12345,
+		TradeTime:    1614556800000,
+		EventTime:    1614556800000,
+		Price:        MustParseDecimal("0.001"),
+		Quantity:     MustParseDecimal("100"),
+		IsBuyerMaker: true,
+	}, <-tc)
+	assert.Equal(t, 12346, (<-tc).ID)
+	assert.Equal(t, 12347, (<-tc).ID)
+
+	_, ok := <-tc
+	assert.False(t, ok)
+}
+
+func TestHistoricalFeederAggTradesSkipsHeaderAndConvertsMicroseconds(t *testing.T) {
+	//arrange
+	dir := t.TempDir()
+	file := writeZippedCSV(t, dir, "BNBBTC-aggTrades-2025-01", historicalAggTradesCSV)
+
+	hf, err := NewHistoricalFeeder(ReplayASAP, file)
+	assert.NoError(t, err)
+	defer hf.Close()
+
+	//act
+	atChan, err := hf.AggTrades()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, AggTrade{
+		Type:         "aggTrade",
+		Symbol:       "BNBBTC",
+		ID:           500,
+		FirstTradeID: 12345,
+		LastTradeID:  12346,
+		TradeTime:    1735689600000,
+		EventTime:    1735689600000,
+		Price:        MustParseDecimal("0.001"),
+		Quantity:     MustParseDecimal("100"),
+		IsBuyerMaker: true,
+	}, <-atChan)
+
+	_, ok := <-atChan
+	assert.False(t, ok)
+}
+
+func TestHistoricalFeederTradesFromAggregatedTrades(t *testing.T) {
+	//arrange
+	file := writeZippedCSV(t, t.TempDir(), "BNBBTC-aggTrades-2025-01", historicalAggTradesCSV)
+	hf, err := NewHistoricalFeeder(ReplayASAP, file)
+	assert.NoError(t, err)
+	defer hf.Close()
+
+	//act
+	tc, err := hf.Trades()
+
+	//assert
+	assert.NoError(t, err)
+	trade := <-tc
+	assert.Equal(t, 500, trade.ID)
+	assert.Equal(t, "trade", trade.Type)
+	assert.Equal(t, MustParseDecimal("100"), trade.Quantity)
+
+	_, err = hf.AggTrades()
+	assert.Equal(t, errHistoricalStreamStarted, err)
+}
+
+func TestHistoricalFeederKlinesEmitsClosedKlines(t *testing.T) {
+	//arrange
+	file := writeCSV(t, t.TempDir(), "BNBBTC-1m-2021-03-01", historicalKlinesCSV)
+	hf, err := NewHistoricalFeeder(ReplayASAP, file)
+	assert.NoError(t, err)
+	defer hf.Close()
+
+	//act
+	_, err = hf.Klines(Interval5m)
+	assert.Error(t, err)
+	_, err = hf.Trades()
+	assert.Error(t, err)
+	kc, err := hf.Klines(Interval1m)
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, Kline{
+		EventTime:           1614556859999,
+		Symbol:              "BNBBTC",
+		Interval:            Interval1m,
+		StartTime:           1614556800000,
+		CloseTime:           1614556859999,
+		Open:                MustParseDecimal("0.001"),
+		High:                MustParseDecimal("0.0025"),
+		Low:                 MustParseDecimal("0.0015"),
+		Close:               MustParseDecimal("0.002"),
+		Volume:              MustParseDecimal("1000"),
+		QuoteVolume:         MustParseDecimal("1"),
+		TradeCount:          100,
+		TakerBuyVolume:      MustParseDecimal("500"),
+		TakerBuyQuoteVolume: MustParseDecimal("0.5"),
+		Closed:              true,
+	}, <-kc)
+}
+
+func TestHistoricalFeederKlinesOfMonthlyArchive(t *testing.T) {
+	//arrange
+	file := writeZippedCSV(t, t.TempDir(), "BTCUSDT-1mo-2021-01", historicalKlinesCSV)
+	hf, err := NewHistoricalFeeder(ReplayASAP, file)
+	assert.NoError(t, err)
+	defer hf.Close()
+
+	//act
+	kc, err := hf.Klines(Interval1M)
+
+	//assert
+	assert.NoError(t, err)
+	k := <-kc
+	assert.Equal(t, Interval1M, k.Interval)
+	assert.Equal(t, "BTCUSDT", k.Symbol)
+}
+
+func TestHistoricalFeederSkipsAndLogsBadRows(t *testing.T) {
+	//arrange
+	logBuffer.Reset()
+	file := writeCSV(t, t.TempDir(), "BNBBTC-trades-2021-03-01", "12344,abc,1,1,1614556800000,true,true\n"+historicalTradesCSV)
+
+	hf, err := NewHistoricalFeeder(ReplayASAP, file)
+	assert.NoError(t, err)
+	defer hf.Close()
+
+	//act
+	tc, _ := hf.Trades()
+
+	//assert
+	assert.Equal(t, 12345, (<-tc).ID)
+	assertContainsErrorLog(t, logBuffer.Contents(), "error parsing historical trades")
+}
+
+func TestHistoricalFeederBookUpdatesClosedOnceDataRead(t *testing.T) {
+	//arrange
+	file := writeCSV(t, t.TempDir(), "BNBBTC-trades-2021-03-01", historicalTradesCSV)
+	hf, err := NewHistoricalFeeder(ReplayASAP, file)
+	assert.NoError(t, err)
+	defer hf.Close()
+
+	//act
+	tc, _ := hf.Trades()
+	buChan, err := hf.BookUpdates()
+	for range tc {
+	}
+
+	//assert
+	assert.NoError(t, err)
+	_, ok := <-buChan
+	assert.False(t, ok)
+}
+
+func TestHistoricalFeederCloseClosesChannels(t *testing.T) {
+	//arrange
+	file := writeCSV(t, t.TempDir(), "BNBBTC-trades-2021-03-01", historicalTradesCSV)
+	hf, err := NewHistoricalFeeder(ReplayASAP, file)
+	assert.NoError(t, err)
+	tc, _ := hf.Trades()
+	buChan, _ := hf.BookUpdates()
+
+	//act
+	err = hf.Close()
+
+	//assert
+	assert.NoError(t, err)
+	_, ok := <-tc
+	assert.False(t, ok)
+	_, ok = <-buChan
+	assert.False(t, ok)
+
+	_, err = hf.Trades()
+	assert.Equal(t, errFeederClosed, err)
+}
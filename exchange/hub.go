@@ -0,0 +1,407 @@
+package exchange
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// HubOptions configures how a hub buffers events for each subscriber.
+// Policy decides what happens when a subscriber falls BufferSize events behind.
+type HubOptions struct {
+	BufferSize int
+	Policy     OverflowPolicy
+}
+
+var DefaultHubOptions = &HubOptions{
+	BufferSize: 1000,
+	Policy:     DropOldest,
+}
+
+// hub shares one feed between many subscribers, each receiving every event
+// on its own channel
+type hub struct {
+	feed Feeder
+	opts *HubOptions
+	lc   lifecycle
+
+	mu          sync.Mutex
+	closed      bool
+	subscribers map[*hubSubscriber]bool
+	trades      hubStream
+	bookUpdates hubStream
+}
+
+// hubStream is the state of one of the feed's streams
+type hubStream struct {
+	starting *hubStart // set while the feed's stream is being requested
+	started  bool
+	ended    bool
+	buffers  map[*eventBuffer]bool
+}
+
+// hubStart is a request for one of the feed's streams, which subscribers arriving
+// while it is in progress wait on rather than making their own
+type hubStart struct {
+	done chan struct{}
+	err  error // set before done is closed
+}
+
+// NewHub returns a hub sharing the feed. The hub is itself a Feeder, every call
+// to Trades or BookUpdates subscribing a new channel, so many agents can be given
+// the same hub. The feed's streams are requested once, by the first subscriber.
+// DefaultHubOptions are used if opts is nil.
+func NewHub(feed Feeder, opts *HubOptions) *hub {
+	if opts == nil {
+		opts = DefaultHubOptions
+	}
+	return &hub{
+		feed:        feed,
+		opts:        opts,
+		subscribers: make(map[*hubSubscriber]bool),
+		trades:      hubStream{buffers: make(map[*eventBuffer]bool)},
+		bookUpdates: hubStream{buffers: make(map[*eventBuffer]bool)},
+	}
+}
+
+func (h *hub) GetSymbol() string {
+	return h.feed.GetSymbol()
+}
+
+// RESTURL returns the REST API host of the shared feed's exchange
+func (h *hub) RESTURL() string {
+	return restURLOf(h.feed)
+}
+
+func (h *hub) depthSnapshotPath() string {
+	return depthSnapshotPathOf(h.feed)
+}
+
+// DepthGaps returns the shared feed's channel of depth gaps, nil if it has none.
+// Each gap is received by only one of its readers.
+func (h *hub) DepthGaps() <-chan DepthGap {
+	return depthGapsOf(h.feed)
+}
+
+func (h *hub) keepRawPayloads() bool {
+	return keepRawPayloadsOf(h.feed)
+}
+
+func (h *hub) streamNames() (string, string) {
+	return streamNamesOf(h.feed)
+}
+
+// Trades returns a new subscription to the feed's trades, open until the hub is closed
+func (h *hub) Trades() (<-chan Trade, error) {
+	return h.Subscribe().Trades()
+}
+
+// BookUpdates returns a new subscription to the feed's book updates, open until
+// the hub is closed
+func (h *hub) BookUpdates() (<-chan BookUpdate, error) {
+	return h.Subscribe().BookUpdates()
+}
+
+// Subscribe returns a subscriber to the hub, itself a Feeder whose Close ends
+// only its own subscriptions
+func (h *hub) Subscribe() *hubSubscriber {
+	s := &hubSubscriber{hub: h}
+
+	h.mu.Lock()
+	if !h.closed {
+		h.subscribers[s] = true
+	}
+	h.mu.Unlock()
+	return s
+}
+
+// Close closes the feed and every subscriber's channels
+func (h *hub) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	subscribers := h.subscribers
+	h.subscribers = nil
+	h.mu.Unlock()
+
+	h.lc.close()
+	err := h.feed.Close()
+	for s := range subscribers {
+		s.Close()
+	}
+	return err
+}
+
+// subscribe adds the buffer to the stream, starting the stream if it's the first.
+// The lock isn't held while the stream is started, as connecting can take a long
+// time, during which the hub can still be subscribed to and closed.
+func (h *hub) subscribe(stream *hubStream, b *eventBuffer, start func() error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for !stream.started {
+		if h.closed {
+			return errFeederClosed
+		}
+
+		if attempt := stream.starting; attempt != nil {
+			h.mu.Unlock()
+			<-attempt.done
+			h.mu.Lock()
+
+			if attempt.err != nil {
+				return attempt.err
+			}
+			continue
+		}
+
+		attempt := &hubStart{done: make(chan struct{})}
+		stream.starting = attempt
+		h.mu.Unlock()
+		err := start()
+		h.mu.Lock()
+
+		stream.starting = nil
+		stream.started = err == nil
+		attempt.err = err
+		close(attempt.done)
+		if err != nil {
+			return err
+		}
+	}
+
+	if h.closed {
+		return errFeederClosed
+	}
+	if stream.ended {
+		b.close()
+		return nil
+	}
+	stream.buffers[b] = true
+	return nil
+}
+
+func (h *hub) unsubscribe(s *hubSubscriber, buffers []*eventBuffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subscribers, s)
+	for _, b := range buffers {
+		delete(h.trades.buffers, b)
+		delete(h.bookUpdates.buffers, b)
+	}
+}
+
+func (h *hub) startTrades() error {
+	tChan, err := h.feed.Trades()
+	if err != nil {
+		return err
+	}
+
+	h.lc.goroutine(func() {
+		for {
+			select {
+			case t, ok := <-tChan:
+				if !ok {
+					h.end(&h.trades)
+					return
+				}
+				h.broadcast(&h.trades, t)
+			case <-h.lc.done():
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func (h *hub) startBookUpdates() error {
+	buChan, err := h.feed.BookUpdates()
+	if err != nil {
+		return err
+	}
+
+	h.lc.goroutine(func() {
+		for {
+			select {
+			case b, ok := <-buChan:
+				if !ok {
+					h.end(&h.bookUpdates)
+					return
+				}
+				h.broadcast(&h.bookUpdates, b)
+			case <-h.lc.done():
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// broadcast gives the event to every subscriber of the stream, removing those
+// that have been disconnected or closed
+func (h *hub) broadcast(stream *hubStream, e interface{}) {
+	h.mu.Lock()
+	buffers := make([]*eventBuffer, 0, len(stream.buffers))
+	for b := range stream.buffers {
+		buffers = append(buffers, b)
+	}
+	h.mu.Unlock()
+
+	for _, b := range buffers {
+		if b.push(e, h.lc.done()) {
+			continue
+		}
+
+		h.mu.Lock()
+		if stream.buffers[b] && h.opts.Policy == Disconnect {
+			log.Warn().
+				Str("symbol", h.feed.GetSymbol()).
+				Msg("disconnecting slow hub subscriber")
+		}
+		delete(stream.buffers, b)
+		h.mu.Unlock()
+	}
+}
+
+// end closes the subscribers' buffers once the feed's stream has closed, so that
+// their channels close after the last events are received
+func (h *hub) end(stream *hubStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stream.ended = true
+	for b := range stream.buffers {
+		b.close()
+	}
+	stream.buffers = make(map[*eventBuffer]bool)
+}
+
+// hubSubscriber is a Feeder of a hub's events, buffering them in case it falls behind
+type hubSubscriber struct {
+	hub *hub
+	lc  lifecycle
+
+	mu      sync.Mutex
+	closed  bool
+	buffers []*eventBuffer
+}
+
+func (s *hubSubscriber) GetSymbol() string {
+	return s.hub.GetSymbol()
+}
+
+// RESTURL returns the REST API host of the hub's feed's exchange
+func (s *hubSubscriber) RESTURL() string {
+	return s.hub.RESTURL()
+}
+
+func (s *hubSubscriber) depthSnapshotPath() string {
+	return s.hub.depthSnapshotPath()
+}
+
+// DepthGaps returns the hub's channel of depth gaps
+func (s *hubSubscriber) DepthGaps() <-chan DepthGap {
+	return s.hub.DepthGaps()
+}
+
+func (s *hubSubscriber) keepRawPayloads() bool {
+	return s.hub.keepRawPayloads()
+}
+
+func (s *hubSubscriber) streamNames() (string, string) {
+	return s.hub.streamNames()
+}
+
+// Trades returns a read-only channel of the hub's trades
+func (s *hubSubscriber) Trades() (<-chan Trade, error) {
+	b, err := s.subscribe(&s.hub.trades, s.hub.startTrades, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tChan := make(chan Trade)
+	s.lc.goroutine(func() {
+		defer close(tChan)
+		b.forward(s.lc.done(), func(e interface{}) bool {
+			select {
+			case tChan <- e.(Trade):
+				return true
+			case <-s.lc.done():
+				return false
+			}
+		})
+	})
+	return tChan, nil
+}
+
+// BookUpdates returns a read-only channel of the hub's book updates
+func (s *hubSubscriber) BookUpdates() (<-chan BookUpdate, error) {
+	b, err := s.subscribe(&s.hub.bookUpdates, s.hub.startBookUpdates, mergeBookUpdates)
+	if err != nil {
+		return nil, err
+	}
+
+	buChan := make(chan BookUpdate)
+	s.lc.goroutine(func() {
+		defer close(buChan)
+		b.forward(s.lc.done(), func(e interface{}) bool {
+			select {
+			case buChan <- e.(BookUpdate):
+				return true
+			case <-s.lc.done():
+				return false
+			}
+		})
+	})
+	return buChan, nil
+}
+
+func (s *hubSubscriber) subscribe(stream *hubStream, start func() error, merge func(interface{}, interface{}) interface{}) (*eventBuffer, error) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return nil, errFeederClosed
+	}
+
+	b := newEventBuffer(s.hub.opts.BufferSize, s.hub.opts.Policy)
+	b.merge = merge
+	if err := s.hub.subscribe(stream, b, start); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		// closed while subscribing, so undo the subscription
+		s.hub.unsubscribe(s, []*eventBuffer{b})
+		b.close()
+		return nil, errFeederClosed
+	}
+	s.buffers = append(s.buffers, b)
+	return b, nil
+}
+
+// Close ends the subscriber's subscriptions and closes its channels, leaving the
+// hub and other subscribers running
+func (s *hubSubscriber) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	buffers := s.buffers
+	s.mu.Unlock()
+
+	s.hub.unsubscribe(s, buffers)
+	for _, b := range buffers {
+		b.close()
+	}
+	s.lc.close()
+	return nil
+}
@@ -0,0 +1,277 @@
+package exchange
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingFeeder counts the streams requested of it
+type countingFeeder struct {
+	*closeTrackingFeeder
+	tradeCalls int
+	err        error
+}
+
+func (cf *countingFeeder) Trades() (<-chan Trade, error) {
+	cf.tradeCalls++
+	if cf.err != nil {
+		return nil, cf.err
+	}
+	return cf.stubFeeder.Trades()
+}
+
+// dialingFeeder's Trades blocks, as if connecting, until it is closed
+type dialingFeeder struct {
+	*stubFeeder
+	calls     int32
+	dialing   chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newDialingFeeder() *dialingFeeder {
+	return &dialingFeeder{
+		stubFeeder: newStubFeeder(testSymbol),
+		dialing:    make(chan struct{}, 10),
+		closed:     make(chan struct{}),
+	}
+}
+
+func (df *dialingFeeder) Trades() (<-chan Trade, error) {
+	atomic.AddInt32(&df.calls, 1)
+	df.dialing <- struct{}{}
+	<-df.closed
+	return nil, errFeederClosed
+}
+
+func (df *dialingFeeder) Close() error {
+	df.closeOnce.Do(func() { close(df.closed) })
+	return nil
+}
+
+func newTestHub(policy OverflowPolicy, bufferSize int) (*hub, *countingFeeder) {
+	feed := &countingFeeder{closeTrackingFeeder: &closeTrackingFeeder{stubFeeder: newStubFeeder(testSymbol)}}
+	return NewHub(feed, &HubOptions{BufferSize: bufferSize, Policy: policy}), feed
+}
+
+func TestHubImplementsFeederInterface(t *testing.T) {
+	h, _ := newTestHub(DropOldest, 10)
+
+	assert.Implements(t, (*Feeder)(nil), h, "Does not implement interface")
+	assert.Implements(t, (*Feeder)(nil), h.Subscribe(), "Does not implement interface")
+	assert.Equal(t, testSymbol, h.GetSymbol())
+	assert.Equal(t, testSymbol, h.Subscribe().GetSymbol())
+}
+
+func TestHubSendsEveryEventToEverySubscriber(t *testing.T) {
+	//arrange
+	h, feed := newTestHub(Block, 10)
+	defer h.Close()
+
+	//act
+	tc1, err := h.Trades()
+	assert.NoError(t, err)
+	tc2, err := h.Trades()
+	assert.NoError(t, err)
+	buChan1, err := h.BookUpdates()
+	assert.NoError(t, err)
+	buChan2, err := h.BookUpdates()
+	assert.NoError(t, err)
+
+	feed.trades <- expectedTrade
+	feed.bookUpdates <- expectedBookUpdate
+
+	//assert
+	assert.Equal(t, expectedTrade, <-tc1)
+	assert.Equal(t, expectedTrade, <-tc2)
+	assert.Equal(t, expectedBookUpdate, <-buChan1)
+	assert.Equal(t, expectedBookUpdate, <-buChan2)
+	assert.Equal(t, 1, feed.tradeCalls)
+}
+
+func TestHubReturnsErrorWhenFeedFails(t *testing.T) {
+	h, feed := newTestHub(Block, 10)
+	feed.err = errors.New("trade error")
+
+	_, err := h.Trades()
+	assert.Error(t, err)
+
+	// the stream is requested again by the next subscriber
+	feed.err = nil
+	_, err = h.Trades()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, feed.tradeCalls)
+}
+
+func TestNewHubDefaultsNilOptions(t *testing.T) {
+	h := NewHub(newStubFeeder(testSymbol), nil)
+
+	assert.Equal(t, DefaultHubOptions, h.opts)
+}
+
+func TestHubCanBeUsedAndClosedWhileConnecting(t *testing.T) {
+	//arrange
+	feed := newDialingFeeder()
+	h := NewHub(feed, nil)
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := h.Trades()
+		errs <- err
+	}()
+	<-feed.dialing
+
+	//act
+	go func() {
+		_, err := h.Trades()
+		errs <- err
+	}()
+	buChan, err := h.BookUpdates()
+	assert.NoError(t, err)
+
+	closed := make(chan error)
+	go func() {
+		closed <- h.Close()
+	}()
+
+	//assert
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked by connecting stream")
+	}
+	assert.Equal(t, errFeederClosed, <-errs)
+	assert.Equal(t, errFeederClosed, <-errs)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&feed.calls), "second subscriber waits on the first's request")
+
+	_, ok := <-buChan
+	assert.False(t, ok)
+}
+
+func TestHubSlowSubscriberDoesNotHoldUpOthers(t *testing.T) {
+	//arrange
+	h, feed := newTestHub(DropNewest, 2)
+	defer h.Close()
+	slow, _ := h.Trades()
+	fast, _ := h.Trades()
+
+	//act
+	for i := 1; i <= 10; i++ {
+		feed.trades <- Trade{ID: i}
+		assert.Equal(t, i, (<-fast).ID)
+	}
+	close(feed.trades)
+
+	//assert at most the buffer and the event being sent were kept
+	var ids []int
+	for t := range slow {
+		ids = append(ids, t.ID)
+	}
+	assert.True(t, len(ids) >= 2 && len(ids) <= 3, ids)
+	assert.Equal(t, 1, ids[0])
+}
+
+func TestHubDisconnectsSlowSubscriber(t *testing.T) {
+	//arrange
+	logBuffer.Reset()
+	h, feed := newTestHub(Disconnect, 2)
+	defer h.Close()
+	slow, _ := h.Trades()
+	fast, _ := h.Trades()
+
+	//act
+	for i := 1; i <= 10; i++ {
+		feed.trades <- Trade{ID: i}
+		assert.Equal(t, i, (<-fast).ID)
+	}
+
+	//assert
+	received := 0
+	for range slow {
+		received++
+	}
+	assert.True(t, received <= 1, received)
+	logs := logBuffer.Contents()
+	assert.Contains(t, logs.String(), "disconnecting slow hub subscriber")
+}
+
+func TestHubClosesSubscribersOnceFeedEnds(t *testing.T) {
+	//arrange
+	h, feed := newTestHub(Block, 10)
+	defer h.Close()
+	tc, _ := h.Trades()
+
+	//act
+	feed.trades <- expectedTrade
+	close(feed.trades)
+
+	//assert
+	assert.Equal(t, expectedTrade, <-tc)
+	_, ok := <-tc
+	assert.False(t, ok)
+
+	// late subscribers find the stream already ended
+	tc, err := h.Trades()
+	assert.NoError(t, err)
+	_, ok = <-tc
+	assert.False(t, ok)
+}
+
+func TestHubSubscriberCloseLeavesOthersRunning(t *testing.T) {
+	//arrange
+	h, feed := newTestHub(Block, 1)
+	defer h.Close()
+	s := h.Subscribe()
+	closing, _ := s.Trades()
+	open, _ := h.Trades()
+
+	//act
+	err := s.Close()
+
+	//assert
+	assert.NoError(t, err)
+	_, ok := <-closing
+	assert.False(t, ok)
+	_, err = s.Trades()
+	assert.Equal(t, errFeederClosed, err)
+
+	for i := 1; i <= 3; i++ {
+		feed.trades <- Trade{ID: i}
+		assert.Equal(t, i, (<-open).ID)
+	}
+	assert.False(t, feed.closed)
+}
+
+func TestHubCloseClosesFeedAndSubscribers(t *testing.T) {
+	//arrange
+	h, feed := newTestHub(Block, 1)
+	tc, _ := h.Trades()
+	buChan, _ := h.BookUpdates()
+
+	// a blocked subscriber doesn't stop the hub closing
+	feed.trades <- Trade{ID: 1}
+	feed.trades <- Trade{ID: 2}
+	feed.trades <- Trade{ID: 3}
+	time.Sleep(50 * time.Millisecond)
+
+	//act
+	err := h.Close()
+
+	//assert
+	assert.NoError(t, err)
+	assert.True(t, feed.closed)
+	for range tc {
+	}
+	_, ok := <-buChan
+	assert.False(t, ok)
+
+	_, err = h.Trades()
+	assert.Equal(t, errFeederClosed, err)
+	assert.NoError(t, h.Close())
+}
@@ -0,0 +1,160 @@
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// KlineInterval is the period covered by a single kline
+type KlineInterval string
+
+// Kline intervals supported by Binance
+const (
+	Interval1s  KlineInterval = "1s"
+	Interval1m  KlineInterval = "1m"
+	Interval3m  KlineInterval = "3m"
+	Interval5m  KlineInterval = "5m"
+	Interval15m KlineInterval = "15m"
+	Interval30m KlineInterval = "30m"
+	Interval1h  KlineInterval = "1h"
+	Interval2h  KlineInterval = "2h"
+	Interval4h  KlineInterval = "4h"
+	Interval6h  KlineInterval = "6h"
+	Interval8h  KlineInterval = "8h"
+	Interval12h KlineInterval = "12h"
+	Interval1d  KlineInterval = "1d"
+	Interval3d  KlineInterval = "3d"
+	Interval1w  KlineInterval = "1w"
+	Interval1M  KlineInterval = "1M"
+)
+
+// KlineIntervals contains every kline interval supported by Binance, shortest first
+var KlineIntervals = []KlineInterval{
+	Interval1s, Interval1m, Interval3m, Interval5m, Interval15m, Interval30m,
+	Interval1h, Interval2h, Interval4h, Interval6h, Interval8h, Interval12h,
+	Interval1d, Interval3d, Interval1w, Interval1M,
+}
+
+// Valid reports whether the interval is supported by Binance
+func (ki KlineInterval) Valid() bool {
+	for _, i := range KlineIntervals {
+		if ki == i {
+			return true
+		}
+	}
+	return false
+}
+
+// Taken from https://binance-docs.github.io/apidocs/spot/en/#kline-candlestick-streams
+// {
+//   "e": "kline",     // Event type
+//   "E": 123456789,   // Event time
+//   "s": "BNBBTC",    // Symbol
+//   "k": {
+//     "t": 123400000, // Kline start time
+//     "T": 123460000, // Kline close time
+//     "s": "BNBBTC",  // Symbol
+//     "i": "1m",      // Interval
+//     "f": 100,       // First trade ID
+//     "L": 200,       // Last trade ID
+//     "o": "0.0010",  // Open price
+//     "c": "0.0020",  // Close price
+//     "h": "0.0025",  // High price
+//     "l": "0.0015",  // Low price
+//     "v": "1000",    // Base asset volume
+//     "n": 100,       // Number of trades
+//     "x": false,     // Is this kline closed?
+//     "q": "1.0000",  // Quote asset volume
+//     "V": "500",     // Taker buy base asset volume
+//     "Q": "0.500",   // Taker buy quote asset volume
+//     "B": "123456"   // Ignore
+//   }
+// }
+
+type klineEvent struct {
+	// Have to include Type even though not wanted as encoding/json Unmarshal() has a bug with case-sensitivity on named parameters
+	// Issue discussed here: https://github.com/golang/go/issues/14750
+	// Watching proposed change to package here: https://go-review.googlesource.com/c/go/+/224079/
+	Type string `json:"e"` // Will always be "kline"
+
+	EventTime int    `json:"E"`
+	Symbol    string `json:"s"`
+	Kline     Kline  `json:"k"`
+}
+
+// Kline contains the state of a candlestick bar. Updates are sent for the
+// current bar until it is closed. ReceivedAt and Raw are as for Trade.
+type Kline struct {
+	EventTime int `json:"-"`
+
+	Symbol              string        `json:"s"`
+	Interval            KlineInterval `json:"i"`
+	StartTime           int           `json:"t"`
+	CloseTime           int           `json:"T"`
+	FirstTradeID        int           `json:"f"`
+	LastTradeID         int           `json:"L"`
+	Open                Decimal       `json:"o"`
+	High                Decimal       `json:"h"`
+	Low                 Decimal       `json:"l"`
+	Close               Decimal       `json:"c"`
+	Volume              Decimal       `json:"v"`
+	QuoteVolume         Decimal       `json:"q"`
+	TradeCount          int           `json:"n"`
+	TakerBuyVolume      Decimal       `json:"V"`
+	TakerBuyQuoteVolume Decimal       `json:"Q"`
+	Closed              bool          `json:"x"`
+
+	ReceivedAt time.Time       `json:"-"`
+	Raw        json.RawMessage `json:"-"`
+}
+
+// EventTimestamp returns the update's event time
+func (k Kline) EventTimestamp() time.Time {
+	return msTime(k.EventTime)
+}
+
+// StartTimestamp returns the time the bar opens
+func (k Kline) StartTimestamp() time.Time {
+	return msTime(k.StartTime)
+}
+
+// CloseTimestamp returns the time the bar closes
+func (k Kline) CloseTimestamp() time.Time {
+	return msTime(k.CloseTime)
+}
+
+// Klines returns a read-only channel of updates to the market's kline of the given interval
+func (bf *binanceFeeder) Klines(interval KlineInterval) (<-chan Kline, error) {
+	if !interval.Valid() {
+		return nil, fmt.Errorf("unsupported kline interval: %s", interval)
+	}
+
+	stream := fmt.Sprintf("kline_%s", interval)
+	mChan, err := bf.listen(stream)
+
+	kChan := make(chan Kline)
+	bf.lc.goroutine(func() {
+		defer close(kChan)
+		bf.read(mChan, stream, "kline", func(message []byte, r receipt) (streamEvent, error) {
+			var e klineEvent
+			err := json.Unmarshal(message, &e)
+			e.Kline.EventTime = e.EventTime
+			e.Kline.ReceivedAt, e.Kline.Raw = r.at, r.raw
+			return streamEvent{event: e.Kline, seqNo: e.EventTime, eventTime: e.EventTime}, err
+		}, bf.sendKline(kChan))
+	})
+	return kChan, err
+}
+
+// sendKline returns a function sending klines on the channel until the feeder is closed
+func (bf *binanceFeeder) sendKline(kChan chan<- Kline) func(e interface{}) bool {
+	return func(e interface{}) bool {
+		select {
+		case kChan <- e.(Kline):
+			return true
+		case <-bf.lc.done():
+			return false
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const klinesURL = "/ws/test@kline_1m"
+
+var (
+	rawKline = `{
+		"e": "kline",
+		"E": 123456789,
+		"s": "BNBBTC",
+		"k": {
+			"t": 123400000,
+			"T": 123460000,
+			"s": "BNBBTC",
+			"i": "1m",
+			"f": 100,
+			"L": 200,
+			"o": "0.0010",
+			"c": "0.0020",
+			"h": "0.0025",
+			"l": "0.0015",
+			"v": "1000",
+			"n": 100,
+			"x": false,
+			"q": "1.0000",
+			"V": "500",
+			"Q": "0.500",
+			"B": "123456"
+		}
+	}`
+
+	expectedKline = Kline{
+		EventTime:           123456789,
+		Symbol:              "BNBBTC",
+		Interval:            Interval1m,
+		StartTime:           123400000,
+		CloseTime:           123460000,
+		FirstTradeID:        100,
+		LastTradeID:         200,
+		Open:                MustParseDecimal("0.001"),
+		High:                MustParseDecimal("0.0025"),
+		Low:                 MustParseDecimal("0.0015"),
+		Close:               MustParseDecimal("0.002"),
+		Volume:              MustParseDecimal("1000"),
+		QuoteVolume:         MustParseDecimal("1"),
+		TradeCount:          100,
+		TakerBuyVolume:      MustParseDecimal("500"),
+		TakerBuyQuoteVolume: MustParseDecimal("0.5"),
+		Closed:              false,
+	}
+)
+
+func TestBinanceFeederImplementsKlineFeederInterface(t *testing.T) {
+	assert.Implements(t, (*KlineFeeder)(nil), &binanceFeeder{}, "Does not implement interface")
+}
+
+func TestKlineIntervalValidAcceptsAllBinanceIntervals(t *testing.T) {
+	for _, i := range []string{"1s", "1m", "3m", "5m", "15m", "30m", "1h", "2h", "4h", "6h", "8h", "12h", "1d", "3d", "1w", "1M"} {
+		assert.True(t, KlineInterval(i).Valid(), i)
+	}
+	assert.False(t, KlineInterval("2m").Valid())
+	assert.False(t, KlineInterval("1mo").Valid())
+}
+
+func TestBinanceFeederKlinesReturnsWorkingChannelThatReceivesKlines(t *testing.T) {
+	//arrange
+	mc := make(chan string, 2)
+	defer close(mc)
+
+	ws := newTestServer(klinesURL, mc)
+	defer ws.Close()
+
+	mc <- rawKline
+
+	bf := newTestBinanceFeeder(ws, 0)
+
+	//act
+	kc, err := bf.Klines(Interval1m)
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedKline, eventWithoutReceipt(<-kc))
+}
+
+func TestBinanceFeederKlinesReturnsErrorForUnsupportedInterval(t *testing.T) {
+	bf := NewBinanceFeeder("BTCBNB")
+
+	_, err := bf.Klines("2m")
+
+	assert.Error(t, err)
+}
+
+func TestBinanceFeederKlinesSkipsAndLogsOnUnmarshalError(t *testing.T) {
+	//arrange
+	logBuffer.Reset()
+
+	mc := make(chan string, 3)
+	defer close(mc)
+
+	ws := newTestServer(klinesURL, mc)
+	defer ws.Close()
+
+	mc <- `{"e": "kline", "E": 123456789, "k": {"o": "one"}}`
+	mc <- rawKline
+
+	bf := newTestBinanceFeeder(ws, 0)
+
+	//act
+	kc, err := bf.Klines(Interval1m)
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedKline, eventWithoutReceipt(<-kc))
+	assertContainsErrorLog(t, logBuffer.Contents(), "error unmarshalling kline")
+}
+
+func TestBinanceFeederKlinesKeepReceiptAndRawPayload(t *testing.T) {
+	//arrange
+	mc := make(chan string, 1)
+	defer close(mc)
+
+	ws := newTestServer(klinesURL, mc)
+	defer ws.Close()
+
+	mc <- rawKline
+
+	bf := newTestBinanceFeeder(ws, 0)
+	bf.rawPayloads = true
+	defer bf.Close()
+	before := time.Now()
+
+	//act
+	kc, err := bf.Klines(Interval1m)
+	k := <-kc
+
+	//assert
+	assert.NoError(t, err)
+	assert.False(t, k.ReceivedAt.Before(before))
+	assert.JSONEq(t, rawKline, string(k.Raw))
+	assert.Equal(t, msTime(expectedKline.EventTime), k.EventTimestamp())
+	assert.Equal(t, msTime(expectedKline.StartTime), k.StartTimestamp())
+	assert.Equal(t, msTime(expectedKline.CloseTime), k.CloseTimestamp())
+}
@@ -0,0 +1,62 @@
+package exchange
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// lifecycle tracks the goroutines started by a feeder so that they can be
+// torn down together. The zero value is ready to use.
+type lifecycle struct {
+	init   sync.Once
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func (lc *lifecycle) context() context.Context {
+	lc.init.Do(func() {
+		lc.ctx, lc.cancel = context.WithCancel(context.Background())
+	})
+	return lc.ctx
+}
+
+// done returns a channel that is closed when the lifecycle is closed
+func (lc *lifecycle) done() <-chan struct{} {
+	return lc.context().Done()
+}
+
+// closed reports whether the lifecycle has been closed
+func (lc *lifecycle) closed() bool {
+	return lc.context().Err() != nil
+}
+
+// goroutine runs f in a goroutine that close waits for
+func (lc *lifecycle) goroutine(f func()) {
+	lc.wg.Add(1)
+	go func() {
+		defer lc.wg.Done()
+		f()
+	}()
+}
+
+// sleep pauses for the duration, returning false if the lifecycle was closed in the meantime
+func (lc *lifecycle) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-lc.done():
+		return false
+	}
+}
+
+// close cancels the lifecycle's context and waits for its goroutines to return
+func (lc *lifecycle) close() {
+	lc.context()
+	lc.cancel()
+	lc.wg.Wait()
+}
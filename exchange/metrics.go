@@ -0,0 +1,380 @@
+package exchange
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The metrics of a feed's other streams are named after the stream without its
+// symbol, such as "aggTrade", "kline_1m" or "depth5@100ms".
+const (
+	// TradeStreamMetrics names the metrics of a feed's trade stream
+	TradeStreamMetrics = "trade"
+	// DepthStreamMetrics names the metrics of a feed's book update stream
+	DepthStreamMetrics = "depth"
+
+	// rateWindow is how many seconds message rates are measured over
+	rateWindow = 60
+)
+
+// latencyBuckets are the upper bounds of the latency histogram's buckets
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// FeedMetrics measures how stale and how busy a feed's streams are. Latency is
+// measured from the exchange's event time to when the event is received, so
+// includes any difference between the exchange's and the local clock unless
+// measured against a clock of the exchange's time.
+// Methods of a nil FeedMetrics do nothing.
+type FeedMetrics struct {
+	symbol string
+	now    func() time.Time
+	start  time.Time
+
+	mu         sync.Mutex
+	reconnects uint64
+	streams    map[string]*streamMetrics
+}
+
+type streamMetrics struct {
+	messages     uint64
+	decodeErrors uint64
+	latency      latencyHistogram
+	rate         rateCounter
+	backlog      func() int
+}
+
+// NewFeedMetrics returns metrics of the symbol's feed
+func NewFeedMetrics(symbol string) *FeedMetrics {
+	return &FeedMetrics{
+		symbol:  symbol,
+		now:     time.Now,
+		start:   time.Now(),
+		streams: make(map[string]*streamMetrics),
+	}
+}
+
+// MetricsSnapshot is the state of a feed's metrics at a point in time
+type MetricsSnapshot struct {
+	Symbol     string
+	Reconnects uint64
+	Streams    map[string]StreamSnapshot
+}
+
+// StreamSnapshot is the state of a stream's metrics at a point in time.
+// Messages excludes duplicates received while reconnecting. MessageRate is the number of messages per second over the last minute.
+// Backlog is the number of events waiting for the consumer to receive them.
+type StreamSnapshot struct {
+	Messages     uint64
+	DecodeErrors uint64
+	MessageRate  float64
+	Backlog      int
+	Latency      LatencySnapshot
+}
+
+// LatencySnapshot summarises the latencies measured of a stream's events.
+// Buckets hold the cumulative count of latencies up to each bound.
+type LatencySnapshot struct {
+	Count   uint64
+	Sum     time.Duration
+	Mean    time.Duration
+	Max     time.Duration
+	Last    time.Duration
+	Buckets []LatencyBucket
+}
+
+type LatencyBucket struct {
+	UpperBound time.Duration
+	Count      uint64
+}
+
+// SetClock measures latency against the clock, such as a ClockSync of the
+// exchange's time, so that it excludes the difference between the exchange's and
+// the local clock. It must be set before any of the feed's streams are requested.
+func (m *FeedMetrics) SetClock(clock Clock) {
+	if m == nil {
+		return
+	}
+	m.now = clock.Now
+	m.start = clock.Now()
+}
+
+// Snapshot returns the current state of the metrics
+func (m *FeedMetrics) Snapshot() MetricsSnapshot {
+	if m == nil {
+		return MetricsSnapshot{}
+	}
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := MetricsSnapshot{
+		Symbol:     m.symbol,
+		Reconnects: m.reconnects,
+		Streams:    make(map[string]StreamSnapshot, len(m.streams)),
+	}
+	for name, s := range m.streams {
+		ss := StreamSnapshot{
+			Messages:     s.messages,
+			DecodeErrors: s.decodeErrors,
+			MessageRate:  s.rate.rate(now, m.start),
+			Latency:      s.latency.snapshot(),
+		}
+		if s.backlog != nil {
+			ss.Backlog = s.backlog()
+		}
+		snapshot.Streams[name] = ss
+	}
+	return snapshot
+}
+
+func (m *FeedMetrics) stream(name string) *streamMetrics {
+	s, ok := m.streams[name]
+	if !ok {
+		s = &streamMetrics{}
+		s.latency.buckets = make([]uint64, len(latencyBuckets))
+		m.streams[name] = s
+	}
+	return s
+}
+
+// message counts a message received on the stream
+func (m *FeedMetrics) message(stream string) {
+	if m == nil {
+		return
+	}
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stream(stream)
+	s.messages++
+	s.rate.add(now)
+}
+
+// decodeError counts a message of the stream that couldn't be decoded
+func (m *FeedMetrics) decodeError(stream string) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stream(stream).decodeErrors++
+}
+
+// received measures the latency of an event of the stream, given its event time
+// in Unix milliseconds
+func (m *FeedMetrics) received(stream string, eventTime int) {
+	if m == nil {
+		return
+	}
+	latency := m.now().Sub(time.Unix(0, int64(eventTime)*int64(time.Millisecond)))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stream(stream).latency.observe(latency)
+}
+
+// reconnected counts a reconnection of one of the feed's streams
+func (m *FeedMetrics) reconnected() {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reconnects++
+}
+
+// setBacklog sets how the number of events waiting to be received on the stream is found
+func (m *FeedMetrics) setBacklog(stream string, backlog func() int) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stream(stream).backlog = backlog
+}
+
+// latencyHistogram counts latencies into the latencyBuckets
+type latencyHistogram struct {
+	buckets []uint64 // not cumulative
+	count   uint64
+	sum     time.Duration
+	max     time.Duration
+	last    time.Duration
+}
+
+func (h *latencyHistogram) observe(latency time.Duration) {
+	for i, bound := range latencyBuckets {
+		if latency <= bound {
+			h.buckets[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += latency
+	h.last = latency
+	if latency > h.max {
+		h.max = latency
+	}
+}
+
+func (h *latencyHistogram) snapshot() LatencySnapshot {
+	s := LatencySnapshot{
+		Count:   h.count,
+		Sum:     h.sum,
+		Max:     h.max,
+		Last:    h.last,
+		Buckets: make([]LatencyBucket, len(latencyBuckets)),
+	}
+	if h.count > 0 {
+		s.Mean = h.sum / time.Duration(h.count)
+	}
+
+	var cumulative uint64
+	for i, bound := range latencyBuckets {
+		cumulative += h.buckets[i]
+		s.Buckets[i] = LatencyBucket{UpperBound: bound, Count: cumulative}
+	}
+	return s
+}
+
+// rateCounter counts events in each second of the last rateWindow seconds
+type rateCounter struct {
+	counts [rateWindow]uint64
+	latest int64 // the Unix second last counted in
+}
+
+func (rc *rateCounter) add(now time.Time) {
+	rc.advance(now.Unix())
+	rc.counts[now.Unix()%rateWindow]++
+}
+
+// advance clears the counts of seconds that have passed since the latest was counted
+func (rc *rateCounter) advance(second int64) {
+	if second <= rc.latest {
+		return
+	}
+	if second-rc.latest >= rateWindow {
+		rc.counts = [rateWindow]uint64{}
+	} else {
+		for s := rc.latest + 1; s <= second; s++ {
+			rc.counts[s%rateWindow] = 0
+		}
+	}
+	rc.latest = second
+}
+
+// rate returns the events per second over the window, or since start if sooner
+func (rc *rateCounter) rate(now time.Time, start time.Time) float64 {
+	rc.advance(now.Unix())
+
+	var total uint64
+	for _, c := range rc.counts {
+		total += c
+	}
+
+	window := now.Unix() - start.Unix() + 1
+	if window > rateWindow {
+		window = rateWindow
+	}
+	return float64(total) / float64(window)
+}
+
+// MetricsHandler returns an HTTP handler exposing the metrics of the feeds in
+// the Prometheus text format
+func MetricsHandler(metrics ...*FeedMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		snapshots := make([]MetricsSnapshot, 0, len(metrics))
+		for _, m := range metrics {
+			if m != nil {
+				snapshots = append(snapshots, m.Snapshot())
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w, snapshots...)
+	})
+}
+
+// WritePrometheus writes the snapshots in the Prometheus text format
+func WritePrometheus(w io.Writer, snapshots ...MetricsSnapshot) {
+	family := func(name string, kind string, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	streams := func(f func(symbol string, stream string, s StreamSnapshot)) {
+		for _, snapshot := range snapshots {
+			names := make([]string, 0, len(snapshot.Streams))
+			for name := range snapshot.Streams {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				f(snapshot.Symbol, name, snapshot.Streams[name])
+			}
+		}
+	}
+
+	family("binance_feed_messages_total", "counter", "Messages received on the stream.")
+	streams(func(symbol string, stream string, s StreamSnapshot) {
+		fmt.Fprintf(w, "binance_feed_messages_total{symbol=%q,stream=%q} %d\n", symbol, stream, s.Messages)
+	})
+
+	family("binance_feed_decode_errors_total", "counter", "Messages received on the stream that couldn't be decoded.")
+	streams(func(symbol string, stream string, s StreamSnapshot) {
+		fmt.Fprintf(w, "binance_feed_decode_errors_total{symbol=%q,stream=%q} %d\n", symbol, stream, s.DecodeErrors)
+	})
+
+	family("binance_feed_message_rate", "gauge", "Messages received per second on the stream over the last minute.")
+	streams(func(symbol string, stream string, s StreamSnapshot) {
+		fmt.Fprintf(w, "binance_feed_message_rate{symbol=%q,stream=%q} %s\n", symbol, stream, formatFloat(s.MessageRate))
+	})
+
+	family("binance_feed_backlog", "gauge", "Events waiting to be received from the stream's channel.")
+	streams(func(symbol string, stream string, s StreamSnapshot) {
+		fmt.Fprintf(w, "binance_feed_backlog{symbol=%q,stream=%q} %d\n", symbol, stream, s.Backlog)
+	})
+
+	family("binance_feed_latency_seconds", "histogram", "Time from the exchange's event time to the event being received.")
+	streams(func(symbol string, stream string, s StreamSnapshot) {
+		for _, b := range s.Latency.Buckets {
+			fmt.Fprintf(w, "binance_feed_latency_seconds_bucket{symbol=%q,stream=%q,le=%q} %d\n",
+				symbol, stream, formatFloat(b.UpperBound.Seconds()), b.Count)
+		}
+		fmt.Fprintf(w, "binance_feed_latency_seconds_bucket{symbol=%q,stream=%q,le=\"+Inf\"} %d\n", symbol, stream, s.Latency.Count)
+		fmt.Fprintf(w, "binance_feed_latency_seconds_sum{symbol=%q,stream=%q} %s\n", symbol, stream, formatFloat(s.Latency.Sum.Seconds()))
+		fmt.Fprintf(w, "binance_feed_latency_seconds_count{symbol=%q,stream=%q} %d\n", symbol, stream, s.Latency.Count)
+	})
+
+	family("binance_feed_reconnects_total", "counter", "Reconnections of the feed's streams.")
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(w, "binance_feed_reconnects_total{symbol=%q} %d\n", snapshot.Symbol, snapshot.Reconnects)
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,183 @@
+package exchange
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFeedMetrics(now *time.Time) *FeedMetrics {
+	m := NewFeedMetrics(testSymbol)
+	m.start = *now
+	m.now = func() time.Time { return *now }
+	return m
+}
+
+func TestFeedMetricsSnapshotMeasuresLatency(t *testing.T) {
+	//arrange
+	now := time.Unix(1000, 0)
+	m := newTestFeedMetrics(&now)
+
+	//act
+	m.message(TradeStreamMetrics)
+	m.received(TradeStreamMetrics, 999990) // 10ms ago
+	m.message(TradeStreamMetrics)
+	m.received(TradeStreamMetrics, 999700) // 300ms ago
+	m.message(TradeStreamMetrics)
+	m.decodeError(TradeStreamMetrics)
+	m.reconnected()
+
+	//assert
+	s := m.Snapshot()
+	assert.Equal(t, testSymbol, s.Symbol)
+	assert.Equal(t, uint64(1), s.Reconnects)
+
+	trades := s.Streams[TradeStreamMetrics]
+	assert.Equal(t, uint64(3), trades.Messages)
+	assert.Equal(t, uint64(1), trades.DecodeErrors)
+	assert.Equal(t, uint64(2), trades.Latency.Count)
+	assert.Equal(t, 310*time.Millisecond, trades.Latency.Sum)
+	assert.Equal(t, 155*time.Millisecond, trades.Latency.Mean)
+	assert.Equal(t, 300*time.Millisecond, trades.Latency.Max)
+	assert.Equal(t, 300*time.Millisecond, trades.Latency.Last)
+	assert.Equal(t, LatencyBucket{UpperBound: 5 * time.Millisecond, Count: 0}, trades.Latency.Buckets[2])
+	assert.Equal(t, LatencyBucket{UpperBound: 10 * time.Millisecond, Count: 1}, trades.Latency.Buckets[3])
+	assert.Equal(t, LatencyBucket{UpperBound: 500 * time.Millisecond, Count: 2}, trades.Latency.Buckets[8])
+}
+
+func TestFeedMetricsMessageRateIsOverTheLastMinute(t *testing.T) {
+	now := time.Unix(1000, 0)
+	m := newTestFeedMetrics(&now)
+
+	for i := 0; i < 10; i++ {
+		m.message(DepthStreamMetrics)
+	}
+	now = now.Add(time.Second)
+	assert.Equal(t, 5.0, m.Snapshot().Streams[DepthStreamMetrics].MessageRate)
+
+	now = now.Add(58 * time.Second)
+	m.message(DepthStreamMetrics)
+	assert.InDelta(t, 11.0/60, m.Snapshot().Streams[DepthStreamMetrics].MessageRate, 1e-9)
+
+	now = now.Add(time.Second)
+	assert.InDelta(t, 1.0/60, m.Snapshot().Streams[DepthStreamMetrics].MessageRate, 1e-9)
+
+	now = now.Add(time.Hour)
+	assert.Equal(t, 0.0, m.Snapshot().Streams[DepthStreamMetrics].MessageRate)
+}
+
+func TestFeedMetricsNilIsNoOp(t *testing.T) {
+	var m *FeedMetrics
+
+	m.message(TradeStreamMetrics)
+	m.received(TradeStreamMetrics, 0)
+	m.reconnected()
+
+	assert.Equal(t, MetricsSnapshot{}, m.Snapshot())
+}
+
+func TestMetricsHandlerWritesPrometheusTextFormat(t *testing.T) {
+	//arrange
+	now := time.Unix(1000, 0)
+	m := newTestFeedMetrics(&now)
+	m.message(TradeStreamMetrics)
+	m.received(TradeStreamMetrics, 999990)
+	m.setBacklog(TradeStreamMetrics, func() int { return 7 })
+	m.decodeError(DepthStreamMetrics)
+	rec := httptest.NewRecorder()
+
+	//act
+	MetricsHandler(m, nil).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	//assert
+	body := rec.Body.String()
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	for _, line := range []string{
+		"# TYPE binance_feed_messages_total counter",
+		`binance_feed_messages_total{symbol="test",stream="trade"} 1`,
+		`binance_feed_decode_errors_total{symbol="test",stream="depth"} 1`,
+		`binance_feed_message_rate{symbol="test",stream="trade"} 1`,
+		`binance_feed_backlog{symbol="test",stream="trade"} 7`,
+		"# TYPE binance_feed_latency_seconds histogram",
+		`binance_feed_latency_seconds_bucket{symbol="test",stream="trade",le="0.005"} 0`,
+		`binance_feed_latency_seconds_bucket{symbol="test",stream="trade",le="0.01"} 1`,
+		`binance_feed_latency_seconds_bucket{symbol="test",stream="trade",le="+Inf"} 1`,
+		`binance_feed_latency_seconds_sum{symbol="test",stream="trade"} 0.01`,
+		`binance_feed_latency_seconds_count{symbol="test",stream="trade"} 1`,
+		`binance_feed_reconnects_total{symbol="test"} 0`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+	// depth stream's lines come before the trade stream's, each family written once
+	assert.True(t, strings.Index(body, `stream="depth"`) < strings.Index(body, `stream="trade"`))
+	assert.Equal(t, 1, strings.Count(body, "# TYPE binance_feed_backlog gauge"))
+}
+
+func TestBinanceFeederMeasuresStreams(t *testing.T) {
+	//arrange
+	mc := make(chan string, 2)
+	ws := newTestServer(tradesURL, mc)
+	defer ws.Close()
+	mc <- rawTrade
+	mc <- "not a trade"
+	close(mc)
+
+	testDialer := websocket.DefaultDialer
+	testDialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	bf := NewBinanceFeeder(testSymbol)
+	bf.baseURL = strings.TrimPrefix(ws.URL, "wss://")
+	bf.socketOptions = &SocketConnectionOptions{
+		Dialer:          testDialer,
+		ReconnectPolicy: &FixedBackOff{Interval: 10 * time.Millisecond, MaxRetries: 1},
+	}
+	defer bf.Close()
+
+	//act
+	tc, err := bf.Trades()
+	assert.NoError(t, err)
+	<-tc
+
+	//assert the stream reconnects once after the server closes the connection
+	assert.Eventually(t, func() bool {
+		return bf.Metrics().Snapshot().Reconnects == 1
+	}, time.Second, 10*time.Millisecond)
+
+	trades := bf.Metrics().Snapshot().Streams[TradeStreamMetrics]
+	assert.Equal(t, uint64(2), trades.Messages)
+	assert.Equal(t, uint64(1), trades.DecodeErrors)
+	assert.Equal(t, uint64(1), trades.Latency.Count)
+	assert.Equal(t, 0, trades.Backlog)
+}
+
+func TestBinanceFeederMeasuresEveryStreamAfterDroppingDuplicates(t *testing.T) {
+	//arrange
+	mc := make(chan string, 3)
+	defer close(mc)
+
+	ws := newTestServer(klinesURL, mc)
+	defer ws.Close()
+
+	mc <- rawKline
+	mc <- rawKline // received twice, as while connections overlap during a rollover
+	mc <- strings.Replace(rawKline, `"E": 123456789`, `"E": 123456790`, 1)
+
+	bf := newTestBinanceFeeder(ws, 0)
+	bf.metrics = NewFeedMetrics(testSymbol)
+	defer bf.Close()
+
+	//act
+	kc, err := bf.Klines(Interval1m)
+	assert.NoError(t, err)
+	<-kc
+	<-kc
+
+	//assert
+	klines := bf.Metrics().Snapshot().Streams["kline_1m"]
+	assert.Equal(t, uint64(2), klines.Messages)
+	assert.Equal(t, uint64(2), klines.Latency.Count)
+}
@@ -0,0 +1,447 @@
+package exchange
+
+import (
+	"sort"
+	"time"
+)
+
+// Middleware wraps a Feeder, returning a Feeder of its events changed in some way
+type Middleware func(feed Feeder) Feeder
+
+// Chain wraps the feed in each middleware in turn, so that the first given sees
+// the feed's events first. Closing the returned Feeder closes the whole chain,
+// and each channel is closed once the feed's channel is.
+func Chain(feed Feeder, middleware ...Middleware) Feeder {
+	for _, m := range middleware {
+		feed = m(feed)
+	}
+	return feed
+}
+
+// FilterTrades only passes on trades for which keep returns true
+func FilterTrades(keep func(t Trade) bool) Middleware {
+	return mapTrades(func(t Trade) (Trade, bool) {
+		return t, keep(t)
+	})
+}
+
+// FilterBookUpdates only passes on book updates for which keep returns true
+func FilterBookUpdates(keep func(b BookUpdate) bool) Middleware {
+	return mapBookUpdates(func(b BookUpdate) (BookUpdate, bool) {
+		return b, keep(b)
+	})
+}
+
+// MapTrade passes on every trade changed by fn
+func MapTrade(fn func(t Trade) Trade) Middleware {
+	return mapTrades(func(t Trade) (Trade, bool) {
+		return fn(t), true
+	})
+}
+
+// mapTrades passes on trades changed by fn, dropping those it returns false for
+func mapTrades(fn func(t Trade) (Trade, bool)) Middleware {
+	return func(feed Feeder) Feeder {
+		return &middlewareFeeder{
+			Feeder: feed,
+			trades: func(in <-chan Trade, out chan<- Trade, done <-chan struct{}) {
+				for {
+					select {
+					case t, ok := <-in:
+						if !ok {
+							return
+						}
+						if t, ok = fn(t); !ok {
+							continue
+						}
+						select {
+						case out <- t:
+						case <-done:
+							return
+						}
+					case <-done:
+						return
+					}
+				}
+			},
+		}
+	}
+}
+
+// mapBookUpdates passes on book updates changed by fn, dropping those it returns false for
+func mapBookUpdates(fn func(b BookUpdate) (BookUpdate, bool)) Middleware {
+	return func(feed Feeder) Feeder {
+		return &middlewareFeeder{
+			Feeder: feed,
+			bookUpdates: func(in <-chan BookUpdate, out chan<- BookUpdate, done <-chan struct{}) {
+				for {
+					select {
+					case b, ok := <-in:
+						if !ok {
+							return
+						}
+						if b, ok = fn(b); !ok {
+							continue
+						}
+						select {
+						case out <- b:
+						case <-done:
+							return
+						}
+					case <-done:
+						return
+					}
+				}
+			},
+		}
+	}
+}
+
+// MapBookUpdate passes on every book update changed by fn
+func MapBookUpdate(fn func(b BookUpdate) BookUpdate) Middleware {
+	return mapBookUpdates(func(b BookUpdate) (BookUpdate, bool) {
+		return fn(b), true
+	})
+}
+
+// PriceBand drops the levels of book updates more than pct percent away from the
+// middle of the best bid and ask seen so far, so that a book built from the updates
+// holds only the levels within the band. As the band moves, levels passed on that
+// leave it are removed with a zero quantity, and levels that enter it are added
+// with their latest quantity. Removals of levels are always passed on, and updates
+// are passed on even if every level is dropped, so that update IDs still follow
+// on from each other. Every level is passed on while the middle price is zero.
+func PriceBand(pct float64) Middleware {
+	return func(feed Feeder) Feeder {
+		pb := &priceBand{
+			pct:        NewDecimalFromFloat(pct),
+			bids:       make(map[Decimal]Decimal),
+			asks:       make(map[Decimal]Decimal),
+			passedBids: make(map[Decimal]bool),
+			passedAsks: make(map[Decimal]bool),
+		}
+		return MapBookUpdate(pb.filter)(feed)
+	}
+}
+
+// priceBand is the state of a PriceBand: every level of the feed's book, and
+// those of them that have been passed on
+type priceBand struct {
+	pct        Decimal
+	bids       map[Decimal]Decimal
+	asks       map[Decimal]Decimal
+	passedBids map[Decimal]bool
+	passedAsks map[Decimal]bool
+}
+
+func (pb *priceBand) filter(b BookUpdate) BookUpdate {
+	setLevels(pb.bids, b.Bids)
+	setLevels(pb.asks, b.Asks)
+
+	// twice the middle price, so that it is exact
+	var twiceMid Decimal
+	bestBid, hasBid := bestPrice(pb.bids, Decimal.GreaterThan)
+	bestAsk, hasAsk := bestPrice(pb.asks, Decimal.LessThan)
+	switch {
+	case hasBid && hasAsk:
+		twiceMid = bestBid.Add(bestAsk)
+	case hasBid:
+		twiceMid = bestBid.Add(bestBid)
+	case hasAsk:
+		twiceMid = bestAsk.Add(bestAsk)
+	}
+
+	inBand := func(price Decimal) bool {
+		if twiceMid.Sign() <= 0 {
+			return true
+		}
+		// |price - mid| / mid * 100 <= pct
+		return !price.Add(price).Sub(twiceMid).Abs().Mul(NewDecimalFromInt(100)).GreaterThan(twiceMid.Mul(pb.pct))
+	}
+
+	b.Bids = pb.band(b.Bids, pb.bids, pb.passedBids, inBand, Decimal.GreaterThan)
+	b.Asks = pb.band(b.Asks, pb.asks, pb.passedAsks, inBand, Decimal.LessThan)
+	return b
+}
+
+// band returns the entries of one side of an update that are within the band,
+// followed by the changes to the levels passed on as the band has moved
+func (pb *priceBand) band(entries []BookEntry, levels map[Decimal]Decimal, passed map[Decimal]bool, inBand func(Decimal) bool, better func(a, b Decimal) bool) []BookEntry {
+	kept := entries[:0:0]
+	updated := make(map[Decimal]bool, len(entries))
+	for _, e := range entries {
+		updated[e.Price] = true
+		switch {
+		case e.Quantity.IsZero():
+			kept = append(kept, e)
+			delete(passed, e.Price)
+		case inBand(e.Price):
+			kept = append(kept, e)
+			passed[e.Price] = true
+		case passed[e.Price]:
+			kept = append(kept, BookEntry{Price: e.Price})
+			delete(passed, e.Price)
+		}
+	}
+
+	var moved []BookEntry
+	for p := range passed {
+		if !updated[p] && !inBand(p) {
+			moved = append(moved, BookEntry{Price: p})
+			delete(passed, p)
+		}
+	}
+	for p, q := range levels {
+		if !updated[p] && !passed[p] && inBand(p) {
+			moved = append(moved, BookEntry{Price: p, Quantity: q})
+			passed[p] = true
+		}
+	}
+	sort.Slice(moved, func(i, j int) bool { return better(moved[i].Price, moved[j].Price) })
+	return append(kept, moved...)
+}
+
+func bestPrice(levels map[Decimal]Decimal, better func(a, b Decimal) bool) (Decimal, bool) {
+	var best Decimal
+	found := false
+	for p := range levels {
+		if !found || better(p, best) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
+
+// Throttle passes on at most one event of each stream per interval. Trades received
+// within the interval of the last one passed on are dropped. Book updates received
+// within the interval are merged, and the merged update passed on once it has passed
+// or the feed's channel closes.
+func Throttle(interval time.Duration) Middleware {
+	return func(feed Feeder) Feeder {
+		return &middlewareFeeder{
+			Feeder: feed,
+			trades: func(in <-chan Trade, out chan<- Trade, done <-chan struct{}) {
+				var last time.Time
+				for {
+					select {
+					case t, ok := <-in:
+						if !ok {
+							return
+						}
+						if now := time.Now(); now.Sub(last) >= interval {
+							last = now
+							select {
+							case out <- t:
+							case <-done:
+								return
+							}
+						}
+					case <-done:
+						return
+					}
+				}
+			},
+			bookUpdates: func(in <-chan BookUpdate, out chan<- BookUpdate, done <-chan struct{}) {
+				var last time.Time
+				var due <-chan time.Time
+				p := pendingUpdate{out: out, done: done}
+				for {
+					select {
+					case b, ok := <-in:
+						if !ok {
+							p.flush()
+							return
+						}
+						p.add(b)
+						if due != nil {
+							continue
+						}
+						if wait := interval - time.Since(last); wait > 0 {
+							due = time.After(wait)
+							continue
+						}
+						last = time.Now()
+						if !p.flush() {
+							return
+						}
+					case <-due:
+						due = nil
+						last = time.Now()
+						if !p.flush() {
+							return
+						}
+					case <-done:
+						return
+					}
+				}
+			},
+		}
+	}
+}
+
+// Sample passes on the latest event of each stream once every interval. Trades
+// are passed on if one was received during the interval, the others being dropped.
+// Book updates received during the interval are merged into one. Events waiting
+// when the feed's channel closes are passed on before closing.
+func Sample(interval time.Duration) Middleware {
+	return func(feed Feeder) Feeder {
+		return &middlewareFeeder{
+			Feeder: feed,
+			trades: func(in <-chan Trade, out chan<- Trade, done <-chan struct{}) {
+				ticker := time.NewTicker(interval)
+				defer ticker.Stop()
+
+				var latest Trade
+				pending := false
+				for {
+					select {
+					case t, ok := <-in:
+						if !ok {
+							if pending {
+								select {
+								case out <- latest:
+								case <-done:
+								}
+							}
+							return
+						}
+						latest, pending = t, true
+					case <-ticker.C:
+						if !pending {
+							continue
+						}
+						pending = false
+						select {
+						case out <- latest:
+						case <-done:
+							return
+						}
+					case <-done:
+						return
+					}
+				}
+			},
+			bookUpdates: func(in <-chan BookUpdate, out chan<- BookUpdate, done <-chan struct{}) {
+				ticker := time.NewTicker(interval)
+				defer ticker.Stop()
+
+				p := pendingUpdate{out: out, done: done}
+				for {
+					select {
+					case b, ok := <-in:
+						if !ok {
+							p.flush()
+							return
+						}
+						p.add(b)
+					case <-ticker.C:
+						if !p.flush() {
+							return
+						}
+					case <-done:
+						return
+					}
+				}
+			},
+		}
+	}
+}
+
+// pendingUpdate merges book updates waiting to be sent
+type pendingUpdate struct {
+	out  chan<- BookUpdate
+	done <-chan struct{}
+
+	update  BookUpdate
+	pending bool
+}
+
+func (p *pendingUpdate) add(b BookUpdate) {
+	if p.pending {
+		b = mergeBookUpdates(p.update, b).(BookUpdate)
+	}
+	p.update, p.pending = b, true
+}
+
+// flush sends the pending update if there is one, returning false if done
+func (p *pendingUpdate) flush() bool {
+	if !p.pending {
+		return true
+	}
+	p.pending = false
+
+	select {
+	case p.out <- p.update:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+// middlewareFeeder passes a feed's streams through functions that read events
+// from in and send them to out until in is closed or done is. A stream without
+// a function is passed on as it is.
+type middlewareFeeder struct {
+	Feeder
+
+	trades      func(in <-chan Trade, out chan<- Trade, done <-chan struct{})
+	bookUpdates func(in <-chan BookUpdate, out chan<- BookUpdate, done <-chan struct{})
+
+	lc lifecycle
+}
+
+func (mf *middlewareFeeder) Trades() (<-chan Trade, error) {
+	in, err := mf.Feeder.Trades()
+	if err != nil || mf.trades == nil {
+		return in, err
+	}
+
+	out := make(chan Trade)
+	mf.lc.goroutine(func() {
+		defer close(out)
+		mf.trades(in, out, mf.lc.done())
+	})
+	return out, nil
+}
+
+func (mf *middlewareFeeder) BookUpdates() (<-chan BookUpdate, error) {
+	in, err := mf.Feeder.BookUpdates()
+	if err != nil || mf.bookUpdates == nil {
+		return in, err
+	}
+
+	out := make(chan BookUpdate)
+	mf.lc.goroutine(func() {
+		defer close(out)
+		mf.bookUpdates(in, out, mf.lc.done())
+	})
+	return out, nil
+}
+
+// RESTURL returns the REST API host of the wrapped feed's exchange
+func (mf *middlewareFeeder) RESTURL() string {
+	return restURLOf(mf.Feeder)
+}
+
+func (mf *middlewareFeeder) depthSnapshotPath() string {
+	return depthSnapshotPathOf(mf.Feeder)
+}
+
+// DepthGaps returns the wrapped feed's channel of depth gaps, nil if it has none
+func (mf *middlewareFeeder) DepthGaps() <-chan DepthGap {
+	return depthGapsOf(mf.Feeder)
+}
+
+func (mf *middlewareFeeder) keepRawPayloads() bool {
+	return keepRawPayloadsOf(mf.Feeder)
+}
+
+func (mf *middlewareFeeder) streamNames() (string, string) {
+	return streamNamesOf(mf.Feeder)
+}
+
+// Close stops passing on events and closes the wrapped feed
+func (mf *middlewareFeeder) Close() error {
+	mf.lc.close()
+	return mf.Feeder.Close()
+}
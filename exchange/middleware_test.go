@@ -0,0 +1,233 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bookUpdateOf(first int, last int, bids []BookEntry, asks []BookEntry) BookUpdate {
+	return BookUpdate{FirstUpdateID: first, LastUpdateID: last, Bids: bids, Asks: asks}
+}
+
+func entry(price string, quantity string) BookEntry {
+	return BookEntry{Price: MustParseDecimal(price), Quantity: MustParseDecimal(quantity)}
+}
+
+func TestMiddlewareImplementsFeederInterface(t *testing.T) {
+	feed := Chain(newStubFeeder(testSymbol), FilterTrades(func(Trade) bool { return true }), Throttle(time.Second))
+
+	assert.Implements(t, (*Feeder)(nil), feed, "Does not implement interface")
+	assert.Equal(t, testSymbol, feed.GetSymbol())
+}
+
+func TestChainAppliesMiddlewareInOrderAndPropagatesClosure(t *testing.T) {
+	//arrange
+	stub := newStubFeeder(testSymbol)
+	feed := Chain(stub,
+		FilterTrades(func(t Trade) bool { return t.Quantity.GreaterThan(MustParseDecimal("1")) }),
+		MapTrade(func(t Trade) Trade {
+			t.Quantity = t.Quantity.Add(MustParseDecimal("10"))
+			return t
+		}),
+		// sees the quantities after the 10 added above
+		FilterTrades(func(t Trade) bool { return t.Quantity.LessThan(MustParseDecimal("15")) }),
+	)
+
+	//act
+	tc, err := feed.Trades()
+	stub.trades <- Trade{ID: 1, Quantity: MustParseDecimal("0.5")}
+	stub.trades <- Trade{ID: 2, Quantity: MustParseDecimal("2")}
+	stub.trades <- Trade{ID: 3, Quantity: MustParseDecimal("7")}
+	close(stub.trades)
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, Trade{ID: 2, Quantity: MustParseDecimal("12")}, <-tc)
+	_, ok := <-tc
+	assert.False(t, ok)
+}
+
+func TestMiddlewarePassesOnStreamsItDoesNotChange(t *testing.T) {
+	stub := newStubFeeder(testSymbol)
+	feed := FilterTrades(func(Trade) bool { return false })(stub)
+
+	buChan, err := feed.BookUpdates()
+	stub.bookUpdates <- expectedBookUpdate
+
+	assert.NoError(t, err)
+	assert.Equal(t, expectedBookUpdate, <-buChan)
+}
+
+func TestMiddlewareCloseClosesChannelsAndFeed(t *testing.T) {
+	//arrange
+	stub := &closeTrackingFeeder{stubFeeder: newStubFeeder(testSymbol)}
+	feed := Chain(stub, MapBookUpdate(func(b BookUpdate) BookUpdate { return b }), Sample(time.Hour))
+	tc, _ := feed.Trades()
+	buChan, _ := feed.BookUpdates()
+
+	//act
+	err := feed.Close()
+
+	//assert
+	assert.NoError(t, err)
+	assert.True(t, stub.closed)
+	_, ok := <-tc
+	assert.False(t, ok)
+	_, ok = <-buChan
+	assert.False(t, ok)
+}
+
+func TestFilterBookUpdatesDropsUpdates(t *testing.T) {
+	stub := newStubFeeder(testSymbol)
+	feed := FilterBookUpdates(func(b BookUpdate) bool { return len(b.Asks) > 0 })(stub)
+
+	buChan, _ := feed.BookUpdates()
+	stub.bookUpdates <- bookUpdateOf(1, 1, []BookEntry{entry("1", "1")}, nil)
+	stub.bookUpdates <- bookUpdateOf(2, 2, nil, []BookEntry{entry("2", "1")})
+
+	assert.Equal(t, 2, (<-buChan).FirstUpdateID)
+}
+
+func TestPriceBandDropsLevelsFarFromTheTouch(t *testing.T) {
+	//arrange
+	stub := newStubFeeder(testSymbol)
+	feed := PriceBand(5)(stub)
+	buChan, _ := feed.BookUpdates()
+
+	//act
+	stub.bookUpdates <- bookUpdateOf(1, 6,
+		[]BookEntry{entry("99", "1"), entry("96", "1"), entry("90", "1")},
+		[]BookEntry{entry("101", "1"), entry("104", "1"), entry("110", "1")},
+	)
+	// the far bid is removed, and the touch moves up
+	stub.bookUpdates <- bookUpdateOf(7, 9,
+		[]BookEntry{entry("90", "0"), entry("103", "2")},
+		[]BookEntry{entry("101", "0")},
+	)
+	stub.bookUpdates <- bookUpdateOf(10, 10, []BookEntry{entry("96", "5")}, nil)
+
+	//assert
+	assert.Equal(t, bookUpdateOf(1, 6,
+		[]BookEntry{entry("99", "1"), entry("96", "1")},
+		[]BookEntry{entry("101", "1"), entry("104", "1")},
+	), <-buChan)
+	// with the middle at 103.5, the bid at 96 leaves the band
+	assert.Equal(t, bookUpdateOf(7, 9,
+		[]BookEntry{entry("90", "0"), entry("103", "2"), entry("96", "0")},
+		[]BookEntry{entry("101", "0")},
+	), <-buChan)
+	assert.Equal(t, bookUpdateOf(10, 10, []BookEntry{}, nil), <-buChan)
+}
+
+func TestPriceBandKeepsDownstreamBookWithinTheBand(t *testing.T) {
+	//arrange
+	stub := newStubFeeder(testSymbol)
+	feed := PriceBand(10)(stub)
+	buChan, _ := feed.BookUpdates()
+
+	book := map[Decimal]Decimal{}
+	apply := func(b BookUpdate) {
+		for _, e := range append(b.Bids, b.Asks...) {
+			if e.Quantity.IsZero() {
+				delete(book, e.Price)
+			} else {
+				book[e.Price] = e.Quantity
+			}
+		}
+	}
+
+	//act
+	stub.bookUpdates <- bookUpdateOf(1, 1,
+		[]BookEntry{entry("99", "1"), entry("95", "1"), entry("80", "1")},
+		[]BookEntry{entry("101", "1"), entry("115", "1")},
+	)
+	apply(<-buChan)
+	before := len(book)
+
+	// the market falls, the touch moving to 80/85
+	stub.bookUpdates <- bookUpdateOf(2, 2,
+		[]BookEntry{entry("99", "0"), entry("95", "0")},
+		[]BookEntry{entry("85", "2")},
+	)
+	apply(<-buChan)
+
+	//assert
+	assert.Equal(t, 3, before)
+	assert.Equal(t, map[Decimal]Decimal{
+		MustParseDecimal("80"): MustParseDecimal("1"),
+		MustParseDecimal("85"): MustParseDecimal("2"),
+	}, book, "101 left the band, and 80 entered it")
+}
+
+func TestPriceBandPassesEveryLevelWhileMiddleIsZero(t *testing.T) {
+	//arrange
+	stub := newStubFeeder(testSymbol)
+	feed := PriceBand(5)(stub)
+	buChan, _ := feed.BookUpdates()
+
+	//act
+	stub.bookUpdates <- bookUpdateOf(1, 1, []BookEntry{entry("0", "1")}, nil)
+	stub.bookUpdates <- bookUpdateOf(2, 2, nil, []BookEntry{entry("0", "2")})
+
+	//assert
+	assert.Equal(t, bookUpdateOf(1, 1, []BookEntry{entry("0", "1")}, nil), <-buChan)
+	assert.Equal(t, bookUpdateOf(2, 2, nil, []BookEntry{entry("0", "2")}), <-buChan)
+}
+
+func TestThrottleLimitsTradesAndMergesBookUpdates(t *testing.T) {
+	//arrange
+	stub := newStubFeeder(testSymbol)
+	feed := Throttle(100 * time.Millisecond)(stub)
+	tc, _ := feed.Trades()
+	buChan, _ := feed.BookUpdates()
+
+	//act
+	for i := 1; i <= 3; i++ {
+		stub.trades <- Trade{ID: i}
+		stub.bookUpdates <- bookUpdateOf(i, i, []BookEntry{entry("1", fmtInt(i))}, nil)
+	}
+
+	//assert
+	start := time.Now()
+	assert.Equal(t, 1, (<-tc).ID)
+	assert.Equal(t, bookUpdateOf(1, 1, []BookEntry{entry("1", "1")}, nil), <-buChan)
+	assert.Equal(t, bookUpdateOf(2, 3, []BookEntry{entry("1", "3")}, nil), <-buChan)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	stub.trades <- Trade{ID: 4}
+	close(stub.trades)
+	assert.Equal(t, 4, (<-tc).ID)
+	_, ok := <-tc
+	assert.False(t, ok)
+}
+
+func TestSampleSendsLatestEventEachInterval(t *testing.T) {
+	//arrange
+	stub := newStubFeeder(testSymbol)
+	feed := Sample(50 * time.Millisecond)(stub)
+	tc, _ := feed.Trades()
+	buChan, _ := feed.BookUpdates()
+
+	//act
+	for i := 1; i <= 3; i++ {
+		stub.trades <- Trade{ID: i}
+		stub.bookUpdates <- bookUpdateOf(i, i, nil, []BookEntry{entry(fmtInt(i), "1")})
+	}
+
+	//assert
+	assert.Equal(t, 3, (<-tc).ID)
+	assert.Equal(t, bookUpdateOf(1, 3, nil, []BookEntry{entry("1", "1"), entry("2", "1"), entry("3", "1")}), <-buChan)
+
+	// waiting events are sent when the feed's channels close
+	stub.bookUpdates <- bookUpdateOf(4, 4, nil, nil)
+	close(stub.bookUpdates)
+	assert.Equal(t, 4, (<-buChan).FirstUpdateID)
+	_, ok := <-buChan
+	assert.False(t, ok)
+}
+
+func fmtInt(i int) string {
+	return NewDecimalFromInt(int64(i)).String()
+}
@@ -0,0 +1,374 @@
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Taken from https://binance-docs.github.io/apidocs/spot/en/#websocket-market-streams
+// {
+//   "stream": "bnbbtc@trade", // Stream name
+//   "data": { ... }           // Raw stream payload
+// }
+
+// combinedEvent wraps every payload received on a combined stream
+type combinedEvent struct {
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// binanceMultiFeeder multiplexes the trade and depth streams of many symbols
+// over a single combined stream connection
+type binanceMultiFeeder struct {
+	baseURL       string
+	restURL       string
+	socketOptions *SocketConnectionOptions
+	rawPayloads   bool
+	clock         Clock
+	symbols       []string
+
+	connect sync.Once
+	connErr error
+	lc      lifecycle
+
+	trades          map[string]chan Trade
+	bookUpdates     map[string]chan BookUpdate
+	tradePipes      map[string]*eventPipe
+	bookUpdatePipes map[string]*eventPipe
+
+	mu         sync.Mutex
+	subscribed map[string]bool // keyed by stream name
+	sequences  map[string]*sequencer
+	gapChecks  map[string]*gapDetector
+	gaps       map[string]*gapChannel
+	metrics    map[string]*FeedMetrics
+}
+
+// NewBinanceMultiFeeder returns a feeder for many symbols sharing one websocket
+// connection. Feeds for an individual symbol are obtained with Feeder.
+func NewBinanceMultiFeeder(symbols ...string) *binanceMultiFeeder {
+	return NewBinanceMultiFeederWithOptions(symbols)
+}
+
+// NewBinanceMultiFeederWithOptions returns a feeder for many symbols sharing one
+// websocket connection, connecting to Production unless configured otherwise
+// by the options. Each symbol's streams are buffered separately by the buffer
+// options, so that a slow consumer of one symbol doesn't hold up the others.
+func NewBinanceMultiFeederWithOptions(symbols []string, opts ...Option) *binanceMultiFeeder {
+	c := newFeederConfig(opts)
+	mf := &binanceMultiFeeder{
+		baseURL:         c.baseURL,
+		restURL:         c.restURL,
+		socketOptions:   c.socketOptions,
+		rawPayloads:     c.rawPayloads,
+		clock:           c.clock,
+		trades:          make(map[string]chan Trade),
+		bookUpdates:     make(map[string]chan BookUpdate),
+		tradePipes:      make(map[string]*eventPipe),
+		bookUpdatePipes: make(map[string]*eventPipe),
+		subscribed:      make(map[string]bool),
+		sequences:       make(map[string]*sequencer),
+		gapChecks:       make(map[string]*gapDetector),
+		gaps:            make(map[string]*gapChannel),
+		metrics:         make(map[string]*FeedMetrics),
+	}
+
+	for _, s := range symbols {
+		s = strings.ToLower(s)
+		mf.symbols = append(mf.symbols, s)
+		mf.sequences[tradeStream(s)] = &sequencer{}
+		mf.sequences[depthStream(s)] = &sequencer{}
+		mf.gapChecks[s] = &gapDetector{}
+		mf.gaps[s] = &gapChannel{}
+		mf.metrics[s] = NewFeedMetrics(s)
+		if c.clock != nil {
+			mf.metrics[s].SetClock(c.clock)
+		}
+		mf.addPipes(s, c.bufferOptions)
+	}
+
+	return mf
+}
+
+// addPipes makes the symbol's channels and the pipes that send them its events
+func (mf *binanceMultiFeeder) addPipes(symbol string, opts *BufferOptions) {
+	tChan := make(chan Trade)
+	mf.trades[symbol] = tChan
+	mf.tradePipes[symbol] = newEventPipe(&mf.lc, opts, nil,
+		func(e interface{}) bool {
+			select {
+			case tChan <- e.(Trade):
+				return true
+			case <-mf.lc.done():
+				return false
+			}
+		},
+		func() { close(tChan) })
+
+	buChan := make(chan BookUpdate)
+	mf.bookUpdates[symbol] = buChan
+	mf.bookUpdatePipes[symbol] = newEventPipe(&mf.lc, opts, mergeBookUpdates,
+		func(e interface{}) bool {
+			select {
+			case buChan <- e.(BookUpdate):
+				return true
+			case <-mf.lc.done():
+				return false
+			}
+		},
+		func() { close(buChan) })
+}
+
+// GetSymbols returns the symbols whose streams are multiplexed by the feeder
+func (mf *binanceMultiFeeder) GetSymbols() []string {
+	return mf.symbols
+}
+
+// Metrics returns the latency and throughput metrics of each symbol's streams,
+// in the order of GetSymbols. Reconnects of the shared connection are counted
+// by every symbol.
+func (mf *binanceMultiFeeder) Metrics() []*FeedMetrics {
+	metrics := make([]*FeedMetrics, 0, len(mf.symbols))
+	for _, s := range mf.symbols {
+		metrics = append(metrics, mf.metrics[s])
+	}
+	return metrics
+}
+
+// Feeder returns the feed of a single symbol. The shared connection is made
+// when the first Trades or BookUpdates channel of any symbol is requested.
+// Events are only routed to streams that have been requested, and every
+// requested channel must be read as they share the same connection.
+func (mf *binanceMultiFeeder) Feeder(symbol string) (Feeder, error) {
+	symbol = strings.ToLower(symbol)
+	if _, ok := mf.trades[symbol]; !ok {
+		return nil, fmt.Errorf("symbol %s is not part of the multi feeder", symbol)
+	}
+	return &symbolFeeder{parent: mf, symbol: symbol}, nil
+}
+
+func tradeStream(symbol string) string {
+	return fmt.Sprintf("%s@trade", symbol)
+}
+
+func depthStream(symbol string) string {
+	return fmt.Sprintf("%s@depth@100ms", symbol)
+}
+
+func (mf *binanceMultiFeeder) subscribe(stream string) error {
+	mf.mu.Lock()
+	mf.subscribed[stream] = true
+	mf.mu.Unlock()
+
+	mf.connect.Do(func() {
+		mf.connErr = mf.listen()
+	})
+	return mf.connErr
+}
+
+func (mf *binanceMultiFeeder) keepRawPayloads() bool {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+	mf.rawPayloads = true
+	return true
+}
+
+func (mf *binanceMultiFeeder) keepsRawPayloads() bool {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+	return mf.rawPayloads
+}
+
+func (mf *binanceMultiFeeder) isSubscribed(stream string) bool {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+	return mf.subscribed[stream]
+}
+
+func (mf *binanceMultiFeeder) listen() error {
+	var streams []string
+	for _, s := range mf.symbols {
+		streams = append(streams, tradeStream(s), depthStream(s))
+	}
+
+	u := url.URL{Scheme: "wss", Host: mf.baseURL, Path: "stream", RawQuery: "streams=" + strings.Join(streams, "/")}
+
+	mChan := make(chan []byte)
+	err := connectAndListen(&mf.lc, mf.socketOptions, u.String(), mChan, mf.reconnected)
+
+	mf.lc.goroutine(func() {
+		defer mf.closeAll()
+		for message := range mChan {
+			mf.route(message)
+		}
+	})
+	return err
+}
+
+// reconnected counts a reconnection of the shared connection in every symbol's metrics
+func (mf *binanceMultiFeeder) reconnected() {
+	for _, m := range mf.metrics {
+		m.reconnected()
+	}
+}
+
+// Close disconnects the shared connection and closes the channels of every symbol,
+// returning once all of the feeder's goroutines have stopped
+func (mf *binanceMultiFeeder) Close() error {
+	mf.lc.close()
+
+	// channels are closed when listening ends, which never started if no feeds were requested
+	mf.connect.Do(func() {
+		mf.connErr = errFeederClosed
+		mf.closeAll()
+	})
+	for _, s := range mf.symbols {
+		mf.gaps[s].close()
+	}
+	return nil
+}
+
+// route decodes the payload of a combined stream event and sends it to the
+// channel of the symbol the stream belongs to
+func (mf *binanceMultiFeeder) route(message []byte) {
+	var e combinedEvent
+	if err := json.Unmarshal(message, &e); err != nil {
+		log.Error().Err(err).
+			Str("detail", string(message)).
+			Msg("error unmarshalling combined stream event")
+		return
+	}
+
+	if !mf.isSubscribed(e.Stream) {
+		return
+	}
+
+	symbol := strings.SplitN(e.Stream, "@", 2)[0]
+	metrics := mf.metrics[symbol]
+
+	switch e.Stream {
+	case tradeStream(symbol):
+		t, err := decodeTrade(e.Data)
+		if err != nil {
+			metrics.message(TradeStreamMetrics)
+			metrics.decodeError(TradeStreamMetrics)
+			log.Error().Err(err).
+				Str("detail", string(e.Data)).
+				Msgf("error unmarshalling trade")
+			return
+		}
+		t.ReceivedAt = timeOf(mf.clock)
+		if mf.keepsRawPayloads() {
+			t.Raw = e.Data
+		}
+		if !mf.sequences[e.Stream].next(t.ID) {
+			return
+		}
+		metrics.message(TradeStreamMetrics)
+		metrics.received(TradeStreamMetrics, t.EventTime)
+		mf.tradePipes[symbol].push(t)
+	case depthStream(symbol):
+		b, err := decodeBookUpdate(e.Data)
+		if err != nil {
+			metrics.message(DepthStreamMetrics)
+			metrics.decodeError(DepthStreamMetrics)
+			log.Error().Err(err).
+				Str("detail", string(e.Data)).
+				Msgf("error unmarshalling book update")
+			return
+		}
+		b.ReceivedAt = timeOf(mf.clock)
+		if mf.keepsRawPayloads() {
+			b.Raw = e.Data
+		}
+		if !mf.sequences[e.Stream].next(b.LastUpdateID) {
+			return
+		}
+		metrics.message(DepthStreamMetrics)
+		metrics.received(DepthStreamMetrics, b.EventTime)
+		if gap, ok := mf.gapChecks[symbol].check(b); ok {
+			mf.gaps[symbol].report(gap)
+		}
+		mf.bookUpdatePipes[symbol].push(b)
+	default:
+		log.Warn().Str("stream", e.Stream).Msg("unexpected stream in combined stream event")
+	}
+}
+
+func (mf *binanceMultiFeeder) closeAll() {
+	for _, s := range mf.symbols {
+		mf.tradePipes[s].close()
+		mf.bookUpdatePipes[s].close()
+	}
+}
+
+// symbolFeeder is the Feeder of a single symbol of a binanceMultiFeeder
+type symbolFeeder struct {
+	parent *binanceMultiFeeder
+	symbol string
+}
+
+// Trades returns a read-only channel of trades made on the symbol's market
+func (sf *symbolFeeder) Trades() (<-chan Trade, error) {
+	sf.Metrics().setBacklog(TradeStreamMetrics, sf.parent.tradePipes[sf.symbol].backlog)
+	err := sf.parent.subscribe(tradeStream(sf.symbol))
+	return sf.parent.trades[sf.symbol], err
+}
+
+// BookUpdates returns a read-only channel of updates made on the symbol's orderbook
+func (sf *symbolFeeder) BookUpdates() (<-chan BookUpdate, error) {
+	sf.Metrics().setBacklog(DepthStreamMetrics, sf.parent.bookUpdatePipes[sf.symbol].backlog)
+	err := sf.parent.subscribe(depthStream(sf.symbol))
+	return sf.parent.bookUpdates[sf.symbol], err
+}
+
+// TradeBufferStats returns the trades discarded by the buffer of the symbol's trades
+func (sf *symbolFeeder) TradeBufferStats() BufferStats {
+	return sf.parent.tradePipes[sf.symbol].counts()
+}
+
+// BookUpdateBufferStats returns the book updates discarded or conflated by the
+// buffer of the symbol's book updates
+func (sf *symbolFeeder) BookUpdateBufferStats() BufferStats {
+	return sf.parent.bookUpdatePipes[sf.symbol].counts()
+}
+
+// DepthGaps returns a read-only channel of gaps between consecutive book updates
+// of the symbol. The channel is closed when the multi feeder is closed.
+func (sf *symbolFeeder) DepthGaps() <-chan DepthGap {
+	return sf.parent.gaps[sf.symbol].channel()
+}
+
+func (sf *symbolFeeder) GetSymbol() string {
+	return sf.symbol
+}
+
+// Metrics returns the latency and throughput metrics of the symbol's streams
+func (sf *symbolFeeder) Metrics() *FeedMetrics {
+	return sf.parent.metrics[sf.symbol]
+}
+
+// RESTURL returns the REST API host of the multi feeder's exchange
+func (sf *symbolFeeder) RESTURL() string {
+	return sf.parent.restURL
+}
+
+// keepRawPayloads has the multi feeder keep the raw payloads of every symbol's events
+func (sf *symbolFeeder) keepRawPayloads() bool {
+	return sf.parent.keepRawPayloads()
+}
+
+func (sf *symbolFeeder) streamNames() (string, string) {
+	return tradeStream(sf.symbol), depthStream(sf.symbol)
+}
+
+// Close closes the multi feeder the symbol belongs to, as the connection is
+// shared with every other symbol
+func (sf *symbolFeeder) Close() error {
+	return sf.parent.Close()
+}
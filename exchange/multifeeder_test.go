@@ -0,0 +1,333 @@
+package exchange
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+const combinedURL = "/stream"
+
+func combined(stream string, data string) string {
+	return fmt.Sprintf(`{"stream": "%s", "data": %s}`, stream, data)
+}
+
+func newTestMultiFeeder(ws *testServer, symbols ...string) *binanceMultiFeeder {
+	testDialer := websocket.DefaultDialer
+	testDialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+	mf := NewBinanceMultiFeeder(symbols...)
+	mf.baseURL = strings.TrimPrefix(ws.URL, "wss://")
+	mf.socketOptions = &SocketConnectionOptions{
+		Dialer:     testDialer,
+		MaxRetries: 0,
+	}
+	return mf
+}
+
+func TestNewBinanceMultiFeederReturnsSetUpFeeder(t *testing.T) {
+	mf := NewBinanceMultiFeeder("BNBBTC", "ethbtc")
+	assert.Equal(t, []string{"bnbbtc", "ethbtc"}, mf.GetSymbols())
+	assert.Equal(t, DefaultSocketOptions, mf.socketOptions)
+	assert.Equal(t, "stream.binance.com:9443", mf.baseURL)
+}
+
+func TestBinanceMultiFeederFeederImplementsFeederInterface(t *testing.T) {
+	mf := NewBinanceMultiFeeder("bnbbtc")
+	f, err := mf.Feeder("BNBBTC")
+
+	assert.NoError(t, err)
+	assert.Implements(t, (*Feeder)(nil), f, "Does not implement interface")
+	assert.Equal(t, "bnbbtc", f.GetSymbol())
+}
+
+func TestBinanceMultiFeederFeederReturnsErrorForUnknownSymbol(t *testing.T) {
+	mf := NewBinanceMultiFeeder("bnbbtc")
+	_, err := mf.Feeder("ethbtc")
+
+	assert.Error(t, err)
+}
+
+func TestBinanceMultiFeederRoutesEventsToSymbolChannels(t *testing.T) {
+	//arrange
+	mc := make(chan string, 5)
+	defer close(mc)
+
+	ws := newTestServer(combinedURL, mc)
+	defer ws.Close()
+
+	mf := newTestMultiFeeder(ws, "bnbbtc", "ethbtc")
+	bnb, _ := mf.Feeder("bnbbtc")
+	eth, _ := mf.Feeder("ethbtc")
+
+	//act
+	bnbTrades, err := bnb.Trades()
+	assert.NoError(t, err)
+	bnbBookUpdates, err := bnb.BookUpdates()
+	assert.NoError(t, err)
+	ethTrades, err := eth.Trades()
+	assert.NoError(t, err)
+
+	rawEthTrade := strings.Replace(rawTrade, "BNBBTC", "ETHBTC", 1)
+
+	mc <- combined("ethbtc@trade", rawEthTrade)
+	mc <- combined("bnbbtc@depth@100ms", rawBookUpdate)
+	mc <- combined("bnbbtc@trade", rawTrade)
+
+	//assert
+	expectedEthTrade := expectedTrade
+	expectedEthTrade.Symbol = "ETHBTC"
+
+	assert.Equal(t, expectedEthTrade, withoutReceipt(<-ethTrades))
+	assert.Equal(t, expectedBookUpdate, bookUpdateWithoutReceipt(<-bnbBookUpdates))
+	assert.Equal(t, expectedTrade, withoutReceipt(<-bnbTrades))
+}
+
+func TestBinanceMultiFeederSkipsStreamsWithoutSubscribers(t *testing.T) {
+	//arrange
+	mc := make(chan string, 5)
+	defer close(mc)
+
+	ws := newTestServer(combinedURL, mc)
+	defer ws.Close()
+
+	mc <- combined("bnbbtc@depth@100ms", rawBookUpdate)
+	mc <- combined("bnbbtc@trade", rawTrade)
+
+	mf := newTestMultiFeeder(ws, "bnbbtc")
+	bnb, _ := mf.Feeder("bnbbtc")
+
+	//act
+	tc, err := bnb.Trades()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedTrade, withoutReceipt(<-tc))
+}
+
+func TestBinanceMultiFeederSkipsAndLogsOnUnmarshalError(t *testing.T) {
+	//arrange
+	logBuffer.Reset()
+
+	mc := make(chan string, 5)
+	defer close(mc)
+
+	ws := newTestServer(combinedURL, mc)
+	defer ws.Close()
+
+	mc <- `{"stream": "bnbbtc@trade", "data": `
+	mc <- combined("bnbbtc@trade", rawTrade)
+
+	mf := newTestMultiFeeder(ws, "bnbbtc")
+	bnb, _ := mf.Feeder("bnbbtc")
+
+	//act
+	tc, err := bnb.Trades()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedTrade, withoutReceipt(<-tc))
+	assertContainsErrorLog(t, logBuffer.Contents(), "error unmarshalling combined stream event")
+}
+
+func TestBinanceMultiFeederClosesAllChannelsWhenConnectionEnds(t *testing.T) {
+	//arrange
+	mc := make(chan string, 5)
+
+	ws := newTestServer(combinedURL, mc)
+	defer ws.Close()
+
+	mf := newTestMultiFeeder(ws, "bnbbtc", "ethbtc")
+	bnb, _ := mf.Feeder("bnbbtc")
+	eth, _ := mf.Feeder("ethbtc")
+
+	bnbTrades, err := bnb.Trades()
+	assert.NoError(t, err)
+	ethBookUpdates, err := eth.BookUpdates()
+	assert.NoError(t, err)
+
+	//act
+	close(mc)
+
+	//assert
+	_, ok := <-bnbTrades
+	assert.False(t, ok)
+	_, ok = <-ethBookUpdates
+	assert.False(t, ok)
+}
+
+func TestBinanceMultiFeederReturnsErrorOnConnectionFailure(t *testing.T) {
+	//arrange
+	mc := make(chan string, 2)
+	defer close(mc)
+
+	ws := newTestServer("/doesnotexist", mc)
+	defer ws.Close()
+
+	mf := newTestMultiFeeder(ws, "bnbbtc")
+	bnb, _ := mf.Feeder("bnbbtc")
+
+	//act
+	_, err := bnb.Trades()
+	_, err2 := bnb.BookUpdates()
+
+	//assert
+	assert.Equal(t, errDialConnection, err)
+	assert.Equal(t, errDialConnection, err2)
+}
+
+func TestBinanceMultiFeederCloseClosesAllChannels(t *testing.T) {
+	//arrange
+	mc := make(chan string, 2)
+	defer close(mc)
+
+	ws := newTestServer(combinedURL, mc)
+	defer ws.Close()
+
+	mf := newTestMultiFeeder(ws, "bnbbtc", "ethbtc")
+	bnb, _ := mf.Feeder("bnbbtc")
+	eth, _ := mf.Feeder("ethbtc")
+
+	bnbTrades, err := bnb.Trades()
+	assert.NoError(t, err)
+
+	//act
+	err = eth.Close()
+
+	//assert
+	assert.NoError(t, err)
+
+	_, ok := <-bnbTrades
+	assert.False(t, ok)
+
+	ethTrades, err := eth.Trades()
+	assert.NoError(t, err)
+	_, ok = <-ethTrades
+	assert.False(t, ok)
+}
+
+func TestBinanceMultiFeederCloseBeforeConnectingClosesAllChannels(t *testing.T) {
+	//arrange
+	mf := NewBinanceMultiFeeder("bnbbtc")
+	bnb, _ := mf.Feeder("bnbbtc")
+
+	//act
+	err := mf.Close()
+
+	//assert
+	assert.NoError(t, err)
+
+	tc, err := bnb.Trades()
+	assert.Equal(t, errFeederClosed, err)
+	_, ok := <-tc
+	assert.False(t, ok)
+}
+
+func TestBinanceMultiFeederMeasuresEachSymbolsStreams(t *testing.T) {
+	//arrange
+	mc := make(chan string, 4)
+	defer close(mc)
+
+	ws := newTestServer(combinedURL, mc)
+	defer ws.Close()
+
+	mf := newTestMultiFeeder(ws, "bnbbtc", "ethbtc")
+	defer mf.Close()
+	bnb, _ := mf.Feeder("bnbbtc")
+
+	//act
+	tc, err := bnb.Trades()
+	assert.NoError(t, err)
+
+	mc <- combined("bnbbtc@trade", rawTrade)
+	mc <- combined("bnbbtc@trade", rawTrade)
+	mc <- combined("bnbbtc@trade", `{"e": "trade", "t": "ID"}`)
+	mc <- combined("bnbbtc@trade", tradeWithID(12346))
+	<-tc
+	<-tc
+
+	//assert
+	trades := bnb.(*symbolFeeder).Metrics().Snapshot().Streams[TradeStreamMetrics]
+	assert.Equal(t, uint64(3), trades.Messages)
+	assert.Equal(t, uint64(1), trades.DecodeErrors)
+	assert.Equal(t, uint64(2), trades.Latency.Count)
+
+	metrics := mf.Metrics()
+	assert.Equal(t, "bnbbtc", metrics[0].Snapshot().Symbol)
+	assert.Equal(t, "ethbtc", metrics[1].Snapshot().Symbol)
+	assert.Empty(t, metrics[1].Snapshot().Streams)
+}
+
+func TestBinanceMultiFeederCountsReconnectsForEverySymbol(t *testing.T) {
+	//arrange
+	mc := make(chan string)
+	ws := newTestServer(combinedURL, mc)
+	defer ws.Close()
+
+	mf := newTestMultiFeeder(ws, "bnbbtc", "ethbtc")
+	mf.socketOptions.ReconnectPolicy = &FixedBackOff{Interval: 10 * time.Millisecond, MaxRetries: 1}
+	defer mf.Close()
+	bnb, _ := mf.Feeder("bnbbtc")
+
+	//act
+	_, err := bnb.Trades()
+	assert.NoError(t, err)
+	close(mc)
+
+	//assert
+	assert.Eventually(t, func() bool {
+		for _, m := range mf.Metrics() {
+			if m.Snapshot().Reconnects != 1 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestBinanceMultiFeederBuffersEachSymbolSeparately(t *testing.T) {
+	//arrange
+	mc := make(chan string, 10)
+	defer close(mc)
+
+	ws := newTestServer(combinedURL, mc)
+	defer ws.Close()
+
+	testDialer := websocket.DefaultDialer
+	testDialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	mf := NewBinanceMultiFeederWithOptions([]string{"bnbbtc", "ethbtc"},
+		WithBufferOptions(&BufferOptions{Size: 1, Policy: DropNewest}))
+	mf.baseURL = strings.TrimPrefix(ws.URL, "wss://")
+	mf.socketOptions = &SocketConnectionOptions{Dialer: testDialer}
+	defer mf.Close()
+
+	bnb, _ := mf.Feeder("bnbbtc")
+	eth, _ := mf.Feeder("ethbtc")
+	_, err := bnb.Trades()
+	assert.NoError(t, err)
+	ethTrades, err := eth.Trades()
+	assert.NoError(t, err)
+
+	//act bnbbtc's trades are never read
+	for i := 1; i <= 5; i++ {
+		mc <- combined("bnbbtc@trade", tradeWithID(i))
+	}
+	rawEthTrade := strings.Replace(rawTrade, "BNBBTC", "ETHBTC", 1)
+	mc <- combined("ethbtc@trade", rawEthTrade)
+
+	//assert
+	select {
+	case trade := <-ethTrades:
+		assert.Equal(t, "ETHBTC", trade.Symbol)
+	case <-time.After(time.Second):
+		t.Fatal("slow consumer of one symbol held up another")
+	}
+	assert.Eventually(t, func() bool {
+		return bnb.(*symbolFeeder).TradeBufferStats().Dropped > 0
+	}, time.Second, 10*time.Millisecond)
+}
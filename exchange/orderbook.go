@@ -0,0 +1,397 @@
+package exchange
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultSnapshotLimit is the number of price levels requested per side
+	// when fetching an order book snapshot
+	DefaultSnapshotLimit int = 1000
+
+	depthSnapshotPath = "/api/v3/depth"
+
+	// maxBufferedBookUpdates is how many book updates are buffered while syncing
+	// before the oldest are dropped
+	maxBufferedBookUpdates = 10000
+)
+
+var (
+	errBookUpdatesClosed = errors.New("book updates channel closed")
+	errOrderBookClosed   = errors.New("order book closed")
+)
+
+// Taken from https://binance-docs.github.io/apidocs/spot/en/#order-book
+// {
+//   "lastUpdateId": 1027024,
+//   "bids": [
+//     [
+//       "4.00000000",     // PRICE
+//       "431.00000000"    // QTY
+//     ]
+//   ],
+//   "asks": [
+//     [
+//       "4.00000200",
+//       "12.00000000"
+//     ]
+//   ]
+// }
+
+// DepthSnapshot contains the full state of the order book up to a number of price levels.
+// It is also the payload of partial book depth streams, whose snapshots are given
+// the symbol of their market. ReceivedAt and Raw are as for Trade, except that
+// Raw is never kept of snapshots fetched from the REST API.
+type DepthSnapshot struct {
+	Symbol       string      `json:"-"`
+	LastUpdateID int         `json:"lastUpdateId"`
+	Bids         []BookEntry `json:"bids"`
+	Asks         []BookEntry `json:"asks"`
+
+	ReceivedAt time.Time       `json:"-"`
+	Raw        json.RawMessage `json:"-"`
+}
+
+type snapshotResult struct {
+	snapshot DepthSnapshot
+	err      error
+}
+
+// OrderBook maintains a local copy of a market's order book, following the
+// Binance procedure for managing a local order book:
+// https://binance-docs.github.io/apidocs/spot/en/#how-to-manage-a-local-order-book-correctly
+//
+// Book updates are buffered while a REST depth snapshot is fetched, then
+// applied in sequence using their first and final update IDs. The book is
+// resynchronised from a fresh snapshot whenever a gap in the sequence is detected.
+// Should syncing take long enough for the buffer to fill, its oldest updates
+// are dropped, as the snapshot either already contains them or is too old to be
+// continued by the rest and is refetched.
+type OrderBook struct {
+	feed          Feeder
+	rest          *restClient
+	snapshotPath  string
+	symbol        string
+	snapshotLimit int
+	retryInterval time.Duration
+	bufferLimit   int
+	lc            lifecycle
+
+	mu           sync.RWMutex
+	bids         map[Decimal]Decimal
+	asks         map[Decimal]Decimal
+	lastUpdateID int
+	synced       bool
+}
+
+// NewOrderBook returns an OrderBook for the feed's symbol, built from the
+// feed's book updates and snapshots taken from the Binance REST API. Snapshots
+// are taken from the feed's environment if known, otherwise from Production.
+func NewOrderBook(feed Feeder) *OrderBook {
+	return &OrderBook{
+		feed:          feed,
+		rest:          newRESTClient(restURLOf(feed)),
+		snapshotPath:  depthSnapshotPathOf(feed),
+		symbol:        feed.GetSymbol(),
+		snapshotLimit: DefaultSnapshotLimit,
+		retryInterval: time.Second,
+		bufferLimit:   maxBufferedBookUpdates,
+		bids:          make(map[Decimal]Decimal),
+		asks:          make(map[Decimal]Decimal),
+	}
+}
+
+// Start subscribes to the feed's book updates and begins maintaining the book
+// in the background until closed. The book is not queryable until the first
+// snapshot has been applied, which can be checked with Synced.
+func (ob *OrderBook) Start() error {
+	if ob.lc.closed() {
+		return errOrderBookClosed
+	}
+
+	buChan, err := ob.feed.BookUpdates()
+	if err != nil {
+		log.Error().Err(err).
+			Str("symbol", ob.symbol).
+			Msg("error on reading book updates")
+		return err
+	}
+
+	ob.lc.goroutine(func() {
+		ob.maintain(buChan)
+	})
+	return nil
+}
+
+// Close stops maintaining the book, waiting for its goroutines to return. The
+// book is left as it was, but no longer synced. The feed is not closed, as it
+// may be shared, such as by a hub.
+func (ob *OrderBook) Close() error {
+	ob.lc.close()
+	ob.setSynced(false)
+	return nil
+}
+
+// GetSymbol returns the symbol of the market the book belongs to
+func (ob *OrderBook) GetSymbol() string {
+	return ob.symbol
+}
+
+// Synced reports whether the book is consistent with the exchange
+func (ob *OrderBook) Synced() bool {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	return ob.synced
+}
+
+// LastUpdateID returns the final update ID of the last event applied to the book
+func (ob *OrderBook) LastUpdateID() int {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	return ob.lastUpdateID
+}
+
+// Bids returns up to depth bid levels, best (highest) price first.
+// A depth of 0 or less returns every level.
+func (ob *OrderBook) Bids(depth int) []BookEntry {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	return sortedLevels(ob.bids, depth, Decimal.GreaterThan)
+}
+
+// Asks returns up to depth ask levels, best (lowest) price first.
+// A depth of 0 or less returns every level.
+func (ob *OrderBook) Asks(depth int) []BookEntry {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	return sortedLevels(ob.asks, depth, Decimal.LessThan)
+}
+
+// BestBid returns the highest bid in the book, or false if there are no bids
+func (ob *OrderBook) BestBid() (BookEntry, bool) {
+	bids := ob.Bids(1)
+	if len(bids) == 0 {
+		return BookEntry{}, false
+	}
+	return bids[0], true
+}
+
+// BestAsk returns the lowest ask in the book, or false if there are no asks
+func (ob *OrderBook) BestAsk() (BookEntry, bool) {
+	asks := ob.Asks(1)
+	if len(asks) == 0 {
+		return BookEntry{}, false
+	}
+	return asks[0], true
+}
+
+func sortedLevels(levels map[Decimal]Decimal, depth int, less func(a, b Decimal) bool) []BookEntry {
+	prices := make([]Decimal, 0, len(levels))
+	for p := range levels {
+		prices = append(prices, p)
+	}
+	sort.Slice(prices, func(i, j int) bool { return less(prices[i], prices[j]) })
+
+	if depth > 0 && depth < len(prices) {
+		prices = prices[:depth]
+	}
+
+	entries := make([]BookEntry, len(prices))
+	for i, p := range prices {
+		entries[i] = BookEntry{Price: p, Quantity: levels[p]}
+	}
+	return entries
+}
+
+func (ob *OrderBook) maintain(buChan <-chan BookUpdate) {
+	snapshots := make(chan snapshotResult, 1)
+	var buffer []BookUpdate
+
+	ob.goFetchSnapshot(snapshots, 0)
+
+	for {
+		select {
+		case <-ob.lc.done():
+			return
+
+		case b, ok := <-buChan:
+			if !ok {
+				log.Error().Err(errBookUpdatesClosed).
+					Str("symbol", ob.symbol).
+					Msg("order book no longer maintained")
+				ob.setSynced(false)
+				return
+			}
+
+			if !ob.Synced() {
+				buffer = ob.bufferUpdate(buffer, b)
+				continue
+			}
+
+			if err := ob.apply(b); err != nil {
+				log.Warn().Err(err).
+					Str("symbol", ob.symbol).
+					Msg("resyncing order book")
+				ob.setSynced(false)
+				buffer = []BookUpdate{b}
+				ob.goFetchSnapshot(snapshots, 0)
+			}
+
+		case res := <-snapshots:
+			if res.err != nil {
+				log.Error().Err(res.err).
+					Str("symbol", ob.symbol).
+					Msg("error fetching order book snapshot")
+				ob.goFetchSnapshot(snapshots, ob.retryInterval)
+				continue
+			}
+
+			var err error
+			if buffer, err = ob.load(res.snapshot, buffer); err != nil {
+				log.Warn().Err(err).
+					Str("symbol", ob.symbol).
+					Msg("refetching order book snapshot")
+				ob.goFetchSnapshot(snapshots, ob.retryInterval)
+			}
+		}
+	}
+}
+
+// bufferUpdate adds the update to those waiting for a snapshot, dropping the
+// oldest half of them once the buffer is full
+func (ob *OrderBook) bufferUpdate(buffer []BookUpdate, b BookUpdate) []BookUpdate {
+	if len(buffer) >= ob.bufferLimit {
+		dropped := len(buffer) - ob.bufferLimit/2
+		log.Warn().
+			Str("symbol", ob.symbol).
+			Int("dropped", dropped).
+			Msg("dropping oldest book updates buffered while syncing order book")
+		buffer = append(buffer[:0:0], buffer[dropped:]...)
+	}
+	return append(buffer, b)
+}
+
+// goFetchSnapshot fetches a snapshot in the background after the delay, sending
+// the result unless the book is closed in the meantime
+func (ob *OrderBook) goFetchSnapshot(results chan<- snapshotResult, delay time.Duration) {
+	ob.lc.goroutine(func() {
+		if !ob.lc.sleep(delay) {
+			return
+		}
+
+		query := url.Values{}
+		query.Set("symbol", strings.ToUpper(ob.symbol))
+		query.Set("limit", strconv.Itoa(ob.snapshotLimit))
+
+		var s DepthSnapshot
+		err := ob.rest.getContext(ob.lc.context(), ob.snapshotPath, query, &s)
+		s.ReceivedAt = time.Now()
+		select {
+		case results <- snapshotResult{snapshot: s, err: err}:
+		case <-ob.lc.done():
+		}
+	})
+}
+
+// load replaces the book with the snapshot and applies the buffered updates
+// that follow it. The buffered updates are returned untouched if the snapshot
+// is too old to be continued by them.
+func (ob *OrderBook) load(s DepthSnapshot, buffer []BookUpdate) ([]BookUpdate, error) {
+	for len(buffer) > 0 && buffer[0].LastUpdateID <= s.LastUpdateID {
+		buffer = buffer[1:]
+	}
+	if len(buffer) > 0 && buffer[0].FirstUpdateID > s.LastUpdateID+1 {
+		return buffer, &SequenceError{Expected: s.LastUpdateID + 1, Received: buffer[0].FirstUpdateID}
+	}
+
+	ob.mu.Lock()
+	ob.bids = make(map[Decimal]Decimal, len(s.Bids))
+	ob.asks = make(map[Decimal]Decimal, len(s.Asks))
+	setLevels(ob.bids, s.Bids)
+	setLevels(ob.asks, s.Asks)
+	ob.lastUpdateID = s.LastUpdateID
+	ob.synced = true
+	ob.mu.Unlock()
+
+	for i, b := range buffer {
+		if err := ob.apply(b); err != nil {
+			ob.setSynced(false)
+			return buffer[i:], err
+		}
+	}
+
+	log.Info().
+		Str("symbol", ob.symbol).
+		Int("last_update_id", s.LastUpdateID).
+		Msg("order book synced")
+	return nil, nil
+}
+
+// apply updates the book with a single event, returning an error if the event
+// does not continue on from the last event applied
+func (ob *OrderBook) apply(b BookUpdate) error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	if b.LastUpdateID <= ob.lastUpdateID {
+		// already reflected in the book
+		return nil
+	}
+	if b.FirstUpdateID > ob.lastUpdateID+1 {
+		return &SequenceError{Expected: ob.lastUpdateID + 1, Received: b.FirstUpdateID}
+	}
+
+	setLevels(ob.bids, b.Bids)
+	setLevels(ob.asks, b.Asks)
+	ob.lastUpdateID = b.LastUpdateID
+	return nil
+}
+
+// depthSnapshotPather is implemented by feeds whose exchange serves depth
+// snapshots from a path other than the spot API's
+type depthSnapshotPather interface {
+	depthSnapshotPath() string
+}
+
+func depthSnapshotPathOf(feed Feeder) string {
+	if p, ok := feed.(depthSnapshotPather); ok {
+		return p.depthSnapshotPath()
+	}
+	return depthSnapshotPath
+}
+
+func (ob *OrderBook) setSynced(synced bool) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.synced = synced
+}
+
+func setLevels(levels map[Decimal]Decimal, entries []BookEntry) {
+	for _, e := range entries {
+		if e.Quantity.IsZero() {
+			delete(levels, e.Price)
+		} else {
+			levels[e.Price] = e.Quantity
+		}
+	}
+}
+
+// SequenceError reports a gap between update IDs of consecutive book events
+type SequenceError struct {
+	Expected int
+	Received int
+}
+
+func (e *SequenceError) Error() string {
+	return fmt.Sprintf("sequence gap in book updates: expected update ID %d, received %d", e.Expected, e.Received)
+}
@@ -0,0 +1,280 @@
+package exchange
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestRESTServer serves the given responses for a path in order, repeating the last
+func newTestRESTServer(path string, responses ...string) (*httptest.Server, *restClient) {
+	var mu sync.Mutex
+	calls := 0
+
+	router := http.NewServeMux()
+	router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		i := calls
+		if i >= len(responses) {
+			i = len(responses) - 1
+		}
+		calls++
+		w.Write([]byte(responses[i]))
+	})
+
+	server := httptest.NewTLSServer(router)
+	rc := &restClient{
+		baseURL:    strings.TrimPrefix(server.URL, "https://"),
+		httpClient: server.Client(),
+	}
+	return server, rc
+}
+
+func newTestOrderBook(feed Feeder, rc *restClient) *OrderBook {
+	ob := NewOrderBook(feed)
+	ob.rest = rc
+	ob.retryInterval = 10 * time.Millisecond
+	return ob
+}
+
+const testSnapshot = `{
+	"lastUpdateId": 100,
+	"bids": [["0.0024", "10"], ["0.0023", "5"]],
+	"asks": [["0.0026", "100"], ["0.0027", "50"]]
+}`
+
+func TestOrderBookAppliesBufferedUpdatesAfterSnapshot(t *testing.T) {
+	//arrange
+	server, rc := newTestRESTServer(depthSnapshotPath, testSnapshot)
+	defer server.Close()
+
+	feed := newStubFeeder(testSymbol)
+	// dropped, as already contained in snapshot
+	feed.bookUpdates <- BookUpdate{
+		FirstUpdateID: 90,
+		LastUpdateID:  95,
+		Bids:          []BookEntry{{Price: MustParseDecimal("0.0024"), Quantity: MustParseDecimal("1")}},
+	}
+	// straddles snapshot
+	feed.bookUpdates <- BookUpdate{
+		FirstUpdateID: 99,
+		LastUpdateID:  102,
+		Bids:          []BookEntry{{Price: MustParseDecimal("0.0024"), Quantity: MustParseDecimal("0")}, {Price: MustParseDecimal("0.0025"), Quantity: MustParseDecimal("3")}},
+	}
+	feed.bookUpdates <- BookUpdate{
+		FirstUpdateID: 103,
+		LastUpdateID:  104,
+		Asks:          []BookEntry{{Price: MustParseDecimal("0.0026"), Quantity: MustParseDecimal("80")}},
+	}
+
+	ob := newTestOrderBook(feed, rc)
+
+	//act
+	err := ob.Start()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return ob.LastUpdateID() == 104 }, time.Second, 10*time.Millisecond)
+	assert.True(t, ob.Synced())
+
+	assert.Equal(t, []BookEntry{{Price: MustParseDecimal("0.0025"), Quantity: MustParseDecimal("3")}, {Price: MustParseDecimal("0.0023"), Quantity: MustParseDecimal("5")}}, ob.Bids(0))
+	assert.Equal(t, []BookEntry{{Price: MustParseDecimal("0.0026"), Quantity: MustParseDecimal("80")}}, ob.Asks(1))
+
+	bid, ok := ob.BestBid()
+	assert.True(t, ok)
+	assert.Equal(t, BookEntry{Price: MustParseDecimal("0.0025"), Quantity: MustParseDecimal("3")}, bid)
+
+	ask, ok := ob.BestAsk()
+	assert.True(t, ok)
+	assert.Equal(t, BookEntry{Price: MustParseDecimal("0.0026"), Quantity: MustParseDecimal("80")}, ask)
+}
+
+func TestOrderBookResyncsOnSequenceGap(t *testing.T) {
+	//arrange
+	laterSnapshot := `{
+		"lastUpdateId": 200,
+		"bids": [["0.0020", "1"]],
+		"asks": [["0.0030", "2"]]
+	}`
+	server, rc := newTestRESTServer(depthSnapshotPath, testSnapshot, laterSnapshot)
+	defer server.Close()
+
+	feed := newStubFeeder(testSymbol)
+	ob := newTestOrderBook(feed, rc)
+
+	//act
+	err := ob.Start()
+	assert.NoError(t, err)
+	assert.Eventually(t, ob.Synced, time.Second, 10*time.Millisecond)
+
+	feed.bookUpdates <- BookUpdate{FirstUpdateID: 150, LastUpdateID: 200}
+	feed.bookUpdates <- BookUpdate{
+		FirstUpdateID: 201,
+		LastUpdateID:  201,
+		Bids:          []BookEntry{{Price: MustParseDecimal("0.0021"), Quantity: MustParseDecimal("4")}},
+	}
+
+	//assert
+	assert.Eventually(t, func() bool { return ob.LastUpdateID() == 201 }, time.Second, 10*time.Millisecond)
+	assert.True(t, ob.Synced())
+	assert.Equal(t, []BookEntry{{Price: MustParseDecimal("0.0021"), Quantity: MustParseDecimal("4")}, {Price: MustParseDecimal("0.0020"), Quantity: MustParseDecimal("1")}}, ob.Bids(0))
+	assert.Equal(t, []BookEntry{{Price: MustParseDecimal("0.0030"), Quantity: MustParseDecimal("2")}}, ob.Asks(0))
+}
+
+func TestOrderBookRefetchesSnapshotOlderThanBufferedUpdates(t *testing.T) {
+	//arrange
+	laterSnapshot := `{
+		"lastUpdateId": 120,
+		"bids": [["0.0020", "1"]],
+		"asks": [["0.0030", "2"]]
+	}`
+	server, rc := newTestRESTServer(depthSnapshotPath, testSnapshot, laterSnapshot)
+	defer server.Close()
+
+	feed := newStubFeeder(testSymbol)
+	feed.bookUpdates <- BookUpdate{
+		FirstUpdateID: 110,
+		LastUpdateID:  121,
+		Asks:          []BookEntry{{Price: MustParseDecimal("0.0030"), Quantity: MustParseDecimal("7")}},
+	}
+	ob := newTestOrderBook(feed, rc)
+
+	//act
+	err := ob.Start()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return ob.LastUpdateID() == 121 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []BookEntry{{Price: MustParseDecimal("0.0030"), Quantity: MustParseDecimal("7")}}, ob.Asks(0))
+}
+
+func TestOrderBookDropsOldestBufferedUpdatesOnceBufferFull(t *testing.T) {
+	//arrange
+	server, rc := newTestRESTServer(depthSnapshotPath, `not json`, testSnapshot)
+	defer server.Close()
+
+	feed := newStubFeeder(testSymbol)
+	for id := 91; id <= 100; id++ {
+		feed.bookUpdates <- BookUpdate{FirstUpdateID: id, LastUpdateID: id}
+	}
+	ob := newTestOrderBook(feed, rc)
+	ob.retryInterval = 100 * time.Millisecond
+	ob.bufferLimit = 4
+
+	//act
+	buffer := ob.bufferUpdate(nil, BookUpdate{FirstUpdateID: 1, LastUpdateID: 1})
+	for id := 2; id <= 5; id++ {
+		buffer = ob.bufferUpdate(buffer, BookUpdate{FirstUpdateID: id, LastUpdateID: id})
+	}
+	err := ob.Start()
+
+	//assert
+	assert.Equal(t, []BookUpdate{{FirstUpdateID: 3, LastUpdateID: 3}, {FirstUpdateID: 4, LastUpdateID: 4}, {FirstUpdateID: 5, LastUpdateID: 5}}, buffer)
+
+	assert.NoError(t, err)
+	assert.Eventually(t, ob.Synced, time.Second, 10*time.Millisecond)
+	feed.bookUpdates <- BookUpdate{FirstUpdateID: 101, LastUpdateID: 101}
+	assert.Eventually(t, func() bool { return ob.LastUpdateID() == 101 }, time.Second, 10*time.Millisecond)
+}
+
+func TestOrderBookRetriesOnSnapshotError(t *testing.T) {
+	//arrange
+	server, rc := newTestRESTServer(depthSnapshotPath, `not json`, testSnapshot)
+	defer server.Close()
+
+	logBuffer.Reset()
+
+	feed := newStubFeeder(testSymbol)
+	ob := newTestOrderBook(feed, rc)
+
+	//act
+	err := ob.Start()
+
+	//assert
+	assert.NoError(t, err)
+	assert.Eventually(t, ob.Synced, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 100, ob.LastUpdateID())
+	assertContainsErrorLog(t, logBuffer.Contents(), "error fetching order book snapshot")
+}
+
+func TestOrderBookIsNotSyncedAfterFeedCloses(t *testing.T) {
+	//arrange
+	server, rc := newTestRESTServer(depthSnapshotPath, testSnapshot)
+	defer server.Close()
+
+	feed := newStubFeeder(testSymbol)
+	ob := newTestOrderBook(feed, rc)
+
+	err := ob.Start()
+	assert.NoError(t, err)
+	assert.Eventually(t, ob.Synced, time.Second, 10*time.Millisecond)
+
+	//act
+	close(feed.bookUpdates)
+
+	//assert
+	assert.Eventually(t, func() bool { return !ob.Synced() }, time.Second, 10*time.Millisecond)
+}
+
+func TestOrderBookCloseStopsMaintainingBook(t *testing.T) {
+	//arrange
+	server, rc := newTestRESTServer(depthSnapshotPath, testSnapshot)
+	defer server.Close()
+
+	feed := newStubFeeder(testSymbol)
+	ob := newTestOrderBook(feed, rc)
+	assert.NoError(t, ob.Start())
+	assert.Eventually(t, ob.Synced, time.Second, 10*time.Millisecond)
+
+	//act
+	err := ob.Close()
+
+	//assert
+	assert.NoError(t, err)
+	assert.False(t, ob.Synced())
+
+	feed.bookUpdates <- BookUpdate{FirstUpdateID: 101, LastUpdateID: 101}
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 100, ob.LastUpdateID())
+	assert.Len(t, feed.bookUpdates, 1, "closed book stops reading updates")
+
+	assert.Equal(t, errOrderBookClosed, ob.Start())
+}
+
+func TestOrderBookCloseAbandonsSnapshotFetch(t *testing.T) {
+	//arrange
+	requested := make(chan struct{}, 1)
+	router := http.NewServeMux()
+	router.HandleFunc(depthSnapshotPath, func(w http.ResponseWriter, r *http.Request) {
+		requested <- struct{}{}
+		<-r.Context().Done()
+	})
+	server := httptest.NewTLSServer(router)
+	defer server.Close()
+
+	rc := &restClient{baseURL: strings.TrimPrefix(server.URL, "https://"), httpClient: server.Client()}
+	ob := newTestOrderBook(newStubFeeder(testSymbol), rc)
+	assert.NoError(t, ob.Start())
+	<-requested
+
+	//act
+	closed := make(chan error)
+	go func() {
+		closed <- ob.Close()
+	}()
+
+	//assert
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close waited on the snapshot request")
+	}
+}
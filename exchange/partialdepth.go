@@ -0,0 +1,88 @@
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// UpdateSpeed is the interval at which a depth stream is pushed
+type UpdateSpeed string
+
+// Update speeds supported by Binance depth streams
+const (
+	Speed100ms  UpdateSpeed = "100ms"
+	Speed1000ms UpdateSpeed = "1000ms"
+)
+
+// PartialDepthLevels contains the number of levels supported by partial book depth streams
+var PartialDepthLevels = []int{5, 10, 20}
+
+// Taken from https://binance-docs.github.io/apidocs/spot/en/#partial-book-depth-streams
+// {
+//   "lastUpdateId": 160,  // Last update ID
+//   "bids": [             // Bids to be updated
+//     [
+//       "0.0024",         // Price level to be updated
+//       "10"              // Quantity
+//     ]
+//   ],
+//   "asks": [             // Asks to be updated
+//     [
+//       "0.0026",         // Price level to be updated
+//       "100"             // Quantity
+//     ]
+//   ]
+// }
+
+// PartialDepth returns a read-only channel of snapshots of the top levels of the
+// order book, pushed at the given speed. Levels must be one of PartialDepthLevels.
+func (bf *binanceFeeder) PartialDepth(levels int, speed UpdateSpeed) (<-chan DepthSnapshot, error) {
+	if !validDepthLevels(levels) {
+		return nil, fmt.Errorf("unsupported partial depth levels: %d", levels)
+	}
+
+	var stream string
+	switch speed {
+	case Speed100ms:
+		stream = fmt.Sprintf("depth%d@%s", levels, speed)
+	case Speed1000ms:
+		stream = fmt.Sprintf("depth%d", levels)
+	default:
+		return nil, fmt.Errorf("unsupported update speed: %s", speed)
+	}
+
+	mChan, err := bf.listen(stream)
+
+	dsChan := make(chan DepthSnapshot)
+	bf.lc.goroutine(func() {
+		defer close(dsChan)
+		bf.read(mChan, stream, "partial depth", func(message []byte, r receipt) (streamEvent, error) {
+			ds := DepthSnapshot{Symbol: strings.ToUpper(bf.symbol), ReceivedAt: r.at, Raw: r.raw}
+			err := json.Unmarshal(message, &ds)
+			return streamEvent{event: ds, seqNo: ds.LastUpdateID}, err
+		}, bf.sendDepthSnapshot(dsChan))
+	})
+	return dsChan, err
+}
+
+// sendDepthSnapshot returns a function sending snapshots on the channel until the feeder is closed
+func (bf *binanceFeeder) sendDepthSnapshot(dsChan chan<- DepthSnapshot) func(e interface{}) bool {
+	return func(e interface{}) bool {
+		select {
+		case dsChan <- e.(DepthSnapshot):
+			return true
+		case <-bf.lc.done():
+			return false
+		}
+	}
+}
+
+func validDepthLevels(levels int) bool {
+	for _, l := range PartialDepthLevels {
+		if levels == l {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package exchange
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	rawPartialDepth = `{
+		"lastUpdateId": 160,
+		"bids": [
+			["0.0024", "10"],
+			["0.0023", "5"]
+		],
+		"asks": [
+			["0.0026", "100"]
+		]
+	}`
+
+	expectedPartialDepth = DepthSnapshot{
+		Symbol:       "TEST",
+		LastUpdateID: 160,
+		Bids: []BookEntry{
+			{Price: MustParseDecimal("0.0024"), Quantity: MustParseDecimal("10")},
+			{Price: MustParseDecimal("0.0023"), Quantity: MustParseDecimal("5")},
+		},
+		Asks: []BookEntry{
+			{Price: MustParseDecimal("0.0026"), Quantity: MustParseDecimal("100")},
+		},
+	}
+)
+
+func TestBinanceFeederImplementsPartialDepthFeederInterface(t *testing.T) {
+	assert.Implements(t, (*PartialDepthFeeder)(nil), &binanceFeeder{}, "Does not implement interface")
+}
+
+func TestBinanceFeederPartialDepthSubscribesToStreamForLevelsAndSpeed(t *testing.T) {
+	cases := []struct {
+		levels int
+		speed  UpdateSpeed
+		path   string
+	}{
+		{5, Speed100ms, "/ws/test@depth5@100ms"},
+		{10, Speed1000ms, "/ws/test@depth10"},
+		{20, Speed100ms, "/ws/test@depth20@100ms"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			//arrange
+			mc := make(chan string, 2)
+			defer close(mc)
+
+			ws := newTestServer(c.path, mc)
+			defer ws.Close()
+
+			mc <- rawPartialDepth
+
+			bf := newTestBinanceFeeder(ws, 0)
+
+			//act
+			dsc, err := bf.PartialDepth(c.levels, c.speed)
+
+			//assert
+			assert.NoError(t, err)
+			assert.Equal(t, expectedPartialDepth, eventWithoutReceipt(<-dsc))
+		})
+	}
+}
+
+func TestBinanceFeederPartialDepthReturnsErrorForUnsupportedOptions(t *testing.T) {
+	bf := NewBinanceFeeder("BTCBNB")
+
+	_, err := bf.PartialDepth(15, Speed100ms)
+	assert.Error(t, err)
+
+	_, err = bf.PartialDepth(5, "250ms")
+	assert.Error(t, err)
+}
+
+func TestBinanceFeederPartialDepthSkipsAndLogsOnUnmarshalError(t *testing.T) {
+	//arrange
+	logBuffer.Reset()
+
+	mc := make(chan string, 3)
+	defer close(mc)
+
+	ws := newTestServer("/ws/test@depth5@100ms", mc)
+	defer ws.Close()
+
+	mc <- `{"lastUpdateId": 160, "bids": [["0.0024", "10", "1"]], "asks": []}`
+	mc <- rawPartialDepth
+
+	bf := newTestBinanceFeeder(ws, 0)
+
+	//act
+	dsc, err := bf.PartialDepth(5, Speed100ms)
+
+	//assert
+	assert.NoError(t, err)
+	assert.Equal(t, expectedPartialDepth, eventWithoutReceipt(<-dsc))
+	assertContainsErrorLog(t, logBuffer.Contents(), "error unmarshalling partial depth")
+}
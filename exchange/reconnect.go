@@ -0,0 +1,128 @@
+package exchange
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// UnlimitedRetries can be used as the MaxRetries of a policy to never stop reconnecting
+const UnlimitedRetries int = -1
+
+// ReconnectPolicy structs decide how long to wait before each attempt to
+// (re)connect a stream. NextBackOff is given the number of consecutive failed
+// attempts so far, starting at 1, and returns the time to wait before the
+// next attempt, or false if no further attempts should be made.
+type ReconnectPolicy interface {
+	NextBackOff(failures int) (time.Duration, bool)
+}
+
+func withinRetries(failures int, maxRetries int) bool {
+	return maxRetries == UnlimitedRetries || failures <= maxRetries
+}
+
+// FixedBackOff waits the same interval before every attempt
+type FixedBackOff struct {
+	Interval   time.Duration
+	MaxRetries int
+}
+
+func (fb *FixedBackOff) NextBackOff(failures int) (time.Duration, bool) {
+	return fb.Interval, withinRetries(failures, fb.MaxRetries)
+}
+
+// ExponentialBackOff multiplies the wait before each consecutive attempt,
+// starting at Initial and capped at Max, or at the longest Duration if Max is zero
+type ExponentialBackOff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	MaxRetries int
+}
+
+func (eb *ExponentialBackOff) NextBackOff(failures int) (time.Duration, bool) {
+	if !withinRetries(failures, eb.MaxRetries) {
+		return 0, false
+	}
+
+	max := eb.Max
+	if max <= 0 {
+		max = math.MaxInt64
+	}
+
+	// compared as floats, as the back off can grow past what a Duration can hold
+	backOff := float64(eb.Initial) * math.Pow(eb.Multiplier, float64(failures-1))
+	if backOff >= float64(max) {
+		return max, true
+	}
+	return time.Duration(backOff), true
+}
+
+// FullJitter waits a random duration between zero and the back off of the
+// wrapped policy, so that many clients disconnected at once don't all
+// reconnect at the same time. See https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+type FullJitter struct {
+	Policy ReconnectPolicy
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (fj *FullJitter) NextBackOff(failures int) (time.Duration, bool) {
+	backOff, ok := fj.Policy.NextBackOff(failures)
+	if !ok || backOff <= 0 {
+		return backOff, ok
+	}
+
+	fj.mu.Lock()
+	defer fj.mu.Unlock()
+	if fj.rand == nil {
+		fj.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	n := int64(backOff)
+	if n < math.MaxInt64 {
+		n++ // so the back off itself can be waited
+	}
+	return time.Duration(fj.rand.Int63n(n)), true
+}
+
+// RetryBudget limits the wrapped policy to at most Max attempts within any
+// rolling Window, across every stream the policy is shared between
+type RetryBudget struct {
+	Policy ReconnectPolicy
+	Max    int
+	Window time.Duration
+
+	mu       sync.Mutex
+	attempts []time.Time
+	now      func() time.Time
+}
+
+func (rb *RetryBudget) NextBackOff(failures int) (time.Duration, bool) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	now := time.Now()
+	if rb.now != nil {
+		now = rb.now()
+	}
+
+	recent := rb.attempts[:0]
+	for _, a := range rb.attempts {
+		if now.Sub(a) < rb.Window {
+			recent = append(recent, a)
+		}
+	}
+	rb.attempts = recent
+
+	if len(rb.attempts) >= rb.Max {
+		return 0, false
+	}
+
+	backOff, ok := rb.Policy.NextBackOff(failures)
+	if ok {
+		rb.attempts = append(rb.attempts, now)
+	}
+	return backOff, ok
+}
@@ -0,0 +1,199 @@
+package exchange
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixedBackOffWaitsIntervalUntilMaxRetries(t *testing.T) {
+	p := &FixedBackOff{Interval: time.Second, MaxRetries: 2}
+
+	for failures := 1; failures <= 2; failures++ {
+		backOff, ok := p.NextBackOff(failures)
+		assert.True(t, ok)
+		assert.Equal(t, time.Second, backOff)
+	}
+
+	_, ok := p.NextBackOff(3)
+	assert.False(t, ok)
+}
+
+func TestExponentialBackOffGrowsUntilMax(t *testing.T) {
+	p := &ExponentialBackOff{
+		Initial:    100 * time.Millisecond,
+		Max:        time.Second,
+		Multiplier: 2,
+		MaxRetries: UnlimitedRetries,
+	}
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, e := range expected {
+		backOff, ok := p.NextBackOff(i + 1)
+		assert.True(t, ok)
+		assert.Equal(t, e, backOff)
+	}
+
+	_, ok := p.NextBackOff(10000)
+	assert.True(t, ok)
+}
+
+func TestExponentialBackOffWithoutMaxDoesNotOverflow(t *testing.T) {
+	p := &ExponentialBackOff{Initial: time.Second, Multiplier: 2, MaxRetries: UnlimitedRetries}
+
+	for _, failures := range []int{35, 100, 10000} {
+		backOff, ok := p.NextBackOff(failures)
+		assert.True(t, ok)
+		assert.Equal(t, time.Duration(math.MaxInt64), backOff, failures)
+	}
+
+	jittered, ok := (&FullJitter{Policy: p}).NextBackOff(100)
+	assert.True(t, ok)
+	assert.True(t, jittered >= 0)
+}
+
+func TestExponentialBackOffStopsAfterMaxRetries(t *testing.T) {
+	p := &ExponentialBackOff{Initial: time.Millisecond, Multiplier: 2, MaxRetries: 3}
+
+	_, ok := p.NextBackOff(3)
+	assert.True(t, ok)
+
+	_, ok = p.NextBackOff(4)
+	assert.False(t, ok)
+}
+
+func TestFullJitterWaitsUpToWrappedBackOff(t *testing.T) {
+	p := &FullJitter{Policy: &FixedBackOff{Interval: 100 * time.Millisecond, MaxRetries: UnlimitedRetries}}
+
+	var distinct = make(map[time.Duration]bool)
+	for i := 0; i < 50; i++ {
+		backOff, ok := p.NextBackOff(1)
+		assert.True(t, ok)
+		assert.True(t, backOff >= 0 && backOff <= 100*time.Millisecond)
+		distinct[backOff] = true
+	}
+	assert.True(t, len(distinct) > 1)
+}
+
+func TestFullJitterStopsWhenWrappedPolicyStops(t *testing.T) {
+	p := &FullJitter{Policy: &FixedBackOff{Interval: time.Second, MaxRetries: 0}}
+
+	_, ok := p.NextBackOff(1)
+	assert.False(t, ok)
+}
+
+func TestRetryBudgetLimitsAttemptsWithinWindow(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &RetryBudget{
+		Policy: &FixedBackOff{Interval: time.Second, MaxRetries: UnlimitedRetries},
+		Max:    2,
+		Window: time.Minute,
+		now:    func() time.Time { return now },
+	}
+
+	_, ok := p.NextBackOff(1)
+	assert.True(t, ok)
+	_, ok = p.NextBackOff(1)
+	assert.True(t, ok)
+	_, ok = p.NextBackOff(1)
+	assert.False(t, ok)
+
+	// budget is regained once earlier attempts leave the window
+	now = now.Add(time.Minute)
+	backOff, ok := p.NextBackOff(1)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, backOff)
+}
+
+func TestSocketConnectionOptionsFallsBackToFixedBackOff(t *testing.T) {
+	opts := &SocketConnectionOptions{MaxRetries: 3, BackOffTime: time.Second}
+
+	assert.Equal(t, &FixedBackOff{Interval: time.Second, MaxRetries: 3}, opts.reconnectPolicy())
+}
+
+func TestSocketConnectionOptionsDialPolicyFallsBackToReconnectPolicy(t *testing.T) {
+	reconnect := &FixedBackOff{Interval: time.Second, MaxRetries: UnlimitedRetries}
+	opts := &SocketConnectionOptions{ReconnectPolicy: reconnect}
+
+	assert.Equal(t, reconnect, opts.dialPolicy())
+}
+
+func TestDefaultSocketOptionsDialPolicyGivesUp(t *testing.T) {
+	policy := DefaultSocketOptions.dialPolicy()
+
+	failures := 1
+	for ; failures < 100; failures++ {
+		if _, ok := policy.NextBackOff(failures); !ok {
+			break
+		}
+	}
+	assert.Equal(t, 6, failures)
+}
+
+func TestBinanceFeederTradesReturnsErrorAfterDialPolicyWithUnlimitedReconnects(t *testing.T) {
+	//arrange
+	mc := make(chan string, 2)
+	defer close(mc)
+
+	ws := newTestServer("/doesnotexist", mc)
+	defer ws.Close()
+
+	bf := newTestBinanceFeeder(ws, 0)
+	bf.socketOptions.ReconnectPolicy = &FixedBackOff{Interval: time.Millisecond, MaxRetries: UnlimitedRetries}
+	bf.socketOptions.DialPolicy = &FixedBackOff{Interval: time.Millisecond, MaxRetries: 2}
+
+	//act
+	_, err := bf.Trades()
+
+	//assert
+	assert.Equal(t, errDialConnection, err)
+}
+
+func TestBinanceFeederTradesKeepsReconnectingWithUnlimitedPolicy(t *testing.T) {
+	//arrange
+
+	// every connection sends a single trade then disconnects
+	var connections int32
+	router := http.NewServeMux()
+	router.HandleFunc(tradesURL, func(w http.ResponseWriter, r *http.Request) {
+		var upgrader = websocket.Upgrader{}
+		c, _ := upgrader.Upgrade(w, r, nil)
+		n := atomic.AddInt32(&connections, 1)
+		c.WriteMessage(websocket.TextMessage, []byte(tradeWithID(int(n))))
+		c.Close()
+	})
+	server := httptest.NewTLSServer(router)
+	defer server.Close()
+	ws := &testServer{Server: server}
+	ws.URL = "wss" + strings.TrimPrefix(server.URL, "https")
+
+	bf := newTestBinanceFeeder(ws, 0)
+	bf.socketOptions.ReconnectPolicy = &FixedBackOff{Interval: 10 * time.Millisecond, MaxRetries: UnlimitedRetries}
+	defer bf.Close()
+
+	//act
+	tc, err := bf.Trades()
+
+	//assert
+	assert.NoError(t, err)
+	for i := 1; i <= 10; i++ {
+		actualTrade, ok := <-tc
+		assert.True(t, ok)
+		assert.Equal(t, i, actualTrade.ID)
+	}
+	assert.True(t, atomic.LoadInt32(&connections) >= 10)
+}
@@ -0,0 +1,328 @@
+package exchange
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// RecordingFileExtension is the extension of the files written by a Recorder
+	RecordingFileExtension string = ".jsonl.gz"
+
+	recordingTimeFormat = "20060102T150405.000000000Z"
+)
+
+var errRawPayloadsUnsupported = errors.New("feed can't keep the raw payloads of its events to record")
+
+// Record is a single event in a recording, stored as one line of JSON
+type Record struct {
+	Stream     string          `json:"stream"`     // Stream the event was received on, e.g. "bnbbtc@trade" or "btcusdt@aggTrade"
+	ReceivedAt int64           `json:"receivedAt"` // Local time the event was received, in Unix nanoseconds
+	Data       json.RawMessage `json:"data"`       // Event payload, as sent by Binance
+}
+
+// RecordingOptions configures the files written by a Recorder.
+// MaxFileSize is the compressed size in bytes a file can reach before
+// another is started. RotateEvery is how long a file is written to before
+// another is started. Each is disabled when zero.
+type RecordingOptions struct {
+	MaxFileSize int64
+	RotateEvery time.Duration
+}
+
+var DefaultRecordingOptions = &RecordingOptions{
+	MaxFileSize: 100 << 20,
+	RotateEvery: time.Hour,
+}
+
+// Recorder is a Feeder that records every trade and book update of the feed
+// it wraps to gzipped JSON lines files, while passing them on unchanged.
+// Each event's raw payload is recorded with the time it was received. Events
+// without one, such as book updates merged by a conflating buffer, are recorded
+// re-encoded instead.
+// Files are named <symbol>-<UTC start time>-<sequence>.jsonl.gz, so that
+// they sort in the order they were written.
+type Recorder struct {
+	feed Feeder
+	w    *rotatingWriter
+
+	mu       sync.Mutex
+	reencode map[string]bool // streams warned of events being re-encoded
+
+	lc lifecycle
+}
+
+// NewRecorder returns a Recorder of the feed writing to files in dir, which is
+// created if it doesn't exist. The feed is made to keep the raw payloads of its
+// events, returning an error if it can't, so it should be recorded before any of
+// its streams are requested. Nil options are DefaultRecordingOptions.
+func NewRecorder(feed Feeder, dir string, opts *RecordingOptions) (*Recorder, error) {
+	if !keepRawPayloadsOf(feed) {
+		return nil, errRawPayloadsUnsupported
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = DefaultRecordingOptions
+	}
+
+	return &Recorder{
+		feed: feed,
+		w: &rotatingWriter{
+			dir:    dir,
+			prefix: strings.ToLower(feed.GetSymbol()),
+			opts:   opts,
+			now:    time.Now,
+		},
+	}, nil
+}
+
+func (r *Recorder) GetSymbol() string {
+	return r.feed.GetSymbol()
+}
+
+// RESTURL returns the REST API host of the recorded feed's exchange
+func (r *Recorder) RESTURL() string {
+	return restURLOf(r.feed)
+}
+
+func (r *Recorder) depthSnapshotPath() string {
+	return depthSnapshotPathOf(r.feed)
+}
+
+// DepthGaps returns the recorded feed's channel of depth gaps, nil if it has none
+func (r *Recorder) DepthGaps() <-chan DepthGap {
+	return depthGapsOf(r.feed)
+}
+
+func (r *Recorder) keepRawPayloads() bool {
+	return keepRawPayloadsOf(r.feed)
+}
+
+func (r *Recorder) streamNames() (string, string) {
+	return streamNamesOf(r.feed)
+}
+
+// Trades returns a read-only channel of the feed's trades, each of which is
+// recorded before being sent
+func (r *Recorder) Trades() (<-chan Trade, error) {
+	in, err := r.feed.Trades()
+	if err != nil {
+		return nil, err
+	}
+
+	stream, _ := streamNamesOf(r.feed)
+	tChan := make(chan Trade)
+	r.lc.goroutine(func() {
+		defer close(tChan)
+		for {
+			select {
+			case t, ok := <-in:
+				if !ok {
+					return
+				}
+				r.record(stream, t.ReceivedAt, t.Raw, t)
+				select {
+				case tChan <- t:
+				case <-r.lc.done():
+					return
+				}
+			case <-r.lc.done():
+				return
+			}
+		}
+	})
+	return tChan, nil
+}
+
+// BookUpdates returns a read-only channel of the feed's book updates, each of
+// which is recorded before being sent
+func (r *Recorder) BookUpdates() (<-chan BookUpdate, error) {
+	in, err := r.feed.BookUpdates()
+	if err != nil {
+		return nil, err
+	}
+
+	_, stream := streamNamesOf(r.feed)
+	buChan := make(chan BookUpdate)
+	r.lc.goroutine(func() {
+		defer close(buChan)
+		for {
+			select {
+			case b, ok := <-in:
+				if !ok {
+					return
+				}
+				r.record(stream, b.ReceivedAt, b.Raw, b)
+				select {
+				case buChan <- b:
+				case <-r.lc.done():
+					return
+				}
+			case <-r.lc.done():
+				return
+			}
+		}
+	})
+	return buChan, nil
+}
+
+// Close closes the wrapped feed, then flushes, syncs and closes the current file
+func (r *Recorder) Close() error {
+	err := r.feed.Close()
+	r.lc.close()
+
+	if werr := r.w.close(); werr != nil {
+		return werr
+	}
+	return err
+}
+
+// record writes the raw payload of an event to the current file, or the event
+// re-encoded if it has none. Errors are logged rather than returned, so that the
+// feed carries on regardless.
+func (r *Recorder) record(stream string, receivedAt time.Time, raw json.RawMessage, event interface{}) {
+	var err error
+	if raw == nil {
+		r.warnReencoding(stream)
+		if raw, err = json.Marshal(event); err != nil {
+			log.Error().Err(err).
+				Str("stream", stream).
+				Msg("error recording event")
+			return
+		}
+	}
+
+	line, err := json.Marshal(Record{Stream: stream, ReceivedAt: receivedAt.UnixNano(), Data: raw})
+	if err == nil {
+		err = r.w.write(append(line, '\n'))
+	}
+
+	if err != nil {
+		log.Error().Err(err).
+			Str("stream", stream).
+			Msg("error recording event")
+	}
+}
+
+// warnReencoding warns the first time an event of the stream is re-encoded, as
+// every merged book update would otherwise be warned of
+func (r *Recorder) warnReencoding(stream string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reencode[stream] {
+		return
+	}
+	if r.reencode == nil {
+		r.reencode = make(map[string]bool)
+	}
+	r.reencode[stream] = true
+	log.Warn().
+		Str("stream", stream).
+		Msg("recording events without a raw payload re-encoded")
+}
+
+// rotatingWriter writes to a sequence of gzipped files, starting a new file
+// when the current one grows too large or old
+type rotatingWriter struct {
+	dir    string
+	prefix string
+	opts   *RecordingOptions
+	now    func() time.Time
+
+	mu      sync.Mutex
+	file    *os.File
+	counter *countingWriter
+	gz      *gzip.Writer
+	opened  time.Time
+	seq     int
+}
+
+func (rw *rotatingWriter) write(p []byte) error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.file == nil || rw.full() {
+		if err := rw.rotate(); err != nil {
+			return err
+		}
+	}
+
+	_, err := rw.gz.Write(p)
+	return err
+}
+
+func (rw *rotatingWriter) full() bool {
+	if rw.opts.MaxFileSize > 0 && rw.counter.n >= rw.opts.MaxFileSize {
+		return true
+	}
+	return rw.opts.RotateEvery > 0 && rw.now().Sub(rw.opened) >= rw.opts.RotateEvery
+}
+
+func (rw *rotatingWriter) rotate() error {
+	if err := rw.closeFile(); err != nil {
+		return err
+	}
+
+	rw.opened = rw.now()
+	rw.seq++
+	name := fmt.Sprintf("%s-%s-%06d%s", rw.prefix, rw.opened.UTC().Format(recordingTimeFormat), rw.seq, RecordingFileExtension)
+
+	f, err := os.OpenFile(filepath.Join(rw.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	rw.file = f
+	rw.counter = &countingWriter{w: f}
+	rw.gz = gzip.NewWriter(rw.counter)
+	return nil
+}
+
+// closeFile completes the gzip stream of the current file and syncs it to disk
+func (rw *rotatingWriter) closeFile() error {
+	if rw.file == nil {
+		return nil
+	}
+
+	f := rw.file
+	rw.file = nil
+
+	err := rw.gz.Close()
+	if serr := f.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (rw *rotatingWriter) close() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return rw.closeFile()
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
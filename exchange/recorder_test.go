@@ -0,0 +1,308 @@
+package exchange
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readRecordings returns the records of every file in dir, in file name order
+func readRecordings(t *testing.T, dir string) [][]Record {
+	names, err := filepath.Glob(filepath.Join(dir, "*"+RecordingFileExtension))
+	assert.NoError(t, err)
+	sort.Strings(names)
+
+	var files [][]Record
+	for _, name := range names {
+		f, err := os.Open(name)
+		assert.NoError(t, err)
+		gz, err := gzip.NewReader(f)
+		assert.NoError(t, err)
+
+		var records []Record
+		scanner := bufio.NewScanner(gz)
+		for scanner.Scan() {
+			var r Record
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+			records = append(records, r)
+		}
+		assert.NoError(t, scanner.Err())
+		f.Close()
+
+		files = append(files, records)
+	}
+	return files
+}
+
+// withRaw returns the trade with a raw payload for a Recorder to record
+func withRaw(t Trade) Trade {
+	t.Raw = json.RawMessage(fmt.Sprintf(`{"e":"trade","t":%d}`, t.ID))
+	return t
+}
+
+type closeTrackingFeeder struct {
+	*stubFeeder
+	closed bool
+}
+
+func (cf *closeTrackingFeeder) Close() error {
+	cf.closed = true
+	return nil
+}
+
+func TestRecorderImplementsFeederInterface(t *testing.T) {
+	r, err := NewRecorder(newStubFeeder(testSymbol), t.TempDir(), DefaultRecordingOptions)
+
+	assert.NoError(t, err)
+	assert.Implements(t, (*Feeder)(nil), r, "Does not implement interface")
+	assert.Equal(t, testSymbol, r.GetSymbol())
+}
+
+func TestRecorderPassesOnAndRecordsRawPayloads(t *testing.T) {
+	//arrange
+	dir := t.TempDir()
+	received := time.Unix(1600000000, 5)
+
+	trade := expectedTrade
+	trade.ReceivedAt, trade.Raw = received, json.RawMessage(rawTrade)
+	bookUpdate := expectedBookUpdate
+	bookUpdate.ReceivedAt, bookUpdate.Raw = received.Add(time.Millisecond), json.RawMessage(rawBookUpdate)
+
+	feed := newStubFeeder("BNBBTC")
+	feed.trades <- trade
+	feed.bookUpdates <- bookUpdate
+
+	r, err := NewRecorder(feed, dir, DefaultRecordingOptions)
+	assert.NoError(t, err)
+
+	//act
+	tc, err := r.Trades()
+	assert.NoError(t, err)
+	buChan, err := r.BookUpdates()
+	assert.NoError(t, err)
+
+	//assert
+	assert.Equal(t, trade, <-tc)
+	assert.Equal(t, bookUpdate, <-buChan)
+	assert.NoError(t, r.Close())
+
+	files := readRecordings(t, dir)
+	assert.Len(t, files, 1)
+	assert.Len(t, files[0], 2)
+
+	streams := map[string]Record{}
+	for _, rec := range files[0] {
+		streams[rec.Stream] = rec
+	}
+	assert.JSONEq(t, rawTrade, string(streams["bnbbtc@trade"].Data))
+	assert.Equal(t, received.UnixNano(), streams["bnbbtc@trade"].ReceivedAt)
+	assert.JSONEq(t, rawBookUpdate, string(streams["bnbbtc@depth@100ms"].Data))
+	assert.Equal(t, received.Add(time.Millisecond).UnixNano(), streams["bnbbtc@depth@100ms"].ReceivedAt)
+}
+
+func TestRecorderReencodesEventsWithoutRawPayload(t *testing.T) {
+	//arrange
+	logBuffer.Reset()
+	dir := t.TempDir()
+	feed := newStubFeeder(testSymbol)
+	feed.bookUpdates <- expectedBookUpdate // as if merged by a conflating buffer
+	feed.bookUpdates <- bookUpdateOf(161, 170, nil, nil)
+	feed.bookUpdates <- BookUpdate{Raw: json.RawMessage(rawBookUpdate)}
+
+	r, err := NewRecorder(feed, dir, nil)
+	assert.NoError(t, err)
+
+	//act
+	buChan, err := r.BookUpdates()
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		<-buChan
+	}
+	assert.NoError(t, r.Close())
+
+	//assert
+	files := readRecordings(t, dir)
+	assert.Len(t, files, 1)
+	assert.Len(t, files[0], 3)
+	assert.JSONEq(t, rawBookUpdate, string(files[0][2].Data))
+
+	b, err := decodeBookUpdate(files[0][0].Data)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedBookUpdate, b)
+
+	logs, err := logContents(logBuffer.Contents())
+	assert.NoError(t, err)
+	warnings := 0
+	for _, l := range logs {
+		if l.Level == "warn" {
+			warnings++
+		}
+	}
+	assert.Equal(t, 1, warnings)
+}
+
+func TestNewRecorderDefaultsNilOptions(t *testing.T) {
+	r, err := NewRecorder(newStubFeeder(testSymbol), t.TempDir(), nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultRecordingOptions, r.w.opts)
+}
+
+func TestNewRecorderReturnsErrorIfFeedCantKeepRawPayloads(t *testing.T) {
+	feed, err := NewSyntheticFeeder(testSymbol, nil)
+	assert.NoError(t, err)
+
+	_, err = NewRecorder(feed, t.TempDir(), nil)
+
+	assert.Equal(t, errRawPayloadsUnsupported, err)
+}
+
+func TestNewRecorderHasWrappedBinanceFeedsKeepRawPayloads(t *testing.T) {
+	//arrange
+	bf := NewBinanceFeeder("bnbbtc")
+	mf := NewBinanceMultiFeeder("bnbbtc")
+	sf, _ := mf.Feeder("bnbbtc")
+
+	//act
+	_, err := NewRecorder(NewHub(Chain(bf, Throttle(time.Second)), nil).Subscribe(), t.TempDir(), nil)
+	assert.NoError(t, err)
+	_, err = NewRecorder(sf, t.TempDir(), nil)
+	assert.NoError(t, err)
+
+	//assert
+	assert.True(t, bf.rawPayloads)
+	assert.True(t, mf.rawPayloads)
+}
+
+func TestRecorderNamesStreamsAfterTheFeedsAndReplaysThem(t *testing.T) {
+	//arrange
+	mc := make(chan string, 1)
+	defer close(mc)
+
+	ws := newTestServer(futuresTradesURL, mc)
+	defer ws.Close()
+
+	mc <- rawFuturesTrade
+
+	dir := t.TempDir()
+	r, err := NewRecorder(newTestBinanceFuturesFeeder(ws), dir, nil)
+	assert.NoError(t, err)
+
+	//act
+	tc, err := r.Trades()
+	assert.NoError(t, err)
+	<-tc
+	assert.NoError(t, r.Close())
+
+	//assert
+	files := readRecordings(t, dir)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "test@aggTrade", files[0][0].Stream)
+	assert.JSONEq(t, rawFuturesTrade, string(files[0][0].Data))
+
+	rf, err := NewReplayFeeder(dir, testSymbol, ReplayASAP)
+	assert.NoError(t, err)
+	defer rf.Close()
+	replayed, err := rf.Trades()
+	assert.NoError(t, err)
+	rf.Start()
+	assert.Equal(t, expectedFuturesTrade, <-replayed)
+}
+
+func TestRecorderRotatesFilesBySize(t *testing.T) {
+	//arrange
+	dir := t.TempDir()
+	feed := newStubFeeder(testSymbol)
+	for i := 1; i <= 3; i++ {
+		feed.trades <- withRaw(Trade{ID: i})
+	}
+
+	r, err := NewRecorder(feed, dir, &RecordingOptions{MaxFileSize: 1})
+	assert.NoError(t, err)
+
+	//act
+	tc, err := r.Trades()
+	assert.NoError(t, err)
+	for i := 1; i <= 3; i++ {
+		<-tc
+	}
+	assert.NoError(t, r.Close())
+
+	//assert
+	files := readRecordings(t, dir)
+	assert.Len(t, files, 3)
+	for i, records := range files {
+		var trade Trade
+		assert.NoError(t, json.Unmarshal(records[0].Data, &trade))
+		assert.Equal(t, i+1, trade.ID)
+	}
+}
+
+func TestRecorderRotatesFilesByTime(t *testing.T) {
+	//arrange
+	dir := t.TempDir()
+	feed := newStubFeeder(testSymbol)
+
+	r, err := NewRecorder(feed, dir, &RecordingOptions{RotateEvery: time.Minute})
+	assert.NoError(t, err)
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	r.w.now = func() time.Time { return now }
+
+	tc, err := r.Trades()
+	assert.NoError(t, err)
+
+	//act
+	for i, elapsed := range []time.Duration{0, 30 * time.Second, time.Minute} {
+		now = now.Add(elapsed)
+		feed.trades <- withRaw(Trade{ID: i})
+		<-tc
+	}
+	assert.NoError(t, r.Close())
+
+	//assert
+	files := readRecordings(t, dir)
+	assert.Len(t, files, 2)
+	assert.Len(t, files[0], 2)
+	assert.Len(t, files[1], 1)
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*"))
+	sort.Strings(names)
+	assert.Equal(t, "test-20210301T120000.000000000Z-000001.jsonl.gz", filepath.Base(names[0]))
+	assert.Equal(t, "test-20210301T120130.000000000Z-000002.jsonl.gz", filepath.Base(names[1]))
+}
+
+func TestRecorderCloseClosesWrappedFeedAndChannels(t *testing.T) {
+	//arrange
+	feed := &closeTrackingFeeder{stubFeeder: newStubFeeder(testSymbol)}
+	r, err := NewRecorder(feed, t.TempDir(), DefaultRecordingOptions)
+	assert.NoError(t, err)
+
+	tc, _ := r.Trades()
+	buChan, _ := r.BookUpdates()
+
+	//act
+	err = r.Close()
+
+	//assert
+	assert.NoError(t, err)
+	assert.True(t, feed.closed)
+	_, ok := <-tc
+	assert.False(t, ok)
+	_, ok = <-buChan
+	assert.False(t, ok)
+}
+
+func TestBookEntryMarshalsAsPriceQuantityPair(t *testing.T) {
+	buf, err := json.Marshal(BookEntry{Price: MustParseDecimal("0.0024"), Quantity: MustParseDecimal("10")})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `["0.0024","10"]`, string(buf))
+}
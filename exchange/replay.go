@@ -0,0 +1,331 @@
+package exchange
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// ReplayASAP replays events as fast as they can be read
+	ReplayASAP float64 = 0
+	// ReplayRealTime replays events with the same gaps between them as when they happened
+	ReplayRealTime float64 = 1
+
+	// maxRecordSize is the longest line a recording can contain
+	maxRecordSize = 16 << 20
+	// replayLookahead is the most events read ahead of those replayed
+	replayLookahead = 10000
+)
+
+// replayFeeder is a Feeder of events recorded by a Recorder
+type replayFeeder struct {
+	files  []string
+	symbol string
+	speed  float64
+
+	start       sync.Once
+	mu          sync.Mutex
+	trades      chan Trade
+	bookUpdates chan BookUpdate
+	wantTrades  bool
+	wantUpdates bool
+
+	lc lifecycle
+}
+
+// NewReplayFeeder returns a feeder of the symbol's events recorded to files in dir.
+// Events are sent in event time order across both the trade and book update streams.
+// speed is how many times faster than real time the events are replayed, driven by
+// their recorded event times, e.g. ReplayRealTime, 10, or ReplayASAP.
+func NewReplayFeeder(dir string, symbol string, speed float64) (*replayFeeder, error) {
+	symbol = strings.ToLower(symbol)
+
+	files, err := filepath.Glob(filepath.Join(dir, symbol+"-*"+RecordingFileExtension))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recordings of %s found in %s", symbol, dir)
+	}
+	sort.Strings(files)
+
+	return &replayFeeder{
+		files:       files,
+		symbol:      symbol,
+		speed:       speed,
+		trades:      make(chan Trade),
+		bookUpdates: make(chan BookUpdate),
+	}, nil
+}
+
+func (rf *replayFeeder) GetSymbol() string {
+	return rf.symbol
+}
+
+// Trades returns a read-only channel of the recorded trades. The replay begins
+// once both Trades and BookUpdates have been requested, or Start has been called.
+func (rf *replayFeeder) Trades() (<-chan Trade, error) {
+	rf.mu.Lock()
+	rf.wantTrades = true
+	both := rf.wantUpdates
+	rf.mu.Unlock()
+
+	if both {
+		rf.Start()
+	}
+	return rf.trades, nil
+}
+
+// BookUpdates returns a read-only channel of the recorded book updates. The replay
+// begins once both Trades and BookUpdates have been requested, or Start has been called.
+func (rf *replayFeeder) BookUpdates() (<-chan BookUpdate, error) {
+	rf.mu.Lock()
+	rf.wantUpdates = true
+	both := rf.wantTrades
+	rf.mu.Unlock()
+
+	if both {
+		rf.Start()
+	}
+	return rf.bookUpdates, nil
+}
+
+// Start begins the replay, for when only one of Trades or BookUpdates is wanted.
+// Events of streams not requested by then are skipped. Channels are closed once
+// every event has been replayed.
+func (rf *replayFeeder) Start() {
+	rf.start.Do(func() {
+		rf.mu.Lock()
+		wantTrades, wantUpdates := rf.wantTrades, rf.wantUpdates
+		rf.mu.Unlock()
+
+		rf.lc.goroutine(func() {
+			rf.replay(wantTrades, wantUpdates)
+		})
+	})
+}
+
+// Close stops the replay and closes its channels
+func (rf *replayFeeder) Close() error {
+	rf.lc.close()
+
+	// channels are closed when the replay ends, which never started if not requested
+	rf.start.Do(func() {
+		close(rf.trades)
+		close(rf.bookUpdates)
+	})
+	return nil
+}
+
+// replay merges the trade and book update streams into event time order, relying
+// on each stream being in event time order itself. At most replayLookahead events
+// are read ahead waiting for an event of the other stream, so a recording with few
+// or no events of one stream isn't read into memory all at once.
+func (rf *replayFeeder) replay(wantTrades bool, wantUpdates bool) {
+	defer close(rf.trades)
+	defer close(rf.bookUpdates)
+
+	rr := &recordReader{files: rf.files}
+	defer rr.close()
+
+	var trades []Trade
+	var bookUpdates []BookUpdate
+	exhausted := false
+	p := pacer{speed: rf.speed, lc: &rf.lc}
+
+	for {
+		for !exhausted && len(trades)+len(bookUpdates) < replayLookahead &&
+			(wantTrades && len(trades) == 0 || wantUpdates && len(bookUpdates) == 0) {
+			r, ok := rr.next()
+			if !ok {
+				exhausted = true
+				break
+			}
+
+			switch {
+			case strings.HasSuffix(r.Stream, "@trade"), strings.HasSuffix(r.Stream, "@aggTrade"):
+				if !wantTrades {
+					continue
+				}
+				decode := decodeTrade
+				if strings.HasSuffix(r.Stream, "@aggTrade") {
+					decode = decodeFuturesTrade
+				}
+				t, err := decode(r.Data)
+				if err != nil {
+					log.Error().Err(err).
+						Str("detail", string(r.Data)).
+						Msgf("error unmarshalling trade")
+					continue
+				}
+				trades = append(trades, t)
+			case strings.Contains(r.Stream, "@depth"):
+				if !wantUpdates {
+					continue
+				}
+				b, err := decodeRecordedBookUpdate(r.Data)
+				if err != nil {
+					log.Error().Err(err).
+						Str("detail", string(r.Data)).
+						Msgf("error unmarshalling book update")
+					continue
+				}
+				bookUpdates = append(bookUpdates, b)
+			}
+		}
+
+		switch {
+		case len(trades) > 0 && (len(bookUpdates) == 0 || trades[0].EventTime <= bookUpdates[0].EventTime):
+			t := trades[0]
+			trades = trades[1:]
+			if !p.wait(t.EventTime) {
+				return
+			}
+			select {
+			case rf.trades <- t:
+			case <-rf.lc.done():
+				return
+			}
+		case len(bookUpdates) > 0:
+			b := bookUpdates[0]
+			bookUpdates = bookUpdates[1:]
+			if !p.wait(b.EventTime) {
+				return
+			}
+			select {
+			case rf.bookUpdates <- b:
+			case <-rf.lc.done():
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// decodeRecordedBookUpdate decodes a book update recorded from either a spot or
+// a futures market, futures updates being told apart by their previous final
+// update ID, which their first update ID follows on from as for the live feed
+func decodeRecordedBookUpdate(data []byte) (BookUpdate, error) {
+	var e struct {
+		BookUpdate
+		PrevLastUpdateID *int `json:"pu"`
+	}
+	if err := json.Unmarshal(data, &e); err != nil {
+		return BookUpdate{}, err
+	}
+	if e.PrevLastUpdateID != nil {
+		e.BookUpdate.FirstUpdateID = *e.PrevLastUpdateID + 1
+	}
+	return e.BookUpdate, nil
+}
+
+// pacer spaces out replayed events in proportion to their event times
+type pacer struct {
+	speed float64
+	lc    *lifecycle
+
+	started   bool
+	firstTime int
+	startedAt time.Time
+}
+
+// wait sleeps until the event with the given event time is due, returning false
+// if the lifecycle was closed in the meantime
+func (p *pacer) wait(eventTime int) bool {
+	if p.speed <= 0 {
+		return true
+	}
+	if !p.started {
+		p.started = true
+		p.firstTime = eventTime
+		p.startedAt = time.Now()
+		return true
+	}
+
+	elapsed := time.Duration(float64(eventTime-p.firstTime) * float64(time.Millisecond) / p.speed)
+	if d := time.Until(p.startedAt.Add(elapsed)); d > 0 {
+		return p.lc.sleep(d)
+	}
+	return true
+}
+
+// recordReader reads the records of a sequence of recording files in turn.
+// Files that can't be read are logged and skipped.
+type recordReader struct {
+	files []string
+
+	file    *os.File
+	gz      *gzip.Reader
+	scanner *bufio.Scanner
+}
+
+func (rr *recordReader) next() (Record, bool) {
+	for {
+		if rr.scanner == nil {
+			if len(rr.files) == 0 {
+				return Record{}, false
+			}
+			name := rr.files[0]
+			rr.files = rr.files[1:]
+			if err := rr.open(name); err != nil {
+				log.Error().Err(err).
+					Str("file", name).
+					Msg("error opening recording")
+				rr.close()
+				continue
+			}
+		}
+
+		if !rr.scanner.Scan() {
+			if err := rr.scanner.Err(); err != nil {
+				log.Error().Err(err).
+					Str("file", rr.file.Name()).
+					Msg("error reading recording")
+			}
+			rr.close()
+			continue
+		}
+
+		var r Record
+		if err := json.Unmarshal(rr.scanner.Bytes(), &r); err != nil {
+			log.Error().Err(err).
+				Str("detail", rr.scanner.Text()).
+				Msg("error unmarshalling record")
+			continue
+		}
+		return r, true
+	}
+}
+
+func (rr *recordReader) open(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	rr.file = f
+
+	if rr.gz, err = gzip.NewReader(f); err != nil {
+		return err
+	}
+	rr.scanner = bufio.NewScanner(rr.gz)
+	rr.scanner.Buffer(nil, maxRecordSize)
+	return nil
+}
+
+func (rr *recordReader) close() {
+	if rr.file != nil {
+		rr.file.Close()
+	}
+	rr.file, rr.gz, rr.scanner = nil, nil, nil
+}
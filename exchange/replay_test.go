@@ -0,0 +1,319 @@
+package exchange
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeRecording writes the events to a recording file, in the order given
+func writeRecording(t *testing.T, dir string, name string, events ...interface{}) {
+	f, err := os.Create(filepath.Join(dir, name))
+	assert.NoError(t, err)
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	defer gz.Close()
+
+	enc := json.NewEncoder(gz)
+	for _, e := range events {
+		stream := "bnbbtc@trade"
+		if _, ok := e.(BookUpdate); ok {
+			stream = "bnbbtc@depth@100ms"
+		}
+		data, err := json.Marshal(e)
+		assert.NoError(t, err)
+		assert.NoError(t, enc.Encode(Record{Stream: stream, Data: data}))
+	}
+}
+
+// replayedEvents reads both channels until they are closed, returning the
+// event times in the order they were sent
+func replayedEvents(tc <-chan Trade, buChan <-chan BookUpdate) []int {
+	var times []int
+	for tc != nil || buChan != nil {
+		select {
+		case t, ok := <-tc:
+			if !ok {
+				tc = nil
+				continue
+			}
+			times = append(times, t.EventTime)
+		case b, ok := <-buChan:
+			if !ok {
+				buChan = nil
+				continue
+			}
+			times = append(times, -b.EventTime)
+		}
+	}
+	return times
+}
+
+func TestNewReplayFeederReturnsErrorWithoutRecordings(t *testing.T) {
+	_, err := NewReplayFeeder(t.TempDir(), "bnbbtc", ReplayASAP)
+
+	assert.Error(t, err)
+}
+
+func TestReplayFeederImplementsFeederInterface(t *testing.T) {
+	dir := t.TempDir()
+	writeRecording(t, dir, "bnbbtc-1.jsonl.gz")
+
+	rf, err := NewReplayFeeder(dir, "BNBBTC", ReplayASAP)
+
+	assert.NoError(t, err)
+	assert.Implements(t, (*Feeder)(nil), rf, "Does not implement interface")
+	assert.Equal(t, "bnbbtc", rf.GetSymbol())
+}
+
+func TestReplayFeederSendsEventsInEventTimeOrderAcrossStreams(t *testing.T) {
+	//arrange
+	dir := t.TempDir()
+	// recorded in the order received, which isn't event time order across streams
+	writeRecording(t, dir, "bnbbtc-20210301T120000.000000000Z-000001.jsonl.gz",
+		Trade{ID: 1, EventTime: 100},
+		Trade{ID: 2, EventTime: 300},
+		BookUpdate{LastUpdateID: 1, EventTime: 200},
+	)
+	writeRecording(t, dir, "bnbbtc-20210301T130000.000000000Z-000002.jsonl.gz",
+		BookUpdate{LastUpdateID: 2, EventTime: 400},
+		Trade{ID: 3, EventTime: 500},
+	)
+	writeRecording(t, dir, "ethbtc-20210301T120000.000000000Z-000001.jsonl.gz",
+		Trade{ID: 9, EventTime: 150},
+	)
+
+	rf, err := NewReplayFeeder(dir, "bnbbtc", ReplayASAP)
+	assert.NoError(t, err)
+	defer rf.Close()
+
+	//act
+	tc, err := rf.Trades()
+	assert.NoError(t, err)
+	buChan, err := rf.BookUpdates()
+	assert.NoError(t, err)
+
+	//assert (book updates negated)
+	assert.Equal(t, []int{100, -200, 300, -400, 500}, replayedEvents(tc, buChan))
+}
+
+func TestReplayFeederReadsBoundedLookaheadOfRecordingWithOneStream(t *testing.T) {
+	//arrange
+	dir := t.TempDir()
+	var first, second []interface{}
+	for i := 1; i <= replayLookahead+100; i++ {
+		first = append(first, Trade{ID: i, EventTime: i})
+	}
+	for i := replayLookahead + 101; i <= replayLookahead+200; i++ {
+		second = append(second, Trade{ID: i, EventTime: i})
+	}
+	writeRecording(t, dir, "bnbbtc-20210301T120000.000000000Z-000001.jsonl.gz", first...)
+	secondFile := "bnbbtc-20210301T130000.000000000Z-000002.jsonl.gz"
+	writeRecording(t, dir, secondFile, second...)
+
+	rf, err := NewReplayFeeder(dir, "bnbbtc", ReplayASAP)
+	assert.NoError(t, err)
+	defer rf.Close()
+
+	tc, err := rf.Trades()
+	assert.NoError(t, err)
+	buChan, err := rf.BookUpdates()
+	assert.NoError(t, err)
+
+	//act
+	firstTrade := <-tc
+	// the second file is only opened once the lookahead has moved on to it
+	assert.NoError(t, os.Remove(filepath.Join(dir, secondFile)))
+	count := 1
+	for range tc {
+		count++
+	}
+
+	//assert
+	assert.Equal(t, 1, firstTrade.ID)
+	assert.Equal(t, replayLookahead+100, count)
+	_, ok := <-buChan
+	assert.False(t, ok)
+}
+
+func TestReplayFeederStartReplaysOnlyRequestedStreams(t *testing.T) {
+	//arrange
+	dir := t.TempDir()
+	writeRecording(t, dir, "bnbbtc-1.jsonl.gz",
+		Trade{ID: 1, EventTime: 100},
+		BookUpdate{LastUpdateID: 1, EventTime: 200},
+		Trade{ID: 2, EventTime: 300},
+	)
+
+	rf, err := NewReplayFeeder(dir, "bnbbtc", ReplayASAP)
+	assert.NoError(t, err)
+	defer rf.Close()
+
+	//act
+	tc, err := rf.Trades()
+	assert.NoError(t, err)
+	rf.Start()
+
+	//assert
+	assert.Equal(t, 1, (<-tc).ID)
+	assert.Equal(t, 2, (<-tc).ID)
+	_, ok := <-tc
+	assert.False(t, ok)
+}
+
+func TestReplayFeederReplaysAtSpeedMultiplier(t *testing.T) {
+	//arrange
+	dir := t.TempDir()
+	writeRecording(t, dir, "bnbbtc-1.jsonl.gz",
+		Trade{ID: 1, EventTime: 1000},
+		BookUpdate{LastUpdateID: 1, EventTime: 1500},
+		Trade{ID: 2, EventTime: 3000},
+	)
+
+	rf, err := NewReplayFeeder(dir, "bnbbtc", 10)
+	assert.NoError(t, err)
+	defer rf.Close()
+
+	//act
+	start := time.Now()
+	tc, _ := rf.Trades()
+	buChan, _ := rf.BookUpdates()
+	replayedEvents(tc, buChan)
+	elapsed := time.Since(start)
+
+	//assert 2s of events at 10 times real time
+	assert.True(t, elapsed >= 200*time.Millisecond, elapsed)
+	assert.True(t, elapsed < time.Second, elapsed)
+}
+
+func TestReplayFeederReplaysASAP(t *testing.T) {
+	//arrange
+	dir := t.TempDir()
+	writeRecording(t, dir, "bnbbtc-1.jsonl.gz",
+		Trade{ID: 1, EventTime: 0},
+		Trade{ID: 2, EventTime: 3600000},
+	)
+
+	rf, err := NewReplayFeeder(dir, "bnbbtc", ReplayASAP)
+	assert.NoError(t, err)
+	defer rf.Close()
+
+	//act
+	start := time.Now()
+	tc, _ := rf.Trades()
+	buChan, _ := rf.BookUpdates()
+	replayedEvents(tc, buChan)
+
+	//assert
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestReplayFeederSkipsAndLogsUnreadableRecords(t *testing.T) {
+	//arrange
+	logBuffer.Reset()
+
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "bnbbtc-0.jsonl.gz"), []byte("not gzip"), 0644))
+	writeRecording(t, dir, "bnbbtc-1.jsonl.gz", Trade{ID: 1, EventTime: 100})
+
+	rf, err := NewReplayFeeder(dir, "bnbbtc", ReplayASAP)
+	assert.NoError(t, err)
+	defer rf.Close()
+
+	//act
+	tc, _ := rf.Trades()
+	buChan, _ := rf.BookUpdates()
+
+	//assert
+	assert.Equal(t, []int{100}, replayedEvents(tc, buChan))
+	assertContainsErrorLog(t, logBuffer.Contents(), "error opening recording")
+}
+
+func TestReplayFeederCloseStopsReplay(t *testing.T) {
+	//arrange
+	dir := t.TempDir()
+	writeRecording(t, dir, "bnbbtc-1.jsonl.gz",
+		Trade{ID: 1, EventTime: 0},
+		Trade{ID: 2, EventTime: 3600000},
+	)
+
+	rf, err := NewReplayFeeder(dir, "bnbbtc", ReplayRealTime)
+	assert.NoError(t, err)
+	tc, _ := rf.Trades()
+	buChan, _ := rf.BookUpdates()
+	assert.Equal(t, 1, (<-tc).ID)
+
+	//act
+	err = rf.Close()
+
+	//assert
+	assert.NoError(t, err)
+	_, ok := <-tc
+	assert.False(t, ok)
+	_, ok = <-buChan
+	assert.False(t, ok)
+}
+
+func TestReplayFeederCloseBeforeReplayClosesChannels(t *testing.T) {
+	dir := t.TempDir()
+	writeRecording(t, dir, "bnbbtc-1.jsonl.gz", Trade{ID: 1})
+
+	rf, err := NewReplayFeeder(dir, "bnbbtc", ReplayASAP)
+	assert.NoError(t, err)
+	tc, _ := rf.Trades()
+
+	assert.NoError(t, rf.Close())
+	_, ok := <-tc
+	assert.False(t, ok)
+}
+
+func TestReplayFeederReplaysRecorderOutput(t *testing.T) {
+	//arrange
+	dir := t.TempDir()
+	feed := newStubFeeder("BNBBTC")
+	trade := expectedTrade
+	trade.Raw = json.RawMessage(rawTrade)
+	bookUpdate := expectedBookUpdate
+	bookUpdate.Raw = json.RawMessage(rawBookUpdate)
+	feed.trades <- trade
+	feed.bookUpdates <- bookUpdate
+
+	r, err := NewRecorder(feed, dir, DefaultRecordingOptions)
+	assert.NoError(t, err)
+	tc, _ := r.Trades()
+	buChan, _ := r.BookUpdates()
+	<-tc
+	<-buChan
+	assert.NoError(t, r.Close())
+
+	rf, err := NewReplayFeeder(dir, "bnbbtc", ReplayASAP)
+	assert.NoError(t, err)
+	defer rf.Close()
+
+	//act
+	tc, _ = rf.Trades()
+	buChan, _ = rf.BookUpdates()
+
+	//assert
+	assert.Equal(t, expectedTrade, <-tc)
+	assert.Equal(t, expectedBookUpdate, <-buChan)
+}
+
+func TestDecodeRecordedBookUpdateFollowsOnFromFuturesPreviousFinalUpdateID(t *testing.T) {
+	//act
+	spot, err := decodeRecordedBookUpdate([]byte(rawBookUpdate))
+	assert.NoError(t, err)
+	futures, err := decodeRecordedBookUpdate([]byte(futuresBookUpdate(157, 160, 149)))
+	assert.NoError(t, err)
+
+	//assert
+	assert.Equal(t, expectedBookUpdate, spot)
+	assert.Equal(t, 150, futures.FirstUpdateID)
+	assert.Equal(t, 160, futures.LastUpdateID)
+}
@@ -0,0 +1,62 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// BinanceRESTURL is the base URL for all REST interactions with the Binance platform
+	BinanceRESTURL string = "api.binance.com"
+)
+
+var defaultHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// restClient performs unsigned requests against the Binance REST API
+type restClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func newRESTClient(baseURL string) *restClient {
+	return &restClient{
+		baseURL:    baseURL,
+		httpClient: defaultHTTPClient,
+	}
+}
+
+// get requests the given path and decodes the JSON response body into v
+func (rc *restClient) get(path string, query url.Values, v interface{}) error {
+	return rc.getContext(context.Background(), path, query, v)
+}
+
+// getContext is get, abandoning the request if the context is cancelled
+func (rc *restClient) getContext(ctx context.Context, path string, query url.Values, v interface{}) error {
+	u := url.URL{Scheme: "https", Host: rc.baseURL, Path: path, RawQuery: query.Encode()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := rc.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s: %s", resp.StatusCode, path, string(body))
+	}
+
+	return json.Unmarshal(body, v)
+}
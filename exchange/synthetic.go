@@ -0,0 +1,461 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PriceModel moves a price over a period of dt seconds, drawing from rng
+type PriceModel interface {
+	Next(price float64, dt float64, rng *rand.Rand) float64
+}
+
+// RandomWalk moves the price by normally distributed steps, with a standard
+// deviation of Volatility per square root second
+type RandomWalk struct {
+	Volatility float64
+}
+
+func (rw *RandomWalk) Next(price float64, dt float64, rng *rand.Rand) float64 {
+	return price + rw.Volatility*math.Sqrt(dt)*rng.NormFloat64()
+}
+
+// GBM moves the price by geometric Brownian motion, with Drift and Volatility
+// per second, plus jumps arriving JumpRate times per second whose log sizes are
+// normally distributed with JumpMean and JumpStdDev (Merton's jump diffusion).
+// Jumps are disabled when JumpRate is zero.
+type GBM struct {
+	Drift      float64
+	Volatility float64
+	JumpRate   float64
+	JumpMean   float64
+	JumpStdDev float64
+}
+
+func (g *GBM) Next(price float64, dt float64, rng *rand.Rand) float64 {
+	logReturn := (g.Drift-g.Volatility*g.Volatility/2)*dt + g.Volatility*math.Sqrt(dt)*rng.NormFloat64()
+	for i := poisson(g.JumpRate*dt, rng); i > 0; i-- {
+		logReturn += g.JumpMean + g.JumpStdDev*rng.NormFloat64()
+	}
+	return price * math.Exp(logReturn)
+}
+
+// poisson draws the number of arrivals of a Poisson process with the given mean
+func poisson(mean float64, rng *rand.Rand) int {
+	if mean <= 0 {
+		return 0
+	}
+	if mean > 30 {
+		// normal approximation, as the product below underflows for large means
+		return int(math.Max(0, math.Round(mean+math.Sqrt(mean)*rng.NormFloat64())))
+	}
+
+	limit, n, p := math.Exp(-mean), 0, rng.Float64()
+	for p > limit {
+		n++
+		p *= rng.Float64()
+	}
+	return n
+}
+
+// SyntheticOptions configures the market generated by a synthetic feeder.
+// Trades and order book changes arrive as Poisson processes at TradeRate and
+// OrderRate per second, moving the order book's Levels on each side by up to
+// MaxLots lots. Book updates are sent every UpdateInterval of market time.
+// The market runs for Duration of market time, or until closed if zero.
+// Speed is as for NewReplayFeeder.
+type SyntheticOptions struct {
+	Seed           int64
+	Model          PriceModel
+	StartPrice     Decimal
+	TickSize       Decimal
+	LotSize        Decimal
+	Levels         int
+	MaxLots        int
+	TradeRate      float64
+	OrderRate      float64
+	UpdateInterval time.Duration
+	StartTime      time.Time
+	Duration       time.Duration
+	Speed          float64
+}
+
+var DefaultSyntheticOptions = &SyntheticOptions{
+	Seed:           1,
+	Model:          &GBM{Volatility: 0.0005, JumpRate: 0.01, JumpStdDev: 0.005},
+	StartPrice:     NewDecimalFromInt(100),
+	TickSize:       NewDecimal(1, 2),
+	LotSize:        NewDecimal(1, 3),
+	Levels:         20,
+	MaxLots:        1000,
+	TradeRate:      5,
+	OrderRate:      50,
+	UpdateInterval: 100 * time.Millisecond,
+	StartTime:      time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+	Speed:          ReplayASAP,
+}
+
+// syntheticFeeder is a Feeder of a market generated from stochastic models.
+// The same seed generates the same market.
+type syntheticFeeder struct {
+	symbol string
+	opts   *SyntheticOptions
+
+	start       sync.Once
+	mu          sync.Mutex
+	trades      chan Trade
+	bookUpdates chan BookUpdate
+	wantTrades  bool
+	wantUpdates bool
+
+	lc lifecycle
+}
+
+// NewSyntheticFeeder returns a feeder of a generated market for the symbol,
+// using DefaultSyntheticOptions if opts is nil. It returns an error if the
+// options can't generate a market.
+func NewSyntheticFeeder(symbol string, opts *SyntheticOptions) (*syntheticFeeder, error) {
+	if opts == nil {
+		opts = DefaultSyntheticOptions
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return &syntheticFeeder{
+		symbol:      strings.ToLower(symbol),
+		opts:        opts,
+		trades:      make(chan Trade),
+		bookUpdates: make(chan BookUpdate),
+	}, nil
+}
+
+func (o *SyntheticOptions) validate() error {
+	switch {
+	case o.Model == nil:
+		return errors.New("synthetic market needs a price model")
+	case o.StartPrice.Sign() <= 0:
+		return fmt.Errorf("synthetic market start price must be positive, not %s", o.StartPrice)
+	case o.TickSize.Sign() <= 0:
+		return fmt.Errorf("synthetic market tick size must be positive, not %s", o.TickSize)
+	case o.LotSize.Sign() <= 0:
+		return fmt.Errorf("synthetic market lot size must be positive, not %s", o.LotSize)
+	case o.Levels <= 0:
+		return fmt.Errorf("synthetic market needs at least one level, not %d", o.Levels)
+	case o.MaxLots <= 0:
+		return fmt.Errorf("synthetic market max lots must be at least one, not %d", o.MaxLots)
+	case !(o.TradeRate >= 0) || math.IsInf(o.TradeRate, 1):
+		return fmt.Errorf("synthetic market trade rate must be finite and not negative, not %v", o.TradeRate)
+	case !(o.OrderRate >= 0) || math.IsInf(o.OrderRate, 1):
+		return fmt.Errorf("synthetic market order rate must be finite and not negative, not %v", o.OrderRate)
+	case o.UpdateInterval <= 0:
+		return fmt.Errorf("synthetic market update interval must be positive, not %s", o.UpdateInterval)
+	case o.Duration < 0:
+		return fmt.Errorf("synthetic market duration can't be negative, not %s", o.Duration)
+	}
+	return nil
+}
+
+func (sf *syntheticFeeder) GetSymbol() string {
+	return sf.symbol
+}
+
+// Trades returns a read-only channel of the generated trades. The market starts
+// once both Trades and BookUpdates have been requested, or Start has been called.
+func (sf *syntheticFeeder) Trades() (<-chan Trade, error) {
+	sf.mu.Lock()
+	sf.wantTrades = true
+	both := sf.wantUpdates
+	sf.mu.Unlock()
+
+	if both {
+		sf.Start()
+	}
+	return sf.trades, nil
+}
+
+// BookUpdates returns a read-only channel of the generated book updates, the first
+// of which contains the whole book. The market starts once both Trades and
+// BookUpdates have been requested, or Start has been called.
+func (sf *syntheticFeeder) BookUpdates() (<-chan BookUpdate, error) {
+	sf.mu.Lock()
+	sf.wantUpdates = true
+	both := sf.wantTrades
+	sf.mu.Unlock()
+
+	if both {
+		sf.Start()
+	}
+	return sf.bookUpdates, nil
+}
+
+// Start starts the market, for when only one of Trades or BookUpdates is wanted.
+// Events of streams not requested by then are discarded.
+func (sf *syntheticFeeder) Start() {
+	sf.start.Do(func() {
+		sf.mu.Lock()
+		wantTrades, wantUpdates := sf.wantTrades, sf.wantUpdates
+		sf.mu.Unlock()
+
+		sf.lc.goroutine(func() {
+			sf.run(wantTrades, wantUpdates)
+		})
+	})
+}
+
+// Close stops the market and closes its channels
+func (sf *syntheticFeeder) Close() error {
+	sf.lc.close()
+
+	// channels are closed when the market stops, which never started if not requested
+	sf.start.Do(func() {
+		close(sf.trades)
+		close(sf.bookUpdates)
+	})
+	return nil
+}
+
+func (sf *syntheticFeeder) run(wantTrades bool, wantUpdates bool) {
+	defer close(sf.trades)
+	defer close(sf.bookUpdates)
+
+	m := newSyntheticMarket(strings.ToUpper(sf.symbol), sf.opts)
+	p := pacer{speed: sf.opts.Speed, lc: &sf.lc}
+
+	for {
+		trades, b := m.step()
+		if sf.opts.Duration > 0 && m.now.Sub(sf.opts.StartTime) > sf.opts.Duration {
+			return
+		}
+
+		if wantTrades {
+			for _, t := range trades {
+				if !p.wait(t.EventTime) {
+					return
+				}
+				select {
+				case sf.trades <- t:
+				case <-sf.lc.done():
+					return
+				}
+			}
+		}
+
+		if wantUpdates && (len(b.Bids) > 0 || len(b.Asks) > 0) {
+			if !p.wait(b.EventTime) {
+				return
+			}
+			select {
+			case sf.bookUpdates <- b:
+			case <-sf.lc.done():
+				return
+			}
+		}
+	}
+}
+
+// syntheticMarket is the state of a generated market
+type syntheticMarket struct {
+	symbol string
+	opts   *SyntheticOptions
+	rng    *rand.Rand
+
+	now          time.Time
+	started      bool
+	mid          float64
+	bids         map[Decimal]Decimal
+	asks         map[Decimal]Decimal
+	lastUpdateID int
+	lastTradeID  int
+	lastOrderID  int
+}
+
+func newSyntheticMarket(symbol string, opts *SyntheticOptions) *syntheticMarket {
+	return &syntheticMarket{
+		symbol: symbol,
+		opts:   opts,
+		rng:    rand.New(rand.NewSource(opts.Seed)),
+		now:    opts.StartTime,
+		mid:    opts.StartPrice.Float64(),
+		bids:   make(map[Decimal]Decimal),
+		asks:   make(map[Decimal]Decimal),
+	}
+}
+
+// step advances the market by an update interval, returning the trades made
+// and the book update of every level changed in that time
+func (m *syntheticMarket) step() ([]Trade, BookUpdate) {
+	bidChanges := make(map[Decimal]Decimal)
+	askChanges := make(map[Decimal]Decimal)
+	var trades []Trade
+
+	first := !m.started
+	m.started = true
+	dt := m.opts.UpdateInterval.Seconds()
+
+	if !first {
+		m.now = m.now.Add(m.opts.UpdateInterval)
+
+		// trades are taken from the book as it stood before the price moved
+		for i := poisson(m.opts.TradeRate*dt, m.rng); i > 0; i-- {
+			if t, ok := m.trade(bidChanges, askChanges); ok {
+				trades = append(trades, t)
+			}
+		}
+
+		m.mid = math.Max(m.opts.TickSize.Float64(), m.opts.Model.Next(m.mid, dt, m.rng))
+	}
+
+	bestBid, bestAsk := m.touch()
+	m.reprice(m.bids, bidChanges, bestBid, m.opts.TickSize.Neg())
+	m.reprice(m.asks, askChanges, bestAsk, m.opts.TickSize)
+
+	if !first {
+		for i := poisson(m.opts.OrderRate*dt, m.rng); i > 0; i-- {
+			if m.rng.Intn(2) == 0 {
+				m.order(m.bids, bidChanges, bestBid, m.opts.TickSize.Neg())
+			} else {
+				m.order(m.asks, askChanges, bestAsk, m.opts.TickSize)
+			}
+		}
+	}
+
+	b := BookUpdate{
+		Type:      "depthUpdate",
+		EventTime: eventTime(m.now),
+		Symbol:    m.symbol,
+		Bids:      sortedChanges(bidChanges, Decimal.GreaterThan),
+		Asks:      sortedChanges(askChanges, Decimal.LessThan),
+	}
+	if changes := len(b.Bids) + len(b.Asks); changes > 0 {
+		b.FirstUpdateID = m.lastUpdateID + 1
+		b.LastUpdateID = m.lastUpdateID + changes
+		m.lastUpdateID = b.LastUpdateID
+	}
+	return trades, b
+}
+
+// touch returns the best bid and ask prices for the mid price, a tick apart
+func (m *syntheticMarket) touch() (Decimal, Decimal) {
+	bestBid := NewDecimalFromFloat(m.mid).FloorToStep(m.opts.TickSize)
+	if bestBid.IsZero() {
+		bestBid = m.opts.TickSize
+	}
+	return bestBid, bestBid.Add(m.opts.TickSize)
+}
+
+// reprice moves a side of the book to start at best, removing levels that would
+// cross the book or are too deep, and filling levels that are empty. Bids stop
+// at the lowest tick, so a book of a low price has fewer levels.
+func (m *syntheticMarket) reprice(levels map[Decimal]Decimal, changes map[Decimal]Decimal, best Decimal, step Decimal) {
+	wanted := make(map[Decimal]bool, m.opts.Levels)
+	price := best
+	for i := 0; i < m.opts.Levels && !price.LessThan(m.opts.TickSize); i++ {
+		wanted[price] = true
+		if _, ok := levels[price]; !ok {
+			levels[price] = m.lots()
+			changes[price] = levels[price]
+		}
+		price = price.Add(step)
+	}
+
+	for price := range levels {
+		if !wanted[price] {
+			delete(levels, price)
+			changes[price] = Decimal{}
+		}
+	}
+}
+
+// order adds to or cancels from a random level of a side of the book
+func (m *syntheticMarket) order(levels map[Decimal]Decimal, changes map[Decimal]Decimal, best Decimal, step Decimal) {
+	price := best.Add(step.Mul(NewDecimalFromInt(int64(m.rng.Intn(m.opts.Levels)))))
+	qty, ok := levels[price]
+	if !ok {
+		return
+	}
+
+	if m.rng.Intn(2) == 0 {
+		qty = qty.Add(m.lots())
+	} else if qty = qty.Sub(m.lots()); qty.Sign() <= 0 {
+		// never empty a level, so that the book stays full
+		qty = m.opts.LotSize
+	}
+	levels[price] = qty
+	changes[price] = qty
+}
+
+// trade takes a market order from the best level of a random side of the book
+func (m *syntheticMarket) trade(bidChanges map[Decimal]Decimal, askChanges map[Decimal]Decimal) (Trade, bool) {
+	buy := m.rng.Intn(2) == 0
+	levels, changes, better := m.bids, bidChanges, Decimal.GreaterThan
+	if buy {
+		levels, changes, better = m.asks, askChanges, Decimal.LessThan
+	}
+
+	var price Decimal
+	found := false
+	for p := range levels {
+		if !found || better(p, price) {
+			price, found = p, true
+		}
+	}
+	if !found {
+		return Trade{}, false
+	}
+
+	qty := m.lots()
+	if remaining := levels[price].Sub(qty); remaining.Sign() > 0 {
+		levels[price] = remaining
+		changes[price] = remaining
+	} else {
+		qty = levels[price]
+		delete(levels, price)
+		changes[price] = Decimal{}
+	}
+
+	m.lastTradeID++
+	m.lastOrderID += 2
+	t := Trade{
+		Type:          "trade",
+		Symbol:        m.symbol,
+		ID:            m.lastTradeID,
+		BuyerOrderID:  m.lastOrderID - 1,
+		SellerOrderID: m.lastOrderID,
+		TradeTime:     eventTime(m.now),
+		EventTime:     eventTime(m.now),
+		Price:         price,
+		Quantity:      qty,
+		IsBuyerMaker:  !buy,
+	}
+	return t, true
+}
+
+// lots returns a random quantity of between 1 and MaxLots lots
+func (m *syntheticMarket) lots() Decimal {
+	return m.opts.LotSize.Mul(NewDecimalFromInt(int64(1 + m.rng.Intn(m.opts.MaxLots))))
+}
+
+func sortedChanges(changes map[Decimal]Decimal, less func(a, b Decimal) bool) []BookEntry {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	entries := make([]BookEntry, 0, len(changes))
+	for p, q := range changes {
+		entries = append(entries, BookEntry{Price: p, Quantity: q})
+	}
+	sort.Slice(entries, func(i, j int) bool { return less(entries[i].Price, entries[j].Price) })
+	return entries
+}
+
+// eventTime returns the time in Unix milliseconds, as used by Binance for event times
+func eventTime(t time.Time) int {
+	return int(t.UnixNano() / int64(time.Millisecond))
+}
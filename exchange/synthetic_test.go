@@ -0,0 +1,268 @@
+package exchange
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syntheticTestOptions returns options for a market of a minute, generated as
+// fast as possible
+func syntheticTestOptions(seed int64) *SyntheticOptions {
+	opts := *DefaultSyntheticOptions
+	opts.Seed = seed
+	opts.Levels = 5
+	opts.TradeRate = 20
+	opts.Model = &GBM{Volatility: 0.001, JumpRate: 0.1, JumpStdDev: 0.01}
+	opts.Duration = time.Minute
+	return &opts
+}
+
+// syntheticEvents reads both channels until they are closed, returning the
+// trades and book updates in the order they were sent
+func syntheticEvents(sf *syntheticFeeder) []interface{} {
+	tc, _ := sf.Trades()
+	buChan, _ := sf.BookUpdates()
+
+	var events []interface{}
+	for tc != nil || buChan != nil {
+		select {
+		case t, ok := <-tc:
+			if !ok {
+				tc = nil
+				continue
+			}
+			events = append(events, t)
+		case b, ok := <-buChan:
+			if !ok {
+				buChan = nil
+				continue
+			}
+			events = append(events, b)
+		}
+	}
+	return events
+}
+
+func bestLevel(levels map[Decimal]Decimal, better func(a, b Decimal) bool) Decimal {
+	var best Decimal
+	found := false
+	for p := range levels {
+		if !found || better(p, best) {
+			best, found = p, true
+		}
+	}
+	return best
+}
+
+func newTestSyntheticFeeder(t *testing.T, opts *SyntheticOptions) *syntheticFeeder {
+	sf, err := NewSyntheticFeeder("BNBBTC", opts)
+	assert.NoError(t, err)
+	return sf
+}
+
+func TestSyntheticFeederImplementsFeederInterface(t *testing.T) {
+	sf, err := NewSyntheticFeeder("BNBBTC", DefaultSyntheticOptions)
+
+	assert.NoError(t, err)
+	assert.Implements(t, (*Feeder)(nil), sf, "Does not implement interface")
+	assert.Equal(t, "bnbbtc", sf.GetSymbol())
+}
+
+func TestSyntheticFeederGeneratesSameMarketForSameSeed(t *testing.T) {
+	first := syntheticEvents(newTestSyntheticFeeder(t, syntheticTestOptions(42)))
+	second := syntheticEvents(newTestSyntheticFeeder(t, syntheticTestOptions(42)))
+	other := syntheticEvents(newTestSyntheticFeeder(t, syntheticTestOptions(43)))
+
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, other)
+}
+
+func TestSyntheticFeederGeneratesConsistentBook(t *testing.T) {
+	//arrange
+	sf := newTestSyntheticFeeder(t, syntheticTestOptions(7))
+	bids := make(map[Decimal]Decimal)
+	asks := make(map[Decimal]Decimal)
+	var gd gapDetector
+	trades, updates := 0, 0
+
+	//act
+	events := syntheticEvents(sf)
+
+	//assert
+	for _, e := range events {
+		switch e := e.(type) {
+		case Trade:
+			trades++
+			assert.Equal(t, "BNBBTC", e.Symbol)
+			assert.True(t, e.Quantity.Sign() > 0)
+			// trades are taken from the best level of the book
+			levels := bids
+			if e.Price != bestLevel(bids, Decimal.GreaterThan) {
+				assert.Equal(t, bestLevel(asks, Decimal.LessThan), e.Price)
+				levels = asks
+			}
+			assert.False(t, e.Quantity.GreaterThan(levels[e.Price]))
+			setLevel(levels, BookEntry{Price: e.Price, Quantity: levels[e.Price].Sub(e.Quantity)})
+		case BookUpdate:
+			updates++
+			if updates == 1 {
+				assert.Equal(t, 1, e.FirstUpdateID)
+				assert.Len(t, e.Bids, 5)
+				assert.Len(t, e.Asks, 5)
+			}
+			_, gap := gd.check(e)
+			assert.False(t, gap)
+			assert.Equal(t, len(e.Bids)+len(e.Asks), e.LastUpdateID-e.FirstUpdateID+1)
+
+			for _, bid := range e.Bids {
+				setLevel(bids, bid)
+			}
+			for _, ask := range e.Asks {
+				setLevel(asks, ask)
+			}
+			// the book is refilled at every update
+			assert.Len(t, bids, 5)
+			assert.Len(t, asks, 5)
+			assert.True(t, bestLevel(bids, Decimal.GreaterThan).LessThan(bestLevel(asks, Decimal.LessThan)))
+		}
+	}
+	assert.True(t, trades > 100, trades)
+	assert.Equal(t, 601, updates)
+}
+
+func setLevel(levels map[Decimal]Decimal, e BookEntry) {
+	if e.Quantity.IsZero() {
+		delete(levels, e.Price)
+	} else {
+		levels[e.Price] = e.Quantity
+	}
+}
+
+func TestSyntheticFeederOnlyBidsAtPositivePricesForLowPrice(t *testing.T) {
+	//arrange
+	opts := syntheticTestOptions(3)
+	opts.StartPrice = MustParseDecimal("0.05")
+	opts.Levels = 20
+	sf := newTestSyntheticFeeder(t, opts)
+	bids := make(map[Decimal]Decimal)
+
+	//act
+	events := syntheticEvents(sf)
+
+	//assert
+	for _, e := range events {
+		if b, ok := e.(BookUpdate); ok {
+			for _, bid := range b.Bids {
+				assert.False(t, bid.Price.LessThan(opts.TickSize), bid.Price.String())
+				setLevel(bids, bid)
+			}
+		}
+	}
+	assert.NotEmpty(t, bids)
+	assert.True(t, len(bids) < 20, len(bids))
+}
+
+func TestSyntheticFeederStartGeneratesOnlyRequestedStreams(t *testing.T) {
+	//arrange
+	sf := newTestSyntheticFeeder(t, syntheticTestOptions(1))
+	defer sf.Close()
+
+	//act
+	buChan, err := sf.BookUpdates()
+	assert.NoError(t, err)
+	sf.Start()
+
+	//assert
+	count := 0
+	for range buChan {
+		count++
+	}
+	assert.Equal(t, 601, count)
+}
+
+func TestNewSyntheticFeederDefaultsNilOptions(t *testing.T) {
+	sf, err := NewSyntheticFeeder("BNBBTC", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultSyntheticOptions, sf.opts)
+}
+
+func TestNewSyntheticFeederReturnsErrorForInvalidOptions(t *testing.T) {
+	for name, invalidate := range map[string]func(o *SyntheticOptions){
+		"no model":          func(o *SyntheticOptions) { o.Model = nil },
+		"zero start price":  func(o *SyntheticOptions) { o.StartPrice = Decimal{} },
+		"zero tick size":    func(o *SyntheticOptions) { o.TickSize = Decimal{} },
+		"negative lot size": func(o *SyntheticOptions) { o.LotSize = NewDecimalFromInt(-1) },
+		"zero levels":       func(o *SyntheticOptions) { o.Levels = 0 },
+		"zero max lots":     func(o *SyntheticOptions) { o.MaxLots = 0 },
+		"negative rate":     func(o *SyntheticOptions) { o.TradeRate = -1 },
+		"NaN rate":          func(o *SyntheticOptions) { o.OrderRate = math.NaN() },
+		"infinite rate":     func(o *SyntheticOptions) { o.OrderRate = math.Inf(1) },
+		"zero interval":     func(o *SyntheticOptions) { o.UpdateInterval = 0 },
+		"negative duration": func(o *SyntheticOptions) { o.Duration = -time.Second },
+	} {
+		//arrange
+		opts := *DefaultSyntheticOptions
+		invalidate(&opts)
+
+		//act
+		sf, err := NewSyntheticFeeder("BNBBTC", &opts)
+
+		//assert
+		assert.Error(t, err, name)
+		assert.Nil(t, sf, name)
+	}
+}
+
+func TestSyntheticFeederCloseStopsMarket(t *testing.T) {
+	//arrange
+	opts := *DefaultSyntheticOptions
+	opts.Speed = ReplayRealTime
+	sf := newTestSyntheticFeeder(t, &opts)
+	tc, _ := sf.Trades()
+	buChan, _ := sf.BookUpdates()
+	<-buChan
+
+	//act
+	err := sf.Close()
+
+	//assert
+	assert.NoError(t, err)
+	for range tc {
+	}
+	for range buChan {
+	}
+}
+
+func TestSyntheticFeederCloseBeforeStartClosesChannels(t *testing.T) {
+	sf := newTestSyntheticFeeder(t, DefaultSyntheticOptions)
+	tc, _ := sf.Trades()
+
+	assert.NoError(t, sf.Close())
+	_, ok := <-tc
+	assert.False(t, ok)
+}
+
+func TestPriceModelsWithoutVolatility(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	assert.Equal(t, 100.0, (&RandomWalk{}).Next(100, 1, rng))
+	assert.InDelta(t, 100*math.Exp(0.1), (&GBM{Drift: 0.05}).Next(100, 2, rng), 1e-9)
+}
+
+func TestPoissonMeanMatchesRate(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for _, mean := range []float64{0.5, 5, 100} {
+		total := 0
+		for i := 0; i < 10000; i++ {
+			total += poisson(mean, rng)
+		}
+		assert.InDelta(t, mean, float64(total)/10000, mean*0.05)
+	}
+	assert.Equal(t, 0, poisson(0, rng))
+}